@@ -14,14 +14,15 @@
 package main
 
 import (
-	"fmt"
+	"os"
 
 	"github.com/aws/amazon-ec2-metadata-mock/pkg/cmd/root"
 )
 
 func main() {
 	rootCmd := root.NewCmd()
+	// the error is printed by cobra
 	if err := rootCmd.Execute(); err != nil {
-		panic(fmt.Errorf("Fatal error while executing the root command: %s", err))
+		os.Exit(1)
 	}
 }
@@ -21,13 +21,18 @@ import (
 
 	cmdutil "github.com/aws/amazon-ec2-metadata-mock/pkg/cmd/cmdutil"
 	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
-	se "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/asglifecycle"
+	asglifecyclemock "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/asglifecycle"
 
 	"github.com/spf13/cobra"
 )
 
 const (
 	cfgPrefix = "asglifecycle."
+
+	// local flags
+	statesFlagName = "states"
+
+	lifecycleHooksCfgKey = "lifecycle-hooks"
 )
 
 var (
@@ -51,15 +56,18 @@ func initConfig() {
 
 func newCmd() *cobra.Command {
 	var cmd = &cobra.Command{
-		Use:     "asglifecycle [--code CODE] [--state STATE] [--not-after] [--not-before-deadline]",
+		Use:     "asglifecycle [--states STATES]",
 		Aliases: []string{"asglifecycle", "autoscaling", "asg"},
 		PreRunE: preRun,
-		Example: fmt.Sprintf("  %s asglifecycle -h \tasglifecycle help \n  %s asglifecycle -t target-lifecycle-state\t\tmocks asg lifecycle target lifecycle states", cmdutil.BinName, cmdutil.BinName),
-		Run:     run,
+		Example: fmt.Sprintf("  %s asglifecycle -h \tasglifecycle help \n  %s asglifecycle --states Warmed:Stopped=60,InService\t\tmocks an instance in the warm pool entering service after 60 seconds", cmdutil.BinName, cmdutil.BinName),
+		RunE:    run,
 		Short:   "Mock EC2 ASG Lifecycle target-lifecycle-state",
 		Long:    "Mock EC2 ASG Lifecycle target-lifecycle-state",
 	}
 
+	// local flags
+	cmd.Flags().StringSlice(statesFlagName, nil, "comma separated sequence of target lifecycle states, each as STATE or STATE=SECONDS, the time spent in the state. The last state lasts until the asg termination delay or trigger time, unless its time is given (default: InService)\nstate can be one of the following: "+strings.Join(asglifecyclemock.States, ","))
+
 	// bind local flags to config
 	cfg.BindFlagSetWithKeyPrefix(cmd.Flags(), cfgPrefix)
 	return cmd
@@ -79,13 +87,16 @@ func preRun(cmd *cobra.Command, args []string) error {
 
 // ValidateLocalConfig validates all local config and returns a slice of error messages
 func ValidateLocalConfig() []string {
-	// no-op
-	return nil
+	var errStrings []string
+	c := c.ASGLifecycleConfig
+
+	errStrings = append(errStrings, asglifecyclemock.ValidateStates(statesFlagName, c.States)...)
+	errStrings = append(errStrings, asglifecyclemock.ValidateLifecycleHooks(cfgPrefix+lifecycleHooksCfgKey, c.LifecycleHooks)...)
+	return errStrings
 }
 
-func run(cmd *cobra.Command, args []string) {
+func run(cmd *cobra.Command, args []string) error {
 	log.Printf("Initiating %s for EC2 ASG Lifecycle on port %s\n", cmdutil.BinName, c.Server.Port)
 	cmdutil.PrintFlags(cmd.Flags())
-	cmdutil.RegisterHandlers(cmd, c)
-	se.Mock(c)
+	return cmdutil.Serve(cmd, c)
 }
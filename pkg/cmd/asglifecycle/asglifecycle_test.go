@@ -29,7 +29,7 @@ func TestNewCmdName(t *testing.T) {
 	h.Assert(t, expected == actual, fmt.Sprintf("Expected the name for asglifecycle command to be %s, but was %s", expected, actual))
 }
 func TestNewCmdLocalFlags(t *testing.T) {
-	expectedFlags := []string{}
+	expectedFlags := []string{"states"}
 
 	cmd := newCmd()
 	actualFlagSet := cmd.LocalFlags()
@@ -47,9 +47,9 @@ func TestNewCmdHasPreRunE(t *testing.T) {
 	h.Assert(t, pre != nil, "Expected a non nil PreRunE for the asglifecycle command")
 }
 
-func TestNewCmdHasRun(t *testing.T) {
-	run := newCmd().Run
-	h.Assert(t, run != nil, "Expected a non nil Run for the asglifecycle command")
+func TestNewCmdHasRunE(t *testing.T) {
+	run := newCmd().RunE
+	h.Assert(t, run != nil, "Expected a non nil RunE for the asglifecycle command")
 }
 func TestNewCmdHasExample(t *testing.T) {
 	hasExample := newCmd().HasExample()
@@ -14,21 +14,19 @@
 package cmdutil
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
 	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
-	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/asglifecycle"
-	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/dynamic"
-	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events"
-	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/handlers"
-	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/imdsv2"
-	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot"
-	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/static"
-	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/userdata"
-	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -37,11 +35,11 @@ import (
 // BinName is the name of this tool's binary
 const BinName = "ec2-metadata-mock"
 
-// handlerPair holds a tuple of a path and its associated handler
-type handlerPair struct {
-	path    string
-	handler server.HandlerType
-}
+var (
+	// activeMock is the mock started by Serve, which is reloaded when the config file changes
+	activeMock   *mock.Mock
+	activeMockMu sync.Mutex
+)
 
 // Contains finds a string in the given array
 func Contains(slice []string, val string) bool {
@@ -80,59 +78,53 @@ func ValidateRFC3339TimeFormat(flagName string, input string) error {
 	return nil
 }
 
-// RegisterHandlers binds paths to handlers for ALL commands
-func RegisterHandlers(cmd *cobra.Command, config cfg.Config) {
-	handlerPairsToRegister := getHandlerPairs(cmd, config)
-	for _, handlerPair := range handlerPairsToRegister {
-		if config.Imdsv2Required {
-			server.HandleFunc(handlerPair.path, imdsv2.ValidateToken(handlerPair.handler))
-		} else {
-			server.HandleFunc(handlerPair.path, handlerPair.handler)
-		}
-	}
+// Serve starts a mock serving the handlers for the given command and blocks until SIGINT or SIGTERM is received,
+// giving in-flight requests time to complete before returning
+func Serve(cmd *cobra.Command, config cfg.Config) error {
+	// config has been validated at this point, so usage does not help with errors from here on
+	cmd.SilenceUsage = true
 
-	static.RegisterHandlers(config)
-	dynamic.RegisterHandlers(config)
-	userdata.RegisterHandlers(config)
+	m := newMock(cmd, config)
+	activeMockMu.Lock()
+	activeMock = m
+	activeMockMu.Unlock()
 
-	// paths without explicit handler bindings will fallback to CatchAllHandler
-	server.HandleFuncPrefix("/", handlers.CatchAllHandler)
-}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-// getHandlerPairs returns a slice of {paths, handlers} to register
-func getHandlerPairs(cmd *cobra.Command, config cfg.Config) []handlerPair {
-	// always register these paths
-	handlerPairs := []handlerPair{
-		{path: "/", handler: handlers.ListRoutesHandler},
-		{path: "/latest", handler: handlers.ListRoutesHandler},
-		{path: static.ServicePath, handler: handlers.ListRoutesHandler},
-		{path: dynamic.ServicePath, handler: handlers.ListRoutesHandler},
+	addr, err := m.Start(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Serving on %s\n", addr)
+	if err := m.Wait(); err != nil {
+		return fmt.Errorf("Failed to serve on %s: %s", addr, err)
 	}
+	log.Println("Shut down successfully")
+	return nil
+}
 
-	isSpot := strings.Contains(cmd.Name(), "spot")
-	isEvents := strings.Contains(cmd.Name(), "events")
-	isASGLifecycle := strings.Contains(cmd.Name(), "asglifecycle")
+// Reload applies the given config to the mock started by Serve, if any
+func Reload(config cfg.Config) {
+	activeMockMu.Lock()
+	m := activeMock
+	activeMockMu.Unlock()
 
-	subCommandHandlers := map[string][]handlerPair{
-		"spot": {{path: config.Metadata.Paths.Spot, handler: spot.Handler},
-			{path: config.Metadata.Paths.SpotTerminationTime, handler: spot.Handler},
-			{path: config.Metadata.Paths.RebalanceRecTime, handler: spot.Handler}},
-		"events":       {{path: config.Metadata.Paths.Events, handler: events.Handler}},
-		"asglifecycle": {{path: config.Metadata.Paths.ASGLifecycle, handler: asglifecycle.Handler}},
+	if m != nil {
+		m.Reload(config)
 	}
+}
 
-	if isSpot {
-		handlerPairs = append(handlerPairs, subCommandHandlers["spot"]...)
-	} else if isEvents {
-		handlerPairs = append(handlerPairs, subCommandHandlers["events"]...)
-	} else if isASGLifecycle {
-		handlerPairs = append(handlerPairs, subCommandHandlers["asglifecycle"]...)
-	} else {
-		// root registers all subcommands
-		for k := range subCommandHandlers {
-			handlerPairs = append(handlerPairs, subCommandHandlers[k]...)
-		}
+// newMock returns a mock serving the features of the given command; root serves all features
+func newMock(cmd *cobra.Command, config cfg.Config) *mock.Mock {
+	switch {
+	case strings.Contains(cmd.Name(), "spot"):
+		return mock.New(config, mock.Spot)
+	case strings.Contains(cmd.Name(), "events"):
+		return mock.New(config, mock.Events)
+	case strings.Contains(cmd.Name(), "asglifecycle"):
+		return mock.New(config, mock.ASGLifecycle)
+	default:
+		return mock.New(config)
 	}
-
-	return handlerPairs
 }
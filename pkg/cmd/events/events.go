@@ -23,7 +23,7 @@ import (
 	cmdutil "github.com/aws/amazon-ec2-metadata-mock/pkg/cmd/cmdutil"
 	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
 	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
-	se "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events"
+	eventsmock "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events"
 
 	"github.com/spf13/cobra"
 )
@@ -38,17 +38,11 @@ const (
 	notAfterFlagName          = "not-after"
 	notBeforeDeadlineFlagName = "not-before-deadline"
 
-	// event codes
-	instanceReboot     = "instance-reboot"
-	systemReboot       = "system-reboot"
-	systemMaintenance  = "system-maintenance"
-	instanceRetirement = "instance-retirement"
-	instanceStop       = "instance-stop"
+	// config key of the list of scheduled events
+	scheduledCfgKey = "scheduled"
 
-	// event states
-	active    = "active"
-	completed = "completed"
-	canceled  = "canceled"
+	// default event code
+	systemReboot = "system-reboot"
 
 	// default date diffs (in days) in metadata
 	notAfterDiff          = 7
@@ -62,8 +56,8 @@ var (
 	Command *cobra.Command
 
 	// constraints
-	validEventCodes  = []string{instanceReboot, systemReboot, systemMaintenance, instanceRetirement, instanceStop}
-	validEventStates = []string{active, completed, canceled}
+	validEventCodes  = eventsmock.Codes
+	validEventStates = eventsmock.States
 	constraints      = []string{
 		"event-code can be one of the following: " + strings.Join(validEventCodes, ","),
 		"state can be one of the following: " + strings.Join(validEventStates, ","),
@@ -72,7 +66,7 @@ var (
 	// defaults
 	defaultCfg = map[string]interface{}{
 		cfgPrefix + eventCodeFlagName:         systemReboot,
-		cfgPrefix + eventStateFlagName:        active,
+		cfgPrefix + eventStateFlagName:        eventsmock.Active,
 		cfgPrefix + notBeforeFlagName:         time.Now().Format(time.RFC3339),
 		cfgPrefix + notAfterFlagName:          time.Now().Add(time.Hour * 24 * notAfterDiff).Format(time.RFC3339),
 		cfgPrefix + notBeforeDeadlineFlagName: time.Now().Add(time.Hour * 24 * notBeforeDeadlineDiff).Format(time.RFC3339),
@@ -94,7 +88,7 @@ func newCmd() *cobra.Command {
 		Aliases: []string{"se", "scheduledevents"},
 		PreRunE: preRun,
 		Example: fmt.Sprintf("  %s events -h \tevents help \n  %s events -o instance-stop --state active -d\t\tmocks an active and upcoming scheduled event for instance stop with a deadline for the event start time", cmdutil.BinName, cmdutil.BinName),
-		Run:     run,
+		RunE:    run,
 		Short:   "Mock EC2 maintenance events",
 		Long:    "Mock EC2 maintenance events",
 	}
@@ -156,12 +150,13 @@ func ValidateLocalConfig() []string {
 	if err := cmdutil.ValidateRFC3339TimeFormat(notBeforeDeadlineFlagName, c.NotBeforeDeadline); err != nil {
 		errStrings = append(errStrings, err.Error())
 	}
+
+	errStrings = append(errStrings, eventsmock.ValidateEvents(cfgPrefix+scheduledCfgKey, c.Scheduled)...)
 	return errStrings
 }
 
-func run(cmd *cobra.Command, args []string) {
+func run(cmd *cobra.Command, args []string) error {
 	log.Printf("Initiating %s for EC2 Events on port %s\n", cmdutil.BinName, c.Server.Port)
 	cmdutil.PrintFlags(cmd.Flags())
-	cmdutil.RegisterHandlers(cmd, c)
-	se.Mock(c)
+	return cmdutil.Serve(cmd, c)
 }
@@ -47,9 +47,9 @@ func TestNewCmdHasPreRunE(t *testing.T) {
 	h.Assert(t, pre != nil, "Expected a non nil PreRunE for the events command")
 }
 
-func TestNewCmdHasRun(t *testing.T) {
-	run := newCmd().Run
-	h.Assert(t, run != nil, "Expected a non nil Run for the events command")
+func TestNewCmdHasRunE(t *testing.T) {
+	run := newCmd().RunE
+	h.Assert(t, run != nil, "Expected a non nil RunE for the events command")
 }
 func TestNewCmdHasExample(t *testing.T) {
 	hasExample := newCmd().HasExample()
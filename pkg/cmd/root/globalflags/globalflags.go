@@ -39,9 +39,33 @@ const (
 	// PortFlag - the HTTP port where the mock runs
 	PortFlag = "port"
 
-	// Imdsv2Flag - whether to enable IMDSv2 only requiring a session token when submitting requests
+	// ShutdownTimeoutInSecFlag - how long in-flight requests are given to complete when the mock shuts down
+	ShutdownTimeoutInSecFlag = "shutdown-timeout-sec"
+
+	// Imdsv2Flag - whether to enable IMDSv2 only requiring a session token when submitting requests; alias for HTTPTokensFlag required
 	Imdsv2Flag = "imdsv2"
 
+	// HTTPTokensFlag - whether session tokens are optional or required when submitting requests
+	HTTPTokensFlag = "http-tokens"
+
+	// HTTPEndpointFlag - whether the metadata endpoint is enabled or disabled
+	HTTPEndpointFlag = "http-endpoint"
+
+	// InstanceMetadataTagsFlag - whether instance tags are served
+	InstanceMetadataTagsFlag = "instance-metadata-tags"
+
+	// HTTPPutResponseHopLimitFlag - the number of hops a token response travels before it is dropped
+	HTTPPutResponseHopLimitFlag = "http-put-response-hop-limit"
+
+	// ExtraHopCIDRsFlag - CIDRs of clients whose token responses travel one extra hop, e.g. containers behind a bridge
+	ExtraHopCIDRsFlag = "extra-hop-cidrs"
+
+	// Imdsv2MaxTokensFlag - the maximum number of live IMDSv2 session tokens
+	Imdsv2MaxTokensFlag = "imdsv2-max-tokens"
+
+	// Imdsv2SweepIntervalInSecFlag - how often expired IMDSv2 session tokens are removed, in seconds
+	Imdsv2SweepIntervalInSecFlag = "imdsv2-token-sweep-interval-sec"
+
 	// RebalanceDelayInSecFlag - rebalance rec delay in seconds, relative to the application start time
 	RebalanceDelayInSecFlag = "rebalance-delay-sec"
 
@@ -51,9 +75,33 @@ const (
 	ASGTerminationDelayInSecFlag = "asg-termination-delay-sec"
 
 	ASGTerminationTriggerTimeFlag = "asg-termination-trigger-time"
+
+	// ClockOffsetInSecFlag - how far mock time is ahead of wall clock time at start, in seconds
+	ClockOffsetInSecFlag = "clock-offset-sec"
+
+	// ClockStartTimeFlag - mock time at start in RFC3339
+	ClockStartTimeFlag = "clock-start-time"
+
+	// FreezeClockFlag - whether mock time stands still
+	FreezeClockFlag = "freeze-clock"
+
+	// AdminPortFlag - the HTTP port where the admin API runs, if not on PortFlag
+	AdminPortFlag = "admin-port"
+
+	// ScenarioFlag - path of a scenario file of timed steps run on the mock clock
+	ScenarioFlag = "scenario"
+
+	// DeriveValuesFlag - whether fields duplicating metadata values are derived from them
+	DeriveValuesFlag = "derive-values"
+
+	// FleetSizeFlag - the maximum number of instance identities generated for clients without a mapped identity
+	FleetSizeFlag = "fleet-size"
+
+	// FleetIdentityHeaderFlag - the request header naming the instance identity a client is served
+	FleetIdentityHeaderFlag = "fleet-identity-header"
 )
 
 // GetTopLevelFlags returns the top level global flags
 func GetTopLevelFlags() []string {
-	return []string{ConfigFileFlag, SaveConfigToFileFlag, WatchConfigFileFlag, MockDelayInSecFlag, MockTriggerTimeFlag, MockIPCountFlag, Imdsv2Flag, RebalanceDelayInSecFlag, RebalanceTriggerTimeFlag, ASGTerminationDelayInSecFlag, ASGTerminationTriggerTimeFlag}
+	return []string{ConfigFileFlag, SaveConfigToFileFlag, WatchConfigFileFlag, MockDelayInSecFlag, MockTriggerTimeFlag, MockIPCountFlag, Imdsv2Flag, Imdsv2MaxTokensFlag, Imdsv2SweepIntervalInSecFlag, RebalanceDelayInSecFlag, RebalanceTriggerTimeFlag, ASGTerminationDelayInSecFlag, ASGTerminationTriggerTimeFlag, ClockOffsetInSecFlag, ClockStartTimeFlag, FreezeClockFlag, AdminPortFlag, ScenarioFlag, DeriveValuesFlag}
 }
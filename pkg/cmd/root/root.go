@@ -16,9 +16,12 @@ package root
 import (
 	// Blank import else compiler complains it's unused
 	_ "embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net"
+	"strconv"
 	"strings"
 
 	"github.com/fsnotify/fsnotify"
@@ -32,8 +35,16 @@ import (
 	gf "github.com/aws/amazon-ec2-metadata-mock/pkg/cmd/root/globalflags"
 	"github.com/aws/amazon-ec2-metadata-mock/pkg/cmd/spot"
 	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
-	r "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/root"
-	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/access"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/admin"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/chaos"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/eligibility"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/fleet"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/signing"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/tree"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/versions"
 )
 
 var (
@@ -42,6 +53,10 @@ var (
 	//go:embed version.txt
 	version string
 
+	// valid metadata options
+	validHTTPTokens = []string{access.Optional, access.Required}
+	validToggles    = []string{access.Enabled, access.Disabled}
+
 	// defaults
 	cfgMdPrefix = cfg.GetCfgMdValPrefix()
 	cfgDnPrefix = cfg.GetCfgDnValPrefix()
@@ -78,7 +93,7 @@ func NewCmd() *cobra.Command {
 		Example:           fmt.Sprintf("  %s --mock-delay-sec 10\tmocks all metadata paths\n  %s spot --action terminate\tmocks spot ITN only", cmdutil.BinName, cmdutil.BinName),
 		PersistentPreRunE: setupAndSaveConfig, // persistentPreRun runs before PreRun
 		PreRunE:           preRun,
-		Run:               run,
+		RunE:              run,
 		Short:             "Tool to mock Amazon EC2 instance metadata",
 		Long:              cmdutil.BinName + " is a tool to mock Amazon EC2 instance metadata.",
 	}
@@ -87,17 +102,33 @@ func NewCmd() *cobra.Command {
 	// global flags
 	cmd.PersistentFlags().StringP(gf.HostNameFlag, "n", "", "the HTTP hostname for the mock url (default: 0.0.0.0)")
 	cmd.PersistentFlags().StringP(gf.PortFlag, "p", "", "the HTTP port where the mock runs (default: 1338)")
+	cmd.PersistentFlags().Int64(gf.ShutdownTimeoutInSecFlag, 0, "how long in-flight requests are given to complete after SIGINT or SIGTERM is received, in seconds (default: 10 seconds)")
 	cmd.PersistentFlags().StringP(gf.ConfigFileFlag, "c", "", "config file for cli input parameters in json format (default: "+cfg.GetDefaultCfgFileName()+")")
 	cmd.PersistentFlags().BoolP(gf.SaveConfigToFileFlag, "s", false, "whether to save processed config from all input sources in "+cfg.GetSavedCfgFileName()+" in $HOME or working dir, if homedir is not found (default: false)")
 	cmd.PersistentFlags().BoolP(gf.WatchConfigFileFlag, "w", false, "whether to watch the config file "+cfg.GetSavedCfgFileName()+" in $HOME or working dir, if homedir is not found (default: false)")
 	cmd.PersistentFlags().Int64P(gf.MockDelayInSecFlag, "d", 0, "spot itn delay in seconds, relative to the application start time (default: 0 seconds)")
 	cmd.PersistentFlags().String(gf.MockTriggerTimeFlag, "", "spot itn trigger time in RFC3339 format. This takes priority over "+gf.MockDelayInSecFlag+" (default: none)")
 	cmd.PersistentFlags().Int64P(gf.MockIPCountFlag, "x", 2, "number of IPs in a cluster that can receive a Spot Interrupt Notice and/or Scheduled Event")
-	cmd.PersistentFlags().BoolP(gf.Imdsv2Flag, "I", false, "whether to enable IMDSv2 only, requiring a session token when submitting requests (default: false, meaning both IMDS v1 and v2 are enabled)")
+	cmd.PersistentFlags().BoolP(gf.Imdsv2Flag, "I", false, "whether to enable IMDSv2 only, requiring a session token when submitting requests (default: false, meaning both IMDS v1 and v2 are enabled). Alias for --"+gf.HTTPTokensFlag+" required")
+	cmd.PersistentFlags().String(gf.HTTPTokensFlag, "", "whether a session token is optional or required when submitting requests, one of: optional,required (default: optional)")
+	cmd.PersistentFlags().String(gf.HTTPEndpointFlag, "", "whether the metadata endpoint is enabled or disabled; when disabled, all requests are refused with 403, one of: enabled,disabled (default: enabled)")
+	cmd.PersistentFlags().Int(gf.HTTPPutResponseHopLimitFlag, 0, "number of hops a token response travels before it is dropped, between 1 and 64. Requests travel 1 hop, unless they come from "+gf.ExtraHopCIDRsFlag+" (2 hops) or set the "+access.HopCountHeader+" header (default: 1)")
+	cmd.PersistentFlags().StringSlice(gf.ExtraHopCIDRsFlag, nil, "comma separated CIDRs of clients whose token responses travel one extra hop, e.g. containers behind a bridge network (default: none)")
+	cmd.PersistentFlags().String(gf.InstanceMetadataTagsFlag, "", "whether instance tags are served under "+access.InstanceTagsPath+", one of: enabled,disabled (default: enabled)")
+	cmd.PersistentFlags().Int(gf.Imdsv2MaxTokensFlag, 0, "maximum number of live IMDSv2 session tokens; token requests beyond it are throttled with 429 until tokens expire. 0 means no limit (default: 10000)")
+	cmd.PersistentFlags().Int64(gf.Imdsv2SweepIntervalInSecFlag, 0, "how often expired IMDSv2 session tokens are removed, in seconds (default: 60 seconds)")
 	cmd.PersistentFlags().Int64(gf.RebalanceDelayInSecFlag, 0, "rebalance rec delay in seconds, relative to the application start time (default: 0 seconds)")
 	cmd.PersistentFlags().String(gf.RebalanceTriggerTimeFlag, "", "rebalance rec trigger time in RFC3339 format. This takes priority over "+gf.RebalanceDelayInSecFlag+" (default: none)")
 	cmd.PersistentFlags().Int64P(gf.ASGTerminationDelayInSecFlag, "", 0, "asg termination delay in seconds, relative to the application start time (default: 0 seconds)")
 	cmd.PersistentFlags().Int64P(gf.ASGTerminationTriggerTimeFlag, "", 0, "asg termination trigger time in RFC3339 format. This takes priority over "+gf.ASGTerminationDelayInSecFlag+" (default: none)")
+	cmd.PersistentFlags().Int64(gf.ClockOffsetInSecFlag, 0, "how far mock time is ahead of wall clock time at start in seconds, e.g. to get past delays and token TTLs immediately; may be negative (default: 0 seconds)")
+	cmd.PersistentFlags().String(gf.ClockStartTimeFlag, "", "mock time at start in RFC3339 format. This takes priority over "+gf.ClockOffsetInSecFlag+" (default: none)")
+	cmd.PersistentFlags().Bool(gf.FreezeClockFlag, false, "whether mock time stands still until it is changed via the "+admin.ClockPath+" endpoint (default: false)")
+	cmd.PersistentFlags().String(gf.AdminPortFlag, "", "the HTTP port where the admin API under "+admin.PathPrefix+" runs instead of "+gf.PortFlag+", e.g. to keep it out of reach of the clients of the mock. Requests to it must carry the bearer token in the admin-token config key or AEMM_ADMIN_TOKEN env var, if set (default: none)")
+	cmd.PersistentFlags().String(gf.ScenarioFlag, "", "path of a JSON or YAML scenario file listing timed steps that change values, fire spot, events or asg notices and toggle metadata options, run on the mock clock (default: none)")
+	cmd.PersistentFlags().Bool(gf.DeriveValuesFlag, false, "whether the instance identity document, placement-region and the hostnames are derived from the instance id, ami id, availability zone, local ipv4 and instance type in the metadata values, unless they are overridden (default: false)")
+	cmd.PersistentFlags().Int(gf.FleetSizeFlag, 0, "maximum number of instance identities generated for clients that are not mapped to an identity in the fleet config, one per client IP or "+gf.FleetIdentityHeaderFlag+" value. Each identity has its own instance id, IPs, mac, interruption notices and IMDSv2 tokens (default: 0, all clients are served the same identity)")
+	cmd.PersistentFlags().String(gf.FleetIdentityHeaderFlag, "", "request header naming the instance identity a client is served, taking priority over the client IP; also selects the identity changed by admin requests (default: none)")
 
 	// add subcommands
 	cmd.AddCommand(spot.Command, events.Command, asglifecycle.Command)
@@ -112,6 +143,14 @@ func NewCmd() *cobra.Command {
 	// bind second level flags
 	cfg.BindServerCfg(cmd.PersistentFlags().Lookup(gf.HostNameFlag))
 	cfg.BindServerCfg(cmd.PersistentFlags().Lookup(gf.PortFlag))
+	cfg.BindServerCfg(cmd.PersistentFlags().Lookup(gf.ShutdownTimeoutInSecFlag))
+	cfg.BindMetadataOptionsCfg(cmd.PersistentFlags().Lookup(gf.HTTPTokensFlag))
+	cfg.BindMetadataOptionsCfg(cmd.PersistentFlags().Lookup(gf.HTTPEndpointFlag))
+	cfg.BindMetadataOptionsCfg(cmd.PersistentFlags().Lookup(gf.InstanceMetadataTagsFlag))
+	cfg.BindMetadataOptionsCfg(cmd.PersistentFlags().Lookup(gf.HTTPPutResponseHopLimitFlag))
+	cfg.BindMetadataOptionsCfg(cmd.PersistentFlags().Lookup(gf.ExtraHopCIDRsFlag))
+	cfg.BindFleetCfg(cmd.PersistentFlags().Lookup(gf.FleetSizeFlag))
+	cfg.BindFleetCfg(cmd.PersistentFlags().Lookup(gf.FleetIdentityHeaderFlag))
 
 	return cmd
 }
@@ -129,8 +168,7 @@ func setupAndSaveConfig(cmd *cobra.Command, args []string) error {
 				return
 			}
 			saveConfigToFile()
-			server.Reset()
-			cmdutil.RegisterHandlers(cmd, c)
+			cmdutil.Reload(c)
 		})
 		viper.WatchConfig()
 	}
@@ -146,6 +184,7 @@ func injectViperConfig() error {
 	if err != nil {
 		return fmt.Errorf("Fatal error while attempting to load viper config: %s", err)
 	}
+	aemmConfig.ExplicitKeys = cfg.GetExplicitKeys()
 
 	setConfig(aemmConfig)
 	return nil
@@ -180,18 +219,130 @@ func validateConfig() []string {
 	errStrings = append(errStrings, events.ValidateLocalConfig()...)
 	errStrings = append(errStrings, asglifecycle.ValidateLocalConfig()...)
 
+	if c.Imdsv2MaxTokens < 0 {
+		errStrings = append(errStrings, e.FlagValidationError{
+			FlagName:     gf.Imdsv2MaxTokensFlag,
+			Allowed:      "0 (no limit) or a positive integer",
+			InvalidValue: strconv.Itoa(c.Imdsv2MaxTokens)}.Error(),
+		)
+	}
+	if c.Imdsv2SweepIntervalInSec <= 0 {
+		errStrings = append(errStrings, e.FlagValidationError{
+			FlagName:     gf.Imdsv2SweepIntervalInSecFlag,
+			Allowed:      "a positive integer",
+			InvalidValue: strconv.FormatInt(c.Imdsv2SweepIntervalInSec, 10)}.Error(),
+		)
+	}
+
+	errStrings = append(errStrings, validateMetadataOptions(c.MetadataOptions)...)
+	errStrings = append(errStrings, validateFleet(c)...)
+	errStrings = append(errStrings, eligibility.ValidateEligibility("eligibility.", c.Eligibility)...)
+	errStrings = append(errStrings, chaos.ValidateChaos("chaos.", c.Chaos)...)
+	errStrings = append(errStrings, mock.ValidateAfterInterruption("after-interruption.", c.AfterInterruption)...)
+	errStrings = append(errStrings, versions.ValidateAPIVersions("api-versions.", c.APIVersions)...)
+	errStrings = append(errStrings, signing.ValidateSigning("signing.", c.Signing)...)
+	errStrings = append(errStrings, tree.ValidateInterfaces("metadata.interfaces", c.Metadata.Interfaces)...)
+	errStrings = append(errStrings, tree.ValidateTree("metadata.tree", c.Metadata.Tree)...)
+
 	if c.MockTriggerTime != "" {
 		if err := cmdutil.ValidateRFC3339TimeFormat(gf.MockTriggerTimeFlag, c.MockTriggerTime); err != nil {
 			errStrings = append(errStrings, err.Error())
 		}
 	}
+	if c.ClockStartTime != "" {
+		if err := cmdutil.ValidateRFC3339TimeFormat(gf.ClockStartTimeFlag, c.ClockStartTime); err != nil {
+			errStrings = append(errStrings, err.Error())
+		}
+	}
+	if c.Scenario != "" {
+		if _, err := mock.LoadScenario(c); err != nil {
+			errStrings = append(errStrings, err.Error()+"\n")
+		}
+	}
+
+	return errStrings
+}
+
+// validateMetadataOptions validates the metadata options, including the options of each path override
+func validateMetadataOptions(opts cfg.MetadataOptions) []string {
+	var errStrings []string
+	validate := func(flagName string, allowed []string, value string) {
+		if !cmdutil.Contains(allowed, value) {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     flagName,
+				Allowed:      strings.Join(allowed, ","),
+				InvalidValue: value}.Error(),
+			)
+		}
+	}
+
+	validate(gf.HTTPTokensFlag, validHTTPTokens, opts.HTTPTokens)
+	validate(gf.HTTPEndpointFlag, validToggles, opts.HTTPEndpoint)
+	validate(gf.InstanceMetadataTagsFlag, validToggles, opts.InstanceMetadataTags)
+	if opts.HTTPPutResponseHopLimit < 1 || opts.HTTPPutResponseHopLimit > 64 {
+		errStrings = append(errStrings, e.FlagValidationError{
+			FlagName:     gf.HTTPPutResponseHopLimitFlag,
+			Allowed:      "1-64",
+			InvalidValue: strconv.Itoa(opts.HTTPPutResponseHopLimit)}.Error(),
+		)
+	}
+	for _, cidr := range opts.ExtraHopCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     gf.ExtraHopCIDRsFlag,
+				Allowed:      "CIDRs, e.g. 172.17.0.0/16",
+				InvalidValue: cidr}.Error(),
+			)
+		}
+	}
+	for _, o := range opts.PathOverrides {
+		if !strings.HasPrefix(o.Path, "/") {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     "metadata-options.path-overrides.path",
+				Allowed:      "an absolute path, e.g. /latest/meta-data/iam",
+				InvalidValue: o.Path}.Error(),
+			)
+		}
+		// unset options are inherited from the top level options
+		if o.HTTPTokens != "" {
+			validate("metadata-options.path-overrides."+gf.HTTPTokensFlag, validHTTPTokens, o.HTTPTokens)
+		}
+		if o.HTTPEndpoint != "" {
+			validate("metadata-options.path-overrides."+gf.HTTPEndpointFlag, validToggles, o.HTTPEndpoint)
+		}
+	}
+	return errStrings
+}
 
+// validateFleet validates the fleet config, including the metadata values of each identity
+func validateFleet(c cfg.Config) []string {
+	var errStrings []string
+	if c.Fleet.Size < 0 {
+		errStrings = append(errStrings, e.FlagValidationError{
+			FlagName:     gf.FleetSizeFlag,
+			Allowed:      "0 (no generated identities) or a positive integer",
+			InvalidValue: strconv.Itoa(c.Fleet.Size)}.Error(),
+		)
+	}
+	errStrings = append(errStrings, fleet.ValidateIdentities("fleet.identities", c.Fleet.Identities)...)
+	for i, id := range c.Fleet.Identities {
+		values, err := json.Marshal(id.Values)
+		if err == nil {
+			err = admin.SetValues(&c, "metadata", values)
+		}
+		if err != nil {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     fmt.Sprintf("fleet.identities[%d].values", i),
+				Allowed:      "metadata values by their config keys, e.g. instance-id",
+				InvalidValue: err.Error()}.Error(),
+			)
+		}
+	}
 	return errStrings
 }
 
-func run(cmd *cobra.Command, args []string) {
+func run(cmd *cobra.Command, args []string) error {
 	log.Printf("Initiating %s for all mocks on port %s\n", cmdutil.BinName, c.Server.Port)
 	cmdutil.PrintFlags(cmd.Flags())
-	cmdutil.RegisterHandlers(cmd, c)
-	r.Mock(c)
+	return cmdutil.Serve(cmd, c)
 }
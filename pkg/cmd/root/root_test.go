@@ -31,7 +31,7 @@ func TestNewCmdName(t *testing.T) {
 	h.Assert(t, expected == actual, fmt.Sprintf("Expected the name for root command to be %s, but was %s", expected, actual))
 }
 func TestNewCmdFlags(t *testing.T) {
-	expectedFlags := []string{"config-file", "save-config-to-file", "watch-config-file", "mock-delay-sec", "mock-trigger-time", "mock-ip-count", "hostname", "port", "imdsv2", "rebalance-delay-sec", "rebalance-trigger-time", "asg-termination-delay-sec", "asg-termination-trigger-time"}
+	expectedFlags := []string{"config-file", "save-config-to-file", "watch-config-file", "mock-delay-sec", "mock-trigger-time", "mock-ip-count", "hostname", "port", "shutdown-timeout-sec", "imdsv2", "http-tokens", "http-endpoint", "instance-metadata-tags", "http-put-response-hop-limit", "extra-hop-cidrs", "imdsv2-max-tokens", "imdsv2-token-sweep-interval-sec", "rebalance-delay-sec", "rebalance-trigger-time", "asg-termination-delay-sec", "asg-termination-trigger-time", "clock-offset-sec", "clock-start-time", "freeze-clock", "admin-port", "scenario", "derive-values", "fleet-size", "fleet-identity-header"}
 
 	cmd := NewCmd()
 	actualFlagSet := cmd.PersistentFlags()
@@ -63,9 +63,9 @@ func TestNewCmdHasPreRunE(t *testing.T) {
 	pe := NewCmd().PreRunE
 	h.Assert(t, pe != nil, "Expected a non nil PreRunE for the root command")
 }
-func TestNewCmdHasRun(t *testing.T) {
-	run := NewCmd().Run
-	h.Assert(t, run != nil, "Expected a non nil Run for the root command")
+func TestNewCmdHasRunE(t *testing.T) {
+	run := NewCmd().RunE
+	h.Assert(t, run != nil, "Expected a non nil RunE for the root command")
 }
 func TestNewCmdHasExample(t *testing.T) {
 	hasExample := NewCmd().HasExample()
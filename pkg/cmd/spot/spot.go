@@ -22,7 +22,7 @@ import (
 	cmdutil "github.com/aws/amazon-ec2-metadata-mock/pkg/cmd/cmdutil"
 	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
 	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
-	s "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot"
+	spotmock "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot"
 
 	"github.com/spf13/cobra"
 )
@@ -35,10 +35,8 @@ const (
 	terminationTimeFlagName  = "time"
 	rebalanceRecTimeFlagName = "rebalance-rec-time"
 
-	// instance actions
+	// default instance action
 	terminate = "terminate"
-	hibernate = "hibernate"
-	stop      = "stop"
 )
 
 var (
@@ -48,7 +46,7 @@ var (
 	Command *cobra.Command
 
 	// constraints
-	validInstanceActions = []string{terminate, hibernate, stop}
+	validInstanceActions = spotmock.InstanceActions
 
 	// defaults
 	defaultCfg = map[string]interface{}{
@@ -71,7 +69,7 @@ func newCmd() *cobra.Command {
 		Aliases: []string{"spot"},
 		PreRunE: preRun,
 		Example: fmt.Sprintf("  %s spot -h \tspot help \n  %s spot -d 5 --action terminate\t\tmocks spot interruption only", cmdutil.BinName, cmdutil.BinName),
-		Run:     run,
+		RunE:    run,
 		Short:   "Mock EC2 Spot interruption notice",
 		Long:    "Mock EC2 Spot interruption notice",
 	}
@@ -126,9 +124,8 @@ func ValidateLocalConfig() []string {
 	return errStrings
 }
 
-func run(cmd *cobra.Command, args []string) {
+func run(cmd *cobra.Command, args []string) error {
 	log.Printf("Initiating %s for EC2 Spot interruption notice on port %s\n", cmdutil.BinName, c.Server.Port)
 	cmdutil.PrintFlags(cmd.Flags())
-	cmdutil.RegisterHandlers(cmd, c)
-	s.Mock(c)
+	return cmdutil.Serve(cmd, c)
 }
@@ -45,9 +45,9 @@ func TestNewCmdHasPreRunE(t *testing.T) {
 	pre := newCmd().PreRunE
 	h.Assert(t, pre != nil, "Expected a non nil PreRunE for the spot command")
 }
-func TestNewCmdHasRun(t *testing.T) {
-	run := newCmd().Run
-	h.Assert(t, run != nil, "Expected a non nil Run for the spot command")
+func TestNewCmdHasRunE(t *testing.T) {
+	run := newCmd().RunE
+	h.Assert(t, run != nil, "Expected a non nil RunE for the spot command")
 }
 func TestNewCmdHasExample(t *testing.T) {
 	hasExample := newCmd().HasExample()
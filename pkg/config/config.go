@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"reflect"
 	"strings"
 
 	"github.com/aws/amazon-ec2-metadata-mock/pkg/config/defaults"
@@ -120,6 +121,10 @@ func LoadConfigForRoot(configFileFlagName string, cmdDefaults map[string]interfa
 	SetDynamicDefaults(defaults.GetDefaultValues())
 	SetUserdataDefaults(defaults.GetDefaultValues())
 	SetServerCfgDefaults()
+	SetImdsv2CfgDefaults()
+	SetMetadataOptionsCfgDefaults()
+	SetAdminCfgDefaults()
+	SetFleetCfgDefaults()
 
 	// read in config using viper
 	if err := viper.ReadInConfig(); err != nil {
@@ -132,9 +137,41 @@ func LoadConfigForRoot(configFileFlagName string, cmdDefaults map[string]interfa
 	} else {
 		fmt.Println("Using configuration from file: ", viper.ConfigFileUsed())
 	}
+}
+
+// GetExplicitKeys returns the config keys set in the config file or env variables, as opposed to the keys left to
+// their defaults, which viper does not tell apart once the config is unmarshalled
+func GetExplicitKeys() map[string]bool {
+	explicit := map[string]bool{}
+	replacer := strings.NewReplacer("-", "_", ".", "_")
+	for _, key := range viper.AllKeys() {
+		if _, ok := os.LookupEnv("AEMM_" + strings.ToUpper(replacer.Replace(key))); ok || viper.InConfig(key) {
+			explicit[key] = true
+		}
+	}
+	return explicit
+}
 
-	// if config overrides update placeholder values, then paths with placeholders need to be updated as well
-	overrideMetadataPathsWithPlaceholders()
+// NewDefaultConfig returns a config populated with the default metadata, dynamic, userdata and server values only.
+// Config files, env variables and CLI flags are not consulted, nor is the global config modified.
+func NewDefaultConfig() (Config, error) {
+	v := viper.New()
+	jsonWithDefaults := defaults.GetDefaultValues()
+
+	mdPaths, mdValues := parseMetadataDefaults(jsonWithDefaults)
+	dyPaths, dyValues := parseDynamicDefaults(jsonWithDefaults)
+	udPaths, udValues := parseUserdataDefaults(jsonWithDefaults)
+	for _, d := range []map[string]interface{}{mdPaths, mdValues, dyPaths, dyValues, udPaths, udValues, serverCfgDefaults, imdsv2CfgDefaults, metadataOptionsCfgDefaults, adminCfgDefaults, fleetCfgDefaults} {
+		for key, value := range d {
+			v.SetDefault(key, value)
+		}
+	}
+
+	var c Config
+	if err := v.Unmarshal(&c); err != nil {
+		return Config{}, fmt.Errorf("Failed to load default config: %s", err)
+	}
+	return c, nil
 }
 
 // LoadConfigFromDefaults loads the given defaults into the config
@@ -185,31 +222,13 @@ func bindFlagWithKeyPrefix(flag *pflag.Flag, keyPrefix string) {
 	}
 }
 
-func overrideMetadataPathsWithPlaceholders() {
-	valueToPlaceholderPathsKeyMap := GetMetadataValueToPlaceholderPathsKeyMap()
-	_, valueDefaults := GetMetadataDefaults()
-	// override placeholders in paths, precedence is applied in the following order:
-	// (1) placeholder value in metadata path itself is overridden with a non-default value
-	// (2) placeholder value represented as metadata value is overridden
-	// (3) default value for the placeholder
-	for mdValueKey, listOfPaths := range valueToPlaceholderPathsKeyMap {
-		defaultValue := valueDefaults[mdValueKey].(string)
-		overriddenValue := viper.Get(mdValueKey).(string)
-		// apply (1) and (2) from above
-		if defaultValue != overriddenValue {
-			for _, pathKey := range listOfPaths {
-				// get current path value
-				switch currentPath := viper.Get(pathKey).(type) {
-				case string:
-					// find default value and replace with overridden value
-					updatedPath := strings.Replace(currentPath, defaultValue, overriddenValue, -1)
-					// set new path value
-					log.Printf("Updating path from %s to %s\n", currentPath, updatedPath)
-					viper.Set(pathKey, updatedPath)
-				default:
-					log.Printf("Something went wrong trying to update path. Expected type 'string' for %v\n", currentPath)
-				}
-			}
-		}
+// ByKey returns the fields of a config struct, e.g. Values, by their config keys. Configs built in code, e.g. by library
+// users, never pass through viper, so their key/value maps are read from the typed config by its mapstructure tags.
+func ByKey(s interface{}) map[string]interface{} {
+	v := reflect.ValueOf(s)
+	byKey := make(map[string]interface{}, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		byKey[v.Type().Field(i).Tag.Get("mapstructure")] = v.Field(i).Interface()
 	}
+	return byKey
 }
@@ -59,6 +59,17 @@ func BindDynamicCfg(flag *pflag.Flag) {
 
 // SetDynamicDefaults sets config defaults for dynamic paths and values
 func SetDynamicDefaults(jsonWithDefaults []byte) {
+	dyPathsDefaults, dyValuesDefaults = parseDynamicDefaults(jsonWithDefaults)
+
+	LoadConfigFromDefaults(dyPathsDefaults)
+	LoadConfigFromDefaults(dyValuesDefaults)
+}
+
+// parseDynamicDefaults returns config keys for dynamic paths and values mapped to their defaults
+func parseDynamicDefaults(jsonWithDefaults []byte) (map[string]interface{}, map[string]interface{}) {
+	pathsDefaults := map[string]interface{}{}
+	valuesDefaults := map[string]interface{}{}
+
 	// Unmarshal to map to preserve keys for Paths and Values
 	var defaultsMap map[string]interface{}
 	json.Unmarshal(jsonWithDefaults, &defaultsMap)
@@ -69,25 +80,24 @@ func SetDynamicDefaults(jsonWithDefaults []byte) {
 	for k, v := range dyPaths {
 		newKey := dyPathsCfgPrefix + k
 		// ex: "dynamic.paths.instance-identity-document": "/latest/dynamic/instance-identity/document"
-		dyPathsDefaults[newKey] = v
+		pathsDefaults[newKey] = v
 	}
 
 	for k, v := range dyValues {
 		newKey := dyValuesCfgPrefix + k
 		// ex: "dynamic.values.instance-identity-document": {"accountId" ...}
-		dyValuesDefaults[newKey] = v
+		valuesDefaults[newKey] = v
 
 		// if dyvalue is a nested struct, then re-unmarshal json data to correct type
 		if nestedStruct, ok := dyNestedValues[newKey]; ok {
 			updatedVal, err := unmarshalToNestedStruct(v, nestedStruct)
 			if err == nil {
-				dyValuesDefaults[newKey] = updatedVal
+				valuesDefaults[newKey] = updatedVal
 			}
 		}
 	}
 
-	LoadConfigFromDefaults(dyPathsDefaults)
-	LoadConfigFromDefaults(dyValuesDefaults)
+	return pathsDefaults, valuesDefaults
 }
 
 // GetDynamicDefaults returns config defaults for dynamic paths and values
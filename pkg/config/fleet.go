@@ -0,0 +1,43 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var (
+	fleetCfgPrefix   = "fleet."
+	fleetCfgDefaults = map[string]interface{}{
+		fleetCfgPrefix + "size":            0,
+		fleetCfgPrefix + "identity-header": "",
+	}
+)
+
+// BindFleetCfg binds a fleet flag, e.g. fleet-size, to its key in the fleet config, e.g. fleet.size
+func BindFleetCfg(flag *pflag.Flag) {
+	key := fleetCfgPrefix + strings.TrimPrefix(flag.Name, "fleet-")
+	if err := viper.BindPFlag(key, flag); err != nil {
+		panic(fmt.Errorf("Error binding CLI flag %s: %s", flag.Name, err.Error()))
+	}
+}
+
+// SetFleetCfgDefaults sets config defaults for fleet mode
+func SetFleetCfgDefaults() {
+	LoadConfigFromDefaults(fleetCfgDefaults)
+}
@@ -0,0 +1,27 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+var (
+	imdsv2CfgDefaults = map[string]interface{}{
+		"imdsv2-max-tokens":               10000,
+		"imdsv2-token-sweep-interval-sec": 60,
+		"imdsv2-token-secret":             "",
+	}
+)
+
+// SetImdsv2CfgDefaults sets config defaults for the IMDSv2 token store
+func SetImdsv2CfgDefaults() {
+	LoadConfigFromDefaults(imdsv2CfgDefaults)
+}
@@ -15,7 +15,11 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
 
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/config/defaults"
 	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/static/types"
 
 	"github.com/spf13/pflag"
@@ -80,6 +84,9 @@ var (
 	// values in mock responses
 	mdValuesDefaults = map[string]interface{}{}
 
+	// placeholders in metadata paths by the keys of their metadata values, parsed from the defaults once
+	mdPlaceholders = sync.OnceValue(parseMetadataPlaceholders)
+
 	// mapping of metadata value keys to its nested struct
 	mdNestedValues = map[string]interface{}{
 		"metadata.values.elastic-inference-accelerator": types.ElasticInferenceAccelerator{},
@@ -103,6 +110,17 @@ func BindMetadataCfg(flag *pflag.Flag) {
 
 // SetMetadataDefaults sets config defaults for metadata paths and values
 func SetMetadataDefaults(jsonWithDefaults []byte) {
+	mdPathsDefaults, mdValuesDefaults = parseMetadataDefaults(jsonWithDefaults)
+
+	LoadConfigFromDefaults(mdPathsDefaults)
+	LoadConfigFromDefaults(mdValuesDefaults)
+}
+
+// parseMetadataDefaults returns config keys for metadata paths and values mapped to their defaults
+func parseMetadataDefaults(jsonWithDefaults []byte) (map[string]interface{}, map[string]interface{}) {
+	pathsDefaults := map[string]interface{}{}
+	valuesDefaults := map[string]interface{}{}
+
 	// Unmarshal to map to preserve keys for Paths and Values
 	var defaultsMap map[string]interface{}
 	json.Unmarshal(jsonWithDefaults, &defaultsMap)
@@ -113,25 +131,24 @@ func SetMetadataDefaults(jsonWithDefaults []byte) {
 	for k, v := range mdPaths {
 		newKey := mdPathsCfgPrefix + k
 		// ex: "metadata.paths.ami-id": "/latest/meta-data/ami-id"
-		mdPathsDefaults[newKey] = v
+		pathsDefaults[newKey] = v
 	}
 
 	for k, v := range mdValues {
 		newKey := mdValuesCfgPrefix + k
 		// ex: "metadata.values.ami-id": "ami-0a887e401f7654935"
-		mdValuesDefaults[newKey] = v
+		valuesDefaults[newKey] = v
 
 		// if mdvalue is a nested struct, then re-unmarshal json data to correct type
 		if nestedStruct, ok := mdNestedValues[newKey]; ok {
 			updatedVal, err := unmarshalToNestedStruct(v, nestedStruct)
 			if err == nil {
-				mdValuesDefaults[newKey] = updatedVal
+				valuesDefaults[newKey] = updatedVal
 			}
 		}
 	}
 
-	LoadConfigFromDefaults(mdPathsDefaults)
-	LoadConfigFromDefaults(mdValuesDefaults)
+	return pathsDefaults, valuesDefaults
 }
 
 // GetMetadataDefaults returns config defaults for metadata paths and values
@@ -144,6 +161,33 @@ func GetMetadataValueToPlaceholderPathsKeyMap() map[string][]string {
 	return mdValueToPlaceholderPathsKeyMap
 }
 
+// Placeholder is a metadata value that metadata paths contain, e.g. the mac address
+type Placeholder struct {
+	// Default is the default value, which the paths contain unless they are overridden
+	Default string
+	// PathKeys are the keys of the paths containing the value, e.g. mac-device-number
+	PathKeys []string
+}
+
+// GetMetadataPlaceholders returns the placeholders in metadata paths by the keys of their metadata values, e.g. mac
+func GetMetadataPlaceholders() map[string]Placeholder {
+	return mdPlaceholders()
+}
+
+// parseMetadataPlaceholders returns the placeholders in metadata paths with their default values
+func parseMetadataPlaceholders() map[string]Placeholder {
+	_, valuesDefaults := parseMetadataDefaults(defaults.GetDefaultValues())
+	placeholders := make(map[string]Placeholder, len(mdValueToPlaceholderPathsKeyMap))
+	for valueKey, pathKeys := range mdValueToPlaceholderPathsKeyMap {
+		p := Placeholder{Default: fmt.Sprint(valuesDefaults[valueKey])}
+		for _, pathKey := range pathKeys {
+			p.PathKeys = append(p.PathKeys, strings.TrimPrefix(pathKey, mdPathsCfgPrefix))
+		}
+		placeholders[strings.TrimPrefix(valueKey, mdValuesCfgPrefix)] = p
+	}
+	return placeholders
+}
+
 // unmarshalToNestedStruct returns a struct with its nested values populated correctly
 func unmarshalToNestedStruct(originalValue interface{}, unmarshalToStruct interface{}) (interface{}, error) {
 	valAsJson, err := json.Marshal(originalValue)
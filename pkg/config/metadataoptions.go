@@ -0,0 +1,39 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"github.com/spf13/pflag"
+)
+
+var (
+	metadataOptionsCfgPrefix   = "metadata-options."
+	metadataOptionsCfgDefaults = map[string]interface{}{
+		metadataOptionsCfgPrefix + "http-tokens":                 "optional",
+		metadataOptionsCfgPrefix + "http-endpoint":               "enabled",
+		metadataOptionsCfgPrefix + "instance-metadata-tags":      "enabled",
+		metadataOptionsCfgPrefix + "http-put-response-hop-limit": 1,
+		metadataOptionsCfgPrefix + "extra-hop-cidrs":             []string{},
+	}
+)
+
+// BindMetadataOptionsCfg binds a flag that represents a metadata option to configuration
+func BindMetadataOptionsCfg(flag *pflag.Flag) {
+	bindFlagWithKeyPrefix(flag, metadataOptionsCfgPrefix)
+}
+
+// SetMetadataOptionsCfgDefaults sets config defaults for the instance metadata options
+func SetMetadataOptionsCfgDefaults() {
+	LoadConfigFromDefaults(metadataOptionsCfgDefaults)
+}
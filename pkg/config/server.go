@@ -20,8 +20,9 @@ import (
 var (
 	serverCfgPrefix   = "server."
 	serverCfgDefaults = map[string]interface{}{
-		serverCfgPrefix + "hostname": "0.0.0.0",
-		serverCfgPrefix + "port":     "1338",
+		serverCfgPrefix + "hostname":             "0.0.0.0",
+		serverCfgPrefix + "port":                 "1338",
+		serverCfgPrefix + "shutdown-timeout-sec": 10,
 	}
 )
 
@@ -14,6 +14,7 @@
 package config
 
 import (
+	asglifecycle "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/asglifecycle/config"
 	dynamic "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/dynamic/types"
 	events "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events/config"
 	spot "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot/config"
@@ -29,39 +30,166 @@ type Config struct {
 
 	// ----- CLI config ----- //
 	// config keys that are also cli flags
-	CfgFile                   string `mapstructure:"config-file"`
-	MockDelayInSec            int64  `mapstructure:"mock-delay-sec"`
-	MockTriggerTime           string `mapstructure:"mock-trigger-time"`
-	MockIPCount               int    `mapstructure:"mock-ip-count"`
-	SaveConfigToFile          bool   `mapstructure:"save-config-to-file"`
-	WatchConfigFile           bool   `mapstructure:"watch-config-file"`
-	Server                    Server `mapstructure:"server"`
-	Imdsv2Required            bool   `mapstructure:"imdsv2"`
-	RebalanceDelayInSec       int64  `mapstructure:"rebalance-delay-sec"`
-	RebalanceTriggerTime      string `mapstructure:"rebalance-trigger-time"`
-	ASGTerminationDelayInSec  int64  `mapstructure:"asg-termination-delay-sec"`
-	ASGTerminationTriggerTime string `mapstructure:"asg-termination-trigger-time"`
+	CfgFile                   string            `mapstructure:"config-file"`
+	MockDelayInSec            int64             `mapstructure:"mock-delay-sec"`
+	MockTriggerTime           string            `mapstructure:"mock-trigger-time"`
+	MockIPCount               int               `mapstructure:"mock-ip-count"`
+	SaveConfigToFile          bool              `mapstructure:"save-config-to-file"`
+	WatchConfigFile           bool              `mapstructure:"watch-config-file"`
+	Server                    Server            `mapstructure:"server"`
+	MetadataOptions           MetadataOptions   `mapstructure:"metadata-options"`
+	Imdsv2Required            bool              `mapstructure:"imdsv2"`
+	Imdsv2MaxTokens           int               `mapstructure:"imdsv2-max-tokens"`
+	Imdsv2SweepIntervalInSec  int64             `mapstructure:"imdsv2-token-sweep-interval-sec"`
+	RebalanceDelayInSec       int64             `mapstructure:"rebalance-delay-sec"`
+	RebalanceTriggerTime      string            `mapstructure:"rebalance-trigger-time"`
+	ASGTerminationDelayInSec  int64             `mapstructure:"asg-termination-delay-sec"`
+	ASGTerminationTriggerTime string            `mapstructure:"asg-termination-trigger-time"`
+	ClockOffsetInSec          int64             `mapstructure:"clock-offset-sec"`
+	ClockStartTime            string            `mapstructure:"clock-start-time"`
+	FreezeClock               bool              `mapstructure:"freeze-clock"`
+	AdminPort                 string            `mapstructure:"admin-port"`
+	Scenario                  string            `mapstructure:"scenario"`
+	DeriveValues              bool              `mapstructure:"derive-values"`
+	Fleet                     Fleet             `mapstructure:"fleet"`
+	Eligibility               Eligibility       `mapstructure:"eligibility"`
+	Chaos                     Chaos             `mapstructure:"chaos"`
+	AfterInterruption         AfterInterruption `mapstructure:"after-interruption"`
+	APIVersions               APIVersions       `mapstructure:"api-versions"`
+	Signing                   Signing           `mapstructure:"signing"`
+	// config keys that are not cli flags, e.g. to keep them out of the process list
+	Imdsv2TokenSecret string `mapstructure:"imdsv2-token-secret"`
+	AdminToken        string `mapstructure:"admin-token"`
 
 	// ----- static config ----- //
 
 	// config keys for subcommands
-	SpotConfig   spot.Config   `mapstructure:"spot"`
-	EventsConfig events.Config `mapstructure:"events"`
+	SpotConfig         spot.Config         `mapstructure:"spot"`
+	EventsConfig       events.Config       `mapstructure:"events"`
+	ASGLifecycleConfig asglifecycle.Config `mapstructure:"asglifecycle"`
 
 	// ----- dynamic config ----- //
 	Dynamic Dynamic `mapstructure:"dynamic"`
+
+	// ExplicitKeys are the lower-case config keys set explicitly, e.g. metadata.values.hostname, in the config file,
+	// env variables or via the admin API. Unlike the keys left to their defaults, they are never derived.
+	ExplicitKeys map[string]bool `mapstructure:"-"`
+}
+
+// MetadataOptions represents the instance metadata options controlling access to the mock
+type MetadataOptions struct {
+	HTTPTokens              string         `mapstructure:"http-tokens"`
+	HTTPEndpoint            string         `mapstructure:"http-endpoint"`
+	InstanceMetadataTags    string         `mapstructure:"instance-metadata-tags"`
+	HTTPPutResponseHopLimit int            `mapstructure:"http-put-response-hop-limit"`
+	ExtraHopCIDRs           []string       `mapstructure:"extra-hop-cidrs"`
+	PathOverrides           []PathOverride `mapstructure:"path-overrides"`
+}
+
+// Eligibility represents which clients are served spot, events and asglifecycle notices. Denied clients never are,
+// allowed clients always are, and the strategy decides for all other clients.
+type Eligibility struct {
+	Strategy string   `mapstructure:"strategy"`
+	Allow    []string `mapstructure:"allow"`
+	Deny     []string `mapstructure:"deny"`
+	// Counts limits the number of eligible clients per feature for the first strategy, instead of mock-ip-count
+	Counts          map[string]int `mapstructure:"counts"`
+	Percent         int            `mapstructure:"percent"`
+	Seed            int64          `mapstructure:"seed"`
+	Waves           int            `mapstructure:"waves"`
+	WaveIntervalSec int64          `mapstructure:"wave-interval-sec"`
+}
+
+// Chaos represents spot interruptions of random clients at random times within a window after the mock starts.
+// Actions weighs the actions of the interruptions, one of: terminate, stop, hibernate, rebalance-only.
+type Chaos struct {
+	Seed           int64          `mapstructure:"seed"`
+	Rate           float64        `mapstructure:"rate"`
+	WindowStartSec int64          `mapstructure:"window-start-sec"`
+	WindowEndSec   int64          `mapstructure:"window-end-sec"`
+	Actions        map[string]int `mapstructure:"actions"`
+}
+
+// AfterInterruption represents what the instance does once its spot itn termination time passes or it is terminated in
+// its auto scaling group. Terminated is how requests fail for good after a termination, one of: serve (default),
+// unresponsive, reset. After a stop or hibernation, requests fail with connection resets for StoppedForSec seconds.
+type AfterInterruption struct {
+	Terminated    string `mapstructure:"terminated"`
+	StoppedForSec int64  `mapstructure:"stopped-for-sec"`
+}
+
+// APIVersions represents the dated versions of the metadata API served alongside latest. Versions replaces the
+// default versions if not empty. Introduced maps paths relative to the version, e.g. meta-data/spot/instance-action, to
+// the version they were introduced in, overriding the default versions of the paths.
+type APIVersions struct {
+	Versions   []string          `mapstructure:"versions"`
+	Introduced map[string]string `mapstructure:"introduced"`
+}
+
+// Signing represents the key and certificate signing the instance identity document, both PEM encoded files. A key and
+// certificate are generated once per process if neither is set.
+type Signing struct {
+	KeyFile         string `mapstructure:"key-file"`
+	CertificateFile string `mapstructure:"certificate-file"`
+}
+
+// Fleet represents the instance identities served to different clients of the same mock
+type Fleet struct {
+	Size           int        `mapstructure:"size"`
+	IdentityHeader string     `mapstructure:"identity-header"`
+	Identities     []Identity `mapstructure:"identities"`
+}
+
+// Identity represents an instance identity served to the clients it is mapped to. Metadata values and delays that are
+// not set are derived from the top level config.
+type Identity struct {
+	Name                     string                 `mapstructure:"name"`
+	Clients                  []string               `mapstructure:"clients"`
+	Values                   map[string]interface{} `mapstructure:"values"`
+	MockDelayInSec           int64                  `mapstructure:"mock-delay-sec"`
+	RebalanceDelayInSec      int64                  `mapstructure:"rebalance-delay-sec"`
+	ASGTerminationDelayInSec int64                  `mapstructure:"asg-termination-delay-sec"`
+}
+
+// PathOverride represents metadata options applying to a path and the paths below it only
+type PathOverride struct {
+	Path         string `mapstructure:"path"`
+	HTTPTokens   string `mapstructure:"http-tokens"`
+	HTTPEndpoint string `mapstructure:"http-endpoint"`
 }
 
 // Server represents server config
 type Server struct {
-	HostName string `mapstructure:"hostname"`
-	Port     string `mapstructure:"port"`
+	HostName             string `mapstructure:"hostname"`
+	Port                 string `mapstructure:"port"`
+	ShutdownTimeoutInSec int64  `mapstructure:"shutdown-timeout-sec"`
 }
 
 // Metadata represents metadata config used by the mock (Json values in metadata-config.json)
 type Metadata struct {
 	Paths  Paths  `mapstructure:"paths"`
 	Values Values `mapstructure:"values"`
+	// Interfaces are served under network/interfaces/macs in addition to the interface of the mac values
+	Interfaces []NetworkInterface `mapstructure:"interfaces"`
+	// Tree adds paths of any name, or overrides them
+	Tree []Node `mapstructure:"tree"`
+}
+
+// Node represents a path served with the given value, e.g. /latest/meta-data/foo/bar. Type is how the value is served:
+// text (default for strings, numbers and booleans), json (default for maps and lists) or binary, given base64 encoded.
+// Paths may contain metadata values by their keys, e.g. /latest/meta-data/network/interfaces/macs/{mac}/foo.
+type Node struct {
+	Path  string      `mapstructure:"path"`
+	Type  string      `mapstructure:"type"`
+	Value interface{} `mapstructure:"value"`
+}
+
+// NetworkInterface represents a network interface attached to the instance. Attributes maps the paths under the mac,
+// e.g. device-number or ipv4-prefix, to their values: lists are served one entry per line, and maps are served as
+// the paths under the attribute, e.g. ipv4-associations/<public ip>.
+type NetworkInterface struct {
+	Mac        string                 `mapstructure:"mac"`
+	Attributes map[string]interface{} `mapstructure:"attributes"`
 }
 
 // Userdata represents userdata config used by the mock (Json values in metadata-config.json)
@@ -90,6 +218,7 @@ type Paths struct {
 	ElasticInferenceAccelerator  string `mapstructure:"elastic-inference-accelerator"`
 	ElasticInferenceAssociations string `mapstructure:"elastic-inference-associations"`
 	Events                       string `mapstructure:"events"`
+	EventsHistory                string `mapstructure:"events-history"`
 	Hostname                     string `mapstructure:"hostname"`
 	IamInformation               string `mapstructure:"iam-info"`
 	IamSecurityCredentialsRole   string `mapstructure:"iam-security-credentials-role"`
@@ -223,13 +352,16 @@ type DynamicPaths struct {
 	InstanceIdentityDocument  string `mapstructure:"instance-identity-document"`
 	InstanceIdentityPKCS      string `mapstructure:"instance-identity-pkcs"`
 	InstanceIdentitySignature string `mapstructure:"instance-identity-signature"`
+	InstanceIdentityRSA2048   string `mapstructure:"instance-identity-rsa2048"`
 	FwsInstanceMonitoring     string `mapstructure:"fws-instance-monitoring"`
 }
 
-// DynamicValues represents EC2 dynamic paths
+// DynamicValues represents EC2 dynamic paths. The signatures of the instance identity document are computed over the
+// document served unless set.
 type DynamicValues struct {
 	InstanceIdentityDocument  dynamic.InstanceIdentityDocument `mapstructure:"instance-identity-document"`
 	InstanceIdentityPKCS      string                           `mapstructure:"instance-identity-pkcs"`
 	InstanceIdentitySignature string                           `mapstructure:"instance-identity-signature"`
+	InstanceIdentityRSA2048   string                           `mapstructure:"instance-identity-rsa2048"`
 	FwsInstanceMonitoring     string                           `mapstructure:"fws-instance-monitoring"`
 }
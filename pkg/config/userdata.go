@@ -51,6 +51,17 @@ func BindUserdataCfg(flag *pflag.Flag) {
 
 // SetUserdataDefaults sets config defaults for userdata paths and values
 func SetUserdataDefaults(jsonWithDefaults []byte) {
+	udPathsDefaults, udValuesDefaults = parseUserdataDefaults(jsonWithDefaults)
+
+	LoadConfigFromDefaults(udPathsDefaults)
+	LoadConfigFromDefaults(udValuesDefaults)
+}
+
+// parseUserdataDefaults returns config keys for userdata paths and values mapped to their defaults
+func parseUserdataDefaults(jsonWithDefaults []byte) (map[string]interface{}, map[string]interface{}) {
+	pathsDefaults := map[string]interface{}{}
+	valuesDefaults := map[string]interface{}{}
+
 	// Unmarshal to map to preserve keys for Paths and Values
 	var defaultsMap map[string]interface{}
 	json.Unmarshal(jsonWithDefaults, &defaultsMap)
@@ -61,17 +72,16 @@ func SetUserdataDefaults(jsonWithDefaults []byte) {
 	for k, v := range udPaths {
 		newKey := udPathsCfgPrefix + k
 		// ex: "userdata": "/latest/user-data"
-		udPathsDefaults[newKey] = v
+		pathsDefaults[newKey] = v
 	}
 
 	for k, v := range udValues {
 		newKey := udValuesCfgPrefix + k
 		// ex: "userdata": "1234,john,reboot,true|4512,richard,|173,,,"
-		udValuesDefaults[newKey] = v
+		valuesDefaults[newKey] = v
 	}
 
-	LoadConfigFromDefaults(udPathsDefaults)
-	LoadConfigFromDefaults(udValuesDefaults)
+	return pathsDefaults, valuesDefaults
 }
 
 // GetUserdataDefaults returns config defaults for userdata paths and values
@@ -0,0 +1,172 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package access enforces the instance metadata options, i.e. whether IMDS is reachable, whether session tokens
+// are required, how many hops token responses travel and whether instance tags are served, for every request to the mock.
+package access
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/imdsv2"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+const (
+	// Optional means IMDSv1 and IMDSv2 requests are served
+	Optional = "optional"
+	// Required means only IMDSv2 requests with a valid session token are served
+	Required = "required"
+	// Enabled means the metadata option is turned on
+	Enabled = "enabled"
+	// Disabled means the metadata option is turned off
+	Disabled = "disabled"
+
+	// InstanceTagsPath is the path under which instance tags are served
+	InstanceTagsPath = "/latest/meta-data/tags/instance"
+
+	// HopCountHeader sets the number of hops a token request traveled, taking priority over the extra hop CIDRs
+	HopCountHeader = "X-Aemm-Hop-Count"
+
+	tokenPath = "/latest/api/token"
+)
+
+// rule is the effective http-tokens and http-endpoint option for a path and the paths below it
+type rule struct {
+	path           string
+	tokensRequired bool
+	disabled       bool
+}
+
+// Policy decides how a request is handled based on the metadata options in a config
+type Policy struct {
+	// rules ordered from the most to the least specific path; the last rule applies to all paths
+	rules        []rule
+	instanceTags bool
+	hopLimit     int
+	extraHopNets []*net.IPNet
+}
+
+// NewPolicy returns the policy for the metadata options in the config. The imdsv2 config key is an alias for
+// http-tokens "required". Path overrides inherit unset options from the top level options.
+func NewPolicy(config cfg.Config) *Policy {
+	opts := config.MetadataOptions
+	defaultRule := rule{
+		path:           "/",
+		tokensRequired: config.Imdsv2Required || opts.HTTPTokens == Required,
+		disabled:       opts.HTTPEndpoint == Disabled,
+	}
+
+	var rules []rule
+	for _, o := range opts.PathOverrides {
+		r := defaultRule
+		r.path = strings.TrimSuffix(o.Path, "/")
+		if o.HTTPTokens != "" {
+			r.tokensRequired = o.HTTPTokens == Required
+		}
+		if o.HTTPEndpoint != "" {
+			r.disabled = o.HTTPEndpoint == Disabled
+		}
+		rules = append(rules, r)
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return len(rules[i].path) > len(rules[j].path) })
+
+	var extraHopNets []*net.IPNet
+	for _, cidr := range opts.ExtraHopCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Printf("Ignoring invalid extra hop CIDR %s: %s", cidr, err)
+			continue
+		}
+		extraHopNets = append(extraHopNets, ipNet)
+	}
+
+	return &Policy{
+		rules:        append(rules, defaultRule),
+		instanceTags: opts.InstanceMetadataTags != Disabled,
+		hopLimit:     opts.HTTPPutResponseHopLimit,
+		extraHopNets: extraHopNets,
+	}
+}
+
+// ServesInstanceTags returns whether instance tags are served
+func (p *Policy) ServesInstanceTags() bool {
+	return p.instanceTags
+}
+
+// TokensRequired returns whether requests to the path need a valid session token
+func (p *Policy) TokensRequired(path string) bool {
+	return p.ruleFor(path).tokensRequired
+}
+
+// EndpointDisabled returns whether requests to the path are refused
+func (p *Policy) EndpointDisabled(path string) bool {
+	return p.ruleFor(path).disabled
+}
+
+// Hops returns the number of hops the response to a request travels: the HopCountHeader if set, otherwise 1, plus 1
+// if the request comes from an extra hop CIDR
+func (p *Policy) Hops(req *http.Request) int {
+	if hops, err := strconv.Atoi(req.Header.Get(HopCountHeader)); err == nil && hops > 0 {
+		return hops
+	}
+	if ip := net.ParseIP(server.ClientIP(req)); ip != nil && server.ContainsIP(p.extraHopNets, ip) {
+		return 2
+	}
+	return 1
+}
+
+// Enforce serves the request with next if the policy allows it, validating session tokens with tokens where required
+func (p *Policy) Enforce(res http.ResponseWriter, req *http.Request, tokens *imdsv2.TokenStore, next http.Handler) {
+	r := p.ruleFor(req.URL.Path)
+	switch {
+	case r.disabled:
+		log.Printf("Refusing request to %s; http-endpoint is disabled", req.URL.Path)
+		server.ReturnForbiddenResponse(res)
+	case !p.instanceTags && isBelow(req.URL.Path, InstanceTagsPath):
+		log.Printf("Not serving %s; instance-metadata-tags is disabled", req.URL.Path)
+		server.ReturnNotFoundResponse(res)
+	case req.URL.Path == tokenPath && req.Method == http.MethodPut && p.hopLimit > 0 && p.Hops(req) > p.hopLimit:
+		// IMDS sets the IP TTL of token responses to the hop limit, so they never reach clients further away, which
+		// wait for a response until they time out
+		log.Printf("Dropping token response to %s; %d hops exceed the hop limit of %d", req.RemoteAddr, p.Hops(req), p.hopLimit)
+		server.HangConnection(res)
+	case r.tokensRequired && req.URL.Path != tokenPath:
+		tokens.ValidateToken(next.ServeHTTP)(res, req)
+	default:
+		next.ServeHTTP(res, req)
+	}
+}
+
+func (p *Policy) ruleFor(path string) rule {
+	for _, r := range p.rules {
+		if isBelow(path, r.path) {
+			return r
+		}
+	}
+	return p.rules[len(p.rules)-1]
+}
+
+// isBelow returns whether path is the given parent path or one of its sub paths
+func isBelow(path string, parent string) bool {
+	if parent == "" || parent == "/" {
+		return true
+	}
+	return path == parent || strings.HasPrefix(path, parent+"/")
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package access
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/imdsv2"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+const (
+	iamPath        = "/latest/meta-data/iam/info"
+	instanceIDPath = "/latest/meta-data/instance-id"
+)
+
+var okHandler = http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+	server.FormatAndReturnTextResponse(res, "ok")
+})
+
+func TestImdsv2IsAliasForHTTPTokensRequired(t *testing.T) {
+	p := NewPolicy(cfg.Config{Imdsv2Required: true, MetadataOptions: cfg.MetadataOptions{HTTPTokens: Optional}})
+	h.Assert(t, p.TokensRequired(instanceIDPath), "Expected imdsv2 to require tokens")
+}
+
+func TestPathOverrides(t *testing.T) {
+	p := NewPolicy(cfg.Config{MetadataOptions: cfg.MetadataOptions{
+		HTTPTokens:   Required,
+		HTTPEndpoint: Enabled,
+		PathOverrides: []cfg.PathOverride{
+			{Path: "/latest/meta-data", HTTPEndpoint: Disabled},
+			{Path: "/latest/meta-data/iam/", HTTPTokens: Optional, HTTPEndpoint: Enabled},
+		},
+	}})
+	h.Assert(t, p.EndpointDisabled(instanceIDPath), "Expected override for /latest/meta-data to disable the endpoint")
+	h.Assert(t, p.TokensRequired(instanceIDPath), "Expected override for /latest/meta-data to inherit http-tokens")
+	h.Assert(t, !p.EndpointDisabled(iamPath), "Expected most specific override to enable the endpoint")
+	h.Assert(t, !p.TokensRequired(iamPath), "Expected most specific override to make tokens optional")
+	h.Assert(t, !p.EndpointDisabled("/latest/meta-data-other"), "Expected override not to apply to sibling paths")
+	h.Assert(t, !p.EndpointDisabled("/latest/dynamic"), "Expected top level options outside of overrides")
+}
+
+func TestEnforce(t *testing.T) {
+	tests := map[string]struct {
+		opts   cfg.MetadataOptions
+		path   string
+		status int
+	}{
+		"tokens optional":          {opts: cfg.MetadataOptions{HTTPTokens: Optional}, path: instanceIDPath, status: http.StatusOK},
+		"tokens required":          {opts: cfg.MetadataOptions{HTTPTokens: Required}, path: instanceIDPath, status: http.StatusUnauthorized},
+		"token path not protected": {opts: cfg.MetadataOptions{HTTPTokens: Required}, path: tokenPath, status: http.StatusOK},
+		"endpoint disabled":        {opts: cfg.MetadataOptions{HTTPEndpoint: Disabled}, path: tokenPath, status: http.StatusForbidden},
+		"tags disabled":            {opts: cfg.MetadataOptions{InstanceMetadataTags: Disabled}, path: InstanceTagsPath + "/Name", status: http.StatusNotFound},
+		"tags enabled":             {opts: cfg.MetadataOptions{InstanceMetadataTags: Enabled}, path: InstanceTagsPath + "/Name", status: http.StatusOK},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := NewPolicy(cfg.Config{MetadataOptions: test.opts})
+			w := httptest.NewRecorder()
+			p.Enforce(w, httptest.NewRequest(http.MethodGet, test.path, nil), imdsv2.NewTokenStore(0, "", clock.New()), okHandler)
+			h.Assert(t, w.Code == test.status, fmt.Sprintf("Expected %d, but was %d", test.status, w.Code))
+		})
+	}
+}
+
+func TestHops(t *testing.T) {
+	p := NewPolicy(cfg.Config{MetadataOptions: cfg.MetadataOptions{HTTPPutResponseHopLimit: 1, ExtraHopCIDRs: []string{"172.17.0.0/16", "fd00::/8"}}})
+	tests := map[string]struct {
+		remoteAddr string
+		hopCount   string
+		hops       int
+	}{
+		"host":             {remoteAddr: "10.0.0.1:1234", hops: 1},
+		"container":        {remoteAddr: "172.17.0.2:1234", hops: 2},
+		"ipv6 container":   {remoteAddr: "[fd00::2]:1234", hops: 2},
+		"hop count header": {remoteAddr: "10.0.0.1:1234", hopCount: "3", hops: 3},
+		"invalid header":   {remoteAddr: "172.17.0.2:1234", hopCount: "x", hops: 2},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tokenPath, nil)
+			req.RemoteAddr = test.remoteAddr
+			if test.hopCount != "" {
+				req.Header.Set(HopCountHeader, test.hopCount)
+			}
+			hops := p.Hops(req)
+			h.Assert(t, hops == test.hops, fmt.Sprintf("Expected %d hops, but was %d", test.hops, hops))
+		})
+	}
+}
+
+func TestEnforceLeavesTokenRequestsBeyondHopLimitUnanswered(t *testing.T) {
+	p := NewPolicy(cfg.Config{MetadataOptions: cfg.MetadataOptions{HTTPPutResponseHopLimit: 1}})
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		p.Enforce(res, req, imdsv2.NewTokenStore(0, "", clock.New()), okHandler)
+	}))
+	defer srv.Close()
+	requestToken := func(hops string) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodPut, srv.URL+tokenPath, nil)
+		h.Ok(t, err)
+		req.Header.Set(HopCountHeader, hops)
+		return (&http.Client{Timeout: 500 * time.Millisecond}).Do(req)
+	}
+
+	resp, err := requestToken("1")
+	h.Ok(t, err)
+	resp.Body.Close()
+	h.Assert(t, resp.StatusCode == http.StatusOK, fmt.Sprintf("Expected 200 OK within the hop limit, but was %d", resp.StatusCode))
+
+	resp, err = requestToken("2")
+	if err == nil {
+		resp.Body.Close()
+	}
+	var netErr net.Error
+	h.Assert(t, errors.As(err, &netErr) && netErr.Timeout(), fmt.Sprintf("Expected the token request to time out beyond the hop limit, but was %v", err))
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package admin serves the endpoints controlling a running mock. They are not part of IMDS, so they are not subject
+// to the instance metadata options.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+const (
+	// PathPrefix is the prefix of all admin paths
+	PathPrefix = "/aemm"
+	// ClockPath tells and changes the mock time
+	ClockPath = PathPrefix + "/clock"
+)
+
+// Authorized reports whether the request carries the given bearer token and returns 401 Unauthorized if it does not.
+// Every request is authorized when token is empty.
+func Authorized(res http.ResponseWriter, req *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	given, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+		return true
+	}
+	log.Printf("Rejected unauthorized admin request: %s %s", req.Method, req.URL.Path)
+	res.Header().Set("WWW-Authenticate", "Bearer")
+	server.ReturnUnauthorizedResponse(res)
+	return false
+}
+
+// clockRequest changes the mock time. Fields are applied in order: time, advance-sec, frozen.
+type clockRequest struct {
+	Time       string `json:"time"`
+	AdvanceSec int64  `json:"advance-sec"`
+	Frozen     *bool  `json:"frozen"`
+}
+
+// ClockHandler returns the mock time on GET and changes it on PUT
+func ClockHandler(clk *clock.Clock) server.HandlerType {
+	return func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var cr clockRequest
+			if err := json.NewDecoder(req.Body).Decode(&cr); err != nil {
+				log.Printf("Failed to decode clock request: %s", err)
+				server.ReturnBadRequestResponse(res)
+				return
+			}
+			var t time.Time
+			if cr.Time != "" {
+				var err error
+				if t, err = time.Parse(time.RFC3339, cr.Time); err != nil {
+					log.Printf("Invalid time in clock request: %s", err)
+					server.ReturnBadRequestResponse(res)
+					return
+				}
+			}
+
+			if cr.Time != "" {
+				clk.Set(t)
+			}
+			clk.Advance(time.Duration(cr.AdvanceSec) * time.Second)
+			if cr.Frozen != nil {
+				if *cr.Frozen {
+					clk.Freeze()
+				} else {
+					clk.Unfreeze()
+				}
+			}
+			log.Printf("Mock time changed to %s", clk.Now().Format(time.RFC3339))
+		default:
+			server.ReturnMethodNotAllowedResponse(res, http.MethodGet, http.MethodPut)
+			return
+		}
+		server.FormatAndReturnJSONResponse(res, clk.State())
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+func TestClockHandlerAdvancesAndFreezesClock(t *testing.T) {
+	clk := clock.New()
+	before := clk.Now()
+
+	rr := httptest.NewRecorder()
+	ClockHandler(clk)(rr, httptest.NewRequest(http.MethodPut, ClockPath, strings.NewReader(`{"advance-sec": 120, "frozen": true}`)))
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK from the clock endpoint, but was %d", rr.Code))
+	h.Assert(t, clk.State().Frozen, "Expected the clock to be frozen")
+	h.Assert(t, clk.Now().Sub(before) >= 2*time.Minute, fmt.Sprintf("Expected the clock to be 2 minutes ahead, but was %s", clk.Now().Sub(before)))
+
+	rr = httptest.NewRecorder()
+	ClockHandler(clk)(rr, httptest.NewRequest(http.MethodPut, ClockPath, strings.NewReader(`{"time": "yesterday"}`)))
+	h.Assert(t, rr.Code == http.StatusBadRequest, fmt.Sprintf("Expected 400 Bad Request for an invalid time, but was %d", rr.Code))
+}
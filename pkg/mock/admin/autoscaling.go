@@ -0,0 +1,135 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/asglifecycle"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+const (
+	// AutoScalingPath serves the lifecycle actions of the Auto Scaling query API, so lifecycle hook agents can use it as
+	// their auto scaling endpoint, e.g. aws autoscaling --endpoint-url http://localhost:1338/aemm/autoscaling
+	AutoScalingPath = PathPrefix + "/autoscaling"
+
+	autoScalingNamespace = "http://autoscaling.amazonaws.com/doc/2011-01-01/"
+)
+
+// autoScalingResponse is the response of a successful auto scaling action, e.g. CompleteLifecycleActionResponse
+type autoScalingResponse struct {
+	XMLName   xml.Name
+	Namespace string `xml:"xmlns,attr"`
+	Result    struct {
+		XMLName xml.Name
+	}
+	RequestID string `xml:"ResponseMetadata>RequestId"`
+}
+
+// autoScalingErrorResponse is the response of a failed auto scaling action
+type autoScalingErrorResponse struct {
+	XMLName   xml.Name `xml:"ErrorResponse"`
+	Namespace string   `xml:"xmlns,attr"`
+	Type      string   `xml:"Error>Type"`
+	Code      string   `xml:"Error>Code"`
+	Message   string   `xml:"Error>Message"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// SignedAutoScalingAction reports whether req is an action of the Auto Scaling query API signed with AWS Signature
+// Version 4, the way the AWS CLI and SDKs send them. Such requests cannot carry the bearer token of the admin API. The
+// signature is not verified, as the mock does not know the credentials of its clients.
+func SignedAutoScalingAction(req *http.Request) bool {
+	if req.URL.Path != AutoScalingPath || (req.Method == http.MethodGet && req.URL.Query().Get("Action") == "") {
+		return false
+	}
+	auth, ok := strings.CutPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	if !ok || (req.Header.Get("X-Amz-Date") == "" && req.Header.Get("Date") == "") {
+		return false
+	}
+	for _, field := range []string{"Credential=", "SignedHeaders=", "Signature="} {
+		if !strings.Contains(auth, field) {
+			return false
+		}
+	}
+	return true
+}
+
+// AutoScalingHandler returns the lifecycle of the instance on GET and serves the CompleteLifecycleAction and
+// RecordLifecycleActionHeartbeat actions of the Auto Scaling query API on POST
+func AutoScalingHandler(m *asglifecycle.Mock) server.HandlerType {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet && req.URL.Query().Get("Action") == "" {
+			returnJSON(res, http.StatusOK, m.Status())
+			return
+		}
+		if err := req.ParseForm(); err != nil {
+			returnAutoScalingError(res, "MalformedQueryString", err.Error())
+			return
+		}
+
+		action := req.Form.Get("Action")
+		var err error
+		switch action {
+		case "CompleteLifecycleAction":
+			err = m.CompleteLifecycleAction(req.Form.Get("LifecycleHookName"), req.Form.Get("LifecycleActionToken"), req.Form.Get("InstanceId"), req.Form.Get("LifecycleActionResult"))
+		case "RecordLifecycleActionHeartbeat":
+			err = m.RecordLifecycleActionHeartbeat(req.Form.Get("LifecycleHookName"), req.Form.Get("LifecycleActionToken"), req.Form.Get("InstanceId"))
+		default:
+			returnAutoScalingError(res, "InvalidAction", fmt.Sprintf("Could not find operation %s for version 2011-01-01", action))
+			return
+		}
+		if err != nil {
+			log.Printf("Rejected %s: %s", action, err)
+			returnAutoScalingError(res, "ValidationError", err.Error())
+			return
+		}
+
+		resp := autoScalingResponse{XMLName: xml.Name{Local: action + "Response"}, Namespace: autoScalingNamespace, RequestID: newRequestID()}
+		resp.Result.XMLName = xml.Name{Local: action + "Result"}
+		returnXML(res, http.StatusOK, resp)
+	}
+}
+
+// returnAutoScalingError returns an error of the Auto Scaling query API caused by the request
+func returnAutoScalingError(res http.ResponseWriter, code string, message string) {
+	returnXML(res, http.StatusBadRequest, autoScalingErrorResponse{
+		Namespace: autoScalingNamespace,
+		Type:      "Sender",
+		Code:      code,
+		Message:   message,
+		RequestID: newRequestID(),
+	})
+}
+
+func returnXML(res http.ResponseWriter, statusCode int, data interface{}) {
+	res.Header().Set("Content-Type", "text/xml")
+	res.WriteHeader(statusCode)
+	if err := xml.NewEncoder(res).Encode(data); err != nil {
+		log.Printf("Failed to encode auto scaling response: %s", err)
+	}
+}
+
+// newRequestID returns a random request id formatted like a UUID
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
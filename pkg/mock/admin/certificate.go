@@ -0,0 +1,45 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+// CertificatePath returns the certificate verifying the signatures of the instance identity document
+const CertificatePath = PathPrefix + "/certificate"
+
+// Signer is a mock signing the instance identity document
+type Signer interface {
+	// Certificate returns the PEM encoded certificate verifying the signatures
+	Certificate() []byte
+}
+
+// CertificateHandler returns the PEM encoded certificate of the signer on GET
+func CertificateHandler(s Signer) server.HandlerType {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			server.ReturnMethodNotAllowedResponse(res, http.MethodGet)
+			return
+		}
+		cert := s.Certificate()
+		if cert == nil {
+			server.ReturnNotFoundResponse(res)
+			return
+		}
+		server.FormatAndReturnTextResponse(res, string(cert))
+	}
+}
@@ -11,23 +11,25 @@
 // express or implied. See the License for the specific language governing
 // permissions and limitations under the License.
 
-package root
+package admin
 
 import (
-	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
-	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/asglifecycle"
-	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events"
-	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot"
+	"net/http"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/chaos"
 	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
 )
 
-// Mock serves all subcommand handlers
-func Mock(config cfg.Config) {
-
-	// set configs for subcommands
-	spot.SetConfig(config)
-	events.SetConfig(config)
-	asglifecycle.SetConfig(config)
+// ChaosPath shows the seed of chaos mode and which clients it interrupts
+const ChaosPath = PathPrefix + "/chaos"
 
-	server.ListenAndServe(config.Server.HostName, config.Server.Port)
+// ChaosHandler returns the seed and the decisions of chaos mode on GET
+func ChaosHandler(p *chaos.Planner) server.HandlerType {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			server.ReturnMethodNotAllowedResponse(res, http.MethodGet)
+			return
+		}
+		returnJSON(res, http.StatusOK, p.State())
+	}
 }
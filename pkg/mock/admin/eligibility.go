@@ -0,0 +1,39 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/eligibility"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+// EligibilityPath shows which clients are served the spot, events and asglifecycle notices
+const EligibilityPath = PathPrefix + "/eligibility"
+
+// EligibilityHandler returns the clients of each feature and whether they are eligible on GET
+func EligibilityHandler(trackers ...*eligibility.Tracker) server.HandlerType {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			server.ReturnMethodNotAllowedResponse(res, http.MethodGet)
+			return
+		}
+		states := make([]eligibility.State, 0, len(trackers))
+		for _, t := range trackers {
+			states = append(states, t.State())
+		}
+		returnJSON(res, http.StatusOK, states)
+	}
+}
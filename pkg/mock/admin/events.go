@@ -0,0 +1,143 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events"
+	eventscfg "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// EventsPath lists and adds scheduled events
+	EventsPath = PathPrefix + "/events"
+	// EventPath reads, reschedules and cancels a scheduled event by its id
+	EventPath = EventsPath + "/{event-id}"
+)
+
+// EventsHandler adds and changes the scheduled events served by the mock, which are served right away:
+//
+//	GET    EventsPath  returns all events, including completed and canceled events
+//	POST   EventsPath  adds an event; its id, state and not-before default to a random id, active and the mock time
+//	GET    EventPath   returns the event
+//	PATCH  EventPath   merges a JSON object into the event, e.g. to change its window or mark it completed
+//	DELETE EventPath   cancels the event, which moves it into the maintenance history
+//
+// Added events are returned with 201 Created. Invalid events are rejected with 400 Bad Request, listing the reasons.
+func EventsHandler(m *events.Mock, clk *clock.Clock) server.HandlerType {
+	return func(res http.ResponseWriter, req *http.Request) {
+		id, ok := mux.Vars(req)["event-id"]
+		if !ok {
+			handleEvents(res, req, m, clk)
+			return
+		}
+
+		var event eventscfg.Event
+		switch req.Method {
+		case http.MethodGet:
+			scheduled := m.Events()
+			i := slices.IndexFunc(scheduled, func(e eventscfg.Event) bool { return e.EventID == id })
+			if i < 0 {
+				server.ReturnNotFoundResponse(res)
+				return
+			}
+			event = scheduled[i]
+		case http.MethodPatch, http.MethodDelete:
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				log.Printf("Failed to read event request: %s", err)
+				server.ReturnBadRequestResponse(res)
+				return
+			}
+			err = m.Update(func(scheduled []eventscfg.Event) ([]eventscfg.Event, error) {
+				i := slices.IndexFunc(scheduled, func(e eventscfg.Event) bool { return e.EventID == id })
+				if i < 0 {
+					return nil, fmt.Errorf("%w %s", errUnknownKey, id)
+				}
+				if req.Method == http.MethodDelete {
+					scheduled[i].EventState = events.Canceled
+				} else if err := decodeEvent(&scheduled[i], body); err != nil {
+					return nil, err
+				}
+				event = scheduled[i]
+				return scheduled, nil
+			})
+			if errors.Is(err, errUnknownKey) {
+				server.ReturnNotFoundResponse(res)
+				return
+			}
+			if err != nil {
+				log.Printf("Rejected change of event %s: %s", id, err)
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("Changed event %s via %s %s", id, req.Method, req.URL.Path)
+		default:
+			server.ReturnMethodNotAllowedResponse(res, http.MethodGet, http.MethodPatch, http.MethodDelete)
+			return
+		}
+		returnJSON(res, http.StatusOK, event)
+	}
+}
+
+// handleEvents lists and adds scheduled events
+func handleEvents(res http.ResponseWriter, req *http.Request, m *events.Mock, clk *clock.Clock) {
+	switch req.Method {
+	case http.MethodGet:
+		returnJSON(res, http.StatusOK, m.Events())
+	case http.MethodPost:
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			log.Printf("Failed to read event request: %s", err)
+			server.ReturnBadRequestResponse(res)
+			return
+		}
+		var event eventscfg.Event
+		err = m.Update(func(scheduled []eventscfg.Event) ([]eventscfg.Event, error) {
+			if err := decodeEvent(&event, body); err != nil {
+				return nil, err
+			}
+			event = events.WithDefaults(event, clk.Now())
+			return append(scheduled, event), nil
+		})
+		if err != nil {
+			log.Printf("Rejected new event: %s", err)
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Added event %s via %s %s", event.EventID, req.Method, req.URL.Path)
+		returnJSON(res, http.StatusCreated, event)
+	default:
+		server.ReturnMethodNotAllowedResponse(res, http.MethodGet, http.MethodPost)
+	}
+}
+
+// decodeEvent merges a JSON object into event, rejecting unknown fields
+func decodeEvent(event *eventscfg.Event, raw []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(event)
+}
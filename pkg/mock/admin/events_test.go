@@ -0,0 +1,89 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+
+	"github.com/gorilla/mux"
+)
+
+func doEventsRequest(handler server.HandlerType, method string, id string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, EventsPath, strings.NewReader(body))
+	if id != "" {
+		req = mux.SetURLVars(httptest.NewRequest(method, EventsPath+"/"+id, strings.NewReader(body)), map[string]string{"event-id": id})
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestEventsHandlerChangesServedEvents(t *testing.T) {
+	c, err := cfg.NewDefaultConfig()
+	h.Ok(t, err)
+	c.MockDelayInSec = 3600
+	c.MockIPCount = 1
+	clk := clock.New()
+	m := events.New(c, clk)
+	handler := EventsHandler(m, clk)
+	get := func(path string) string {
+		rr := httptest.NewRecorder()
+		m.Handler(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Body.String()
+	}
+
+	rr := doEventsRequest(handler, http.MethodPost, "", `{"code": "system-reboot", "event-id": "instance-event-1"}`)
+	h.Assert(t, rr.Code == http.StatusCreated, fmt.Sprintf("Expected 201 Created from the events endpoint, but was %d", rr.Code))
+	body := get(c.Metadata.Paths.Events)
+	h.Assert(t, strings.Contains(body, `"EventId": "instance-event-1"`), fmt.Sprintf("Expected the added event before the delay, but was %s", body))
+
+	rr = doEventsRequest(handler, http.MethodPatch, "instance-event-1", `{"state": "completed"}`)
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK from the event endpoint, but was %d", rr.Code))
+	body = get(c.Metadata.Paths.Events)
+	h.Assert(t, !strings.Contains(body, "instance-event-1"), fmt.Sprintf("Expected no completed event to be scheduled, but was %s", body))
+	body = get(c.Metadata.Paths.EventsHistory)
+	h.Assert(t, strings.Contains(body, "[Completed] "), fmt.Sprintf("Expected the completed event in the history, but was %s", body))
+
+	rr = doEventsRequest(handler, http.MethodDelete, "instance-event-2", "")
+	h.Assert(t, rr.Code == http.StatusNotFound, fmt.Sprintf("Expected 404 Not Found for an unknown event, but was %d", rr.Code))
+}
+
+func TestEventsHandlerPostReturnsCreatedOrReasons(t *testing.T) {
+	clk := clock.New()
+	handler := EventsHandler(events.New(cfg.Config{}, clk), clk)
+	post := func(body string) *httptest.ResponseRecorder {
+		return doEventsRequest(handler, http.MethodPost, "", body)
+	}
+
+	rr := post(`{"code": "system-reboot", "event-id": "instance-event-1"}`)
+	h.Assert(t, rr.Code == http.StatusCreated, fmt.Sprintf("Expected 201 Created for an added event, but was %d", rr.Code))
+	h.Assert(t, strings.Contains(rr.Body.String(), `"instance-event-1"`), fmt.Sprintf("Expected the added event, but was %s", rr.Body.String()))
+
+	rr = post(`{"code": "instance-launch", "state": "pending", "event-id": "instance-event-1"}`)
+	h.Assert(t, rr.Code == http.StatusBadRequest, fmt.Sprintf("Expected 400 Bad Request for an invalid event, but was %d", rr.Code))
+	reasons := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	h.Assert(t, len(reasons) == 3, fmt.Sprintf("Expected a line for each of the code, state and duplicate event id, but was %q", reasons))
+	h.Assert(t, strings.Contains(reasons[0], "scheduled[1].code") && strings.Contains(reasons[2], "scheduled[1].event-id"),
+		fmt.Sprintf("Expected the invalid keys, but was %q", reasons))
+}
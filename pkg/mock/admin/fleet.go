@@ -0,0 +1,42 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/fleet"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+// FleetPath lists the instance identities served in fleet mode
+const FleetPath = PathPrefix + "/fleet"
+
+// Fleet is a mock serving different instance identities to different clients
+type Fleet interface {
+	// Members returns the identities served to the clients mapped to them
+	Members() []fleet.Member
+}
+
+// FleetHandler returns the identities of the fleet on GET. Other admin endpoints change an identity when requests
+// to them carry the identity header naming it.
+func FleetHandler(f Fleet) server.HandlerType {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			server.ReturnMethodNotAllowedResponse(res, http.MethodGet)
+			return
+		}
+		returnJSON(res, http.StatusOK, f.Members())
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/tree"
+)
+
+const (
+	// treeKeyPrefix addresses the nodes of metadata.tree by their path, e.g. tree/latest/meta-data/foo/bar
+	treeKeyPrefix = "tree/"
+	// macsKeyPrefix addresses the network interfaces of metadata.interfaces by their mac, and their attributes by their
+	// names under it, e.g. macs/0e:49:61:0f:c3:11/ipv4-associations/203.0.113.25
+	macsKeyPrefix = "macs/"
+)
+
+// isPathKey returns whether key addresses a node of the metadata tree or a network interface rather than a value
+func isPathKey(section string, key string) bool {
+	return section == "metadata" && (strings.HasPrefix(key, treeKeyPrefix) || strings.HasPrefix(key, macsKeyPrefix))
+}
+
+// pathValue returns the value of the node or network interface attribute addressed by key
+func pathValue(c cfg.Config, key string) (interface{}, bool) {
+	if path, ok := strings.CutPrefix(key, treeKeyPrefix); ok {
+		// later nodes override earlier ones with the same path
+		i := lastNode(c.Metadata.Tree, "/"+path)
+		if i < 0 {
+			return nil, false
+		}
+		return c.Metadata.Tree[i].Value, true
+	}
+
+	mac, names := splitMacsKey(key)
+	i := interfaceIndex(c.Metadata.Interfaces, mac)
+	if i < 0 {
+		return nil, false
+	}
+	var value interface{} = c.Metadata.Interfaces[i].Attributes
+	if len(names) == 0 && value == nil {
+		return map[string]interface{}{}, true
+	}
+	for _, name := range names {
+		attributes, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = attributes[attributeKey(attributes, name)]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// updatePath applies the change requested with method and body to the node or network interface attribute addressed
+// by key in c. Nodes and attributes are added by PUT, and network interfaces by PUT or PATCH.
+func updatePath(c *cfg.Config, key string, method string, body []byte) error {
+	if path, ok := strings.CutPrefix(key, treeKeyPrefix); ok {
+		nodes, err := updateNode(c.Metadata.Tree, "/"+path, method, body)
+		if err != nil {
+			return err
+		}
+		if errStrings := tree.ValidateTree("metadata.tree", nodes); len(errStrings) > 0 {
+			return errors.New(strings.Join(errStrings, "; "))
+		}
+		c.Metadata.Tree = nodes
+		return nil
+	}
+
+	interfaces, err := updateInterface(c.Metadata.Interfaces, key, method, body)
+	if err != nil {
+		return err
+	}
+	if errStrings := tree.ValidateInterfaces("metadata.interfaces", interfaces); len(errStrings) > 0 {
+		return errors.New(strings.Join(errStrings, "; "))
+	}
+	c.Metadata.Interfaces = interfaces
+	return nil
+}
+
+// updateNode returns a copy of nodes with the change applied to the node with the given path
+func updateNode(nodes []cfg.Node, path string, method string, body []byte) ([]cfg.Node, error) {
+	// copy the nodes, so the config currently served does not share them with the new one
+	nodes = slices.Clone(nodes)
+	i := lastNode(nodes, path)
+	if i < 0 && method != http.MethodPut {
+		return nil, fmt.Errorf("%w %s", errUnknownKey, treeKeyPrefix+strings.TrimPrefix(path, "/"))
+	}
+
+	switch method {
+	case http.MethodDelete:
+		return slices.DeleteFunc(nodes, func(n cfg.Node) bool { return n.Path == path }), nil
+	case http.MethodPut:
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", path, err)
+		}
+		if i < 0 {
+			return append(nodes, cfg.Node{Path: path, Value: value}), nil
+		}
+		nodes[i].Value = value
+	case http.MethodPatch:
+		value, err := mergeObject(nodes[i].Value, body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", path, err)
+		}
+		nodes[i].Value = value
+	}
+	return nodes, nil
+}
+
+// updateInterface returns a copy of interfaces with the change applied to the network interface or attribute
+// addressed by key
+func updateInterface(interfaces []cfg.NetworkInterface, key string, method string, body []byte) ([]cfg.NetworkInterface, error) {
+	mac, names := splitMacsKey(key)
+	// copy the interfaces and the attributes changed, so the config currently served does not share them with the new one
+	interfaces = slices.Clone(interfaces)
+	i := interfaceIndex(interfaces, mac)
+	if i < 0 {
+		if method == http.MethodDelete || (method == http.MethodPatch && len(names) > 0) {
+			return nil, fmt.Errorf("%w %s", errUnknownKey, key)
+		}
+		interfaces = append(interfaces, cfg.NetworkInterface{Mac: mac})
+		i = len(interfaces) - 1
+	}
+	attributes := cloneAttributes(interfaces[i].Attributes)
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+
+	if len(names) == 0 {
+		switch method {
+		case http.MethodDelete:
+			return slices.Delete(interfaces, i, i+1), nil
+		case http.MethodPut:
+			replaced := map[string]interface{}{}
+			if err := json.Unmarshal(body, &replaced); err != nil {
+				return nil, fmt.Errorf("invalid attributes for %s: %w", mac, err)
+			}
+			attributes = replaced
+		case http.MethodPatch:
+			merged, err := mergeObject(attributes, body)
+			if err != nil {
+				return nil, fmt.Errorf("invalid attributes for %s: %w", mac, err)
+			}
+			attributes = merged
+		}
+		interfaces[i].Attributes = attributes
+		return interfaces, nil
+	}
+
+	parent := attributes
+	for _, name := range names[:len(names)-1] {
+		child, ok := parent[attributeKey(parent, name)].(map[string]interface{})
+		if !ok {
+			if method != http.MethodPut {
+				return nil, fmt.Errorf("%w %s", errUnknownKey, key)
+			}
+			child = map[string]interface{}{}
+		}
+		parent[attributeKey(parent, name)] = child
+		parent = child
+	}
+	name := attributeKey(parent, names[len(names)-1])
+	current, ok := parent[name]
+	if !ok && method != http.MethodPut {
+		return nil, fmt.Errorf("%w %s", errUnknownKey, key)
+	}
+
+	switch method {
+	case http.MethodDelete:
+		delete(parent, name)
+	case http.MethodPut:
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+		parent[name] = value
+	case http.MethodPatch:
+		value, err := mergeObject(current, body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+		parent[name] = value
+	}
+	interfaces[i].Attributes = attributes
+	return interfaces, nil
+}
+
+// lastNode returns the index of the last node with the given path, or -1
+func lastNode(nodes []cfg.Node, path string) int {
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if nodes[i].Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// interfaceIndex returns the index of the network interface with the given mac, or -1
+func interfaceIndex(interfaces []cfg.NetworkInterface, mac string) int {
+	return slices.IndexFunc(interfaces, func(ni cfg.NetworkInterface) bool { return strings.EqualFold(ni.Mac, mac) })
+}
+
+// splitMacsKey returns the mac and the attribute names addressed by a key starting with macsKeyPrefix
+func splitMacsKey(key string) (string, []string) {
+	elems := strings.Split(strings.Trim(strings.TrimPrefix(key, macsKeyPrefix), "/"), "/")
+	return elems[0], elems[1:]
+}
+
+// attributeKey returns the key of the attribute with the given name, which the config may write with slashes, e.g.
+// ipv4-associations/
+func attributeKey(attributes map[string]interface{}, name string) string {
+	if _, ok := attributes[name]; ok {
+		return name
+	}
+	for key := range attributes {
+		if strings.Trim(key, "/") == name {
+			return key
+		}
+	}
+	return name
+}
+
+// cloneAttributes returns a copy of attributes, including the maps of attributes under them
+func cloneAttributes(attributes map[string]interface{}) map[string]interface{} {
+	if attributes == nil {
+		return nil
+	}
+	cloned := maps.Clone(attributes)
+	for name, value := range cloned {
+		if m, ok := value.(map[string]interface{}); ok {
+			cloned[name] = cloneAttributes(m)
+		}
+	}
+	return cloned
+}
+
+// mergeObject returns a copy of current with the fields of the JSON object in body set
+func mergeObject(current interface{}, body []byte) (map[string]interface{}, error) {
+	object, ok := current.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("only objects can be merged")
+	}
+	var patch map[string]interface{}
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, err
+	}
+	merged := maps.Clone(object)
+	if merged == nil {
+		merged = map[string]interface{}{}
+	}
+	maps.Copy(merged, patch)
+	return merged, nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/scenario"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+// ScenarioPath reports the steps of the scenario and whether they have run
+const ScenarioPath = PathPrefix + "/scenario"
+
+// ScenarioHandler runs the steps of the scenario due at the current mock time and returns all steps on GET
+func ScenarioHandler(s *scenario.Scheduler) server.HandlerType {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			server.ReturnMethodNotAllowedResponse(res, http.MethodGet)
+			return
+		}
+		s.RunDue()
+		returnJSON(res, http.StatusOK, s.Results())
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+
+	"github.com/gorilla/mux"
+)
+
+// SpotPath schedules and cancels a spot notice, one of: itn, rebalance
+const SpotPath = PathPrefix + "/spot/{notice}"
+
+// spotRequest schedules a spot notice. The notice is served immediately, unless time or delay-sec is given;
+// time takes priority over delay-sec.
+type spotRequest struct {
+	Time     string `json:"time"`
+	DelaySec int64  `json:"delay-sec"`
+	Action   string `json:"action"`
+}
+
+// SpotHandler returns the schedule of a spot notice on GET, triggers or reschedules it on PUT and cancels it on DELETE
+func SpotHandler(m *spot.Mock, clk *clock.Clock) server.HandlerType {
+	return func(res http.ResponseWriter, req *http.Request) {
+		n := spot.Notice(mux.Vars(req)["notice"])
+		if n != spot.ITN && n != spot.Rebalance {
+			server.ReturnNotFoundResponse(res)
+			return
+		}
+
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var sr spotRequest
+			if err := json.NewDecoder(req.Body).Decode(&sr); err != nil {
+				log.Printf("Failed to decode %s request: %s", n, err)
+				server.ReturnBadRequestResponse(res)
+				return
+			}
+			triggerTime := clk.Now().Add(time.Duration(sr.DelaySec) * time.Second)
+			if sr.Time != "" {
+				var err error
+				if triggerTime, err = time.Parse(time.RFC3339, sr.Time); err != nil {
+					log.Printf("Invalid time in %s request: %s", n, err)
+					server.ReturnBadRequestResponse(res)
+					return
+				}
+			}
+			if sr.Action != "" && (n != spot.ITN || !slices.Contains(spot.InstanceActions, sr.Action)) {
+				log.Printf("Invalid action in %s request: %s, expected one of %s", n, sr.Action, strings.Join(spot.InstanceActions, ","))
+				server.ReturnBadRequestResponse(res)
+				return
+			}
+			m.Trigger(n, triggerTime, sr.Action)
+		case http.MethodDelete:
+			m.Cancel(n)
+		default:
+			server.ReturnMethodNotAllowedResponse(res, http.MethodGet, http.MethodPut, http.MethodDelete)
+			return
+		}
+		returnJSON(res, http.StatusOK, m.Schedule(n))
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	spotITNPath   = "/latest/meta-data/spot/instance-action"
+	rebalancePath = "/latest/meta-data/events/recommendations/rebalance"
+)
+
+func TestSpotHandlerTriggersAndCancelsNotices(t *testing.T) {
+	c, err := cfg.NewDefaultConfig()
+	h.Ok(t, err)
+	c.MockDelayInSec = 3600
+	c.RebalanceDelayInSec = 3600
+	c.MockIPCount = 1
+	c.SpotConfig.InstanceAction = spot.Terminate
+	clk := clock.New()
+	m := spot.New(c, clk)
+	change := func(method string, notice spot.Notice, body string) int {
+		req := mux.SetURLVars(httptest.NewRequest(method, PathPrefix+"/spot/"+string(notice), strings.NewReader(body)), map[string]string{"notice": string(notice)})
+		rr := httptest.NewRecorder()
+		SpotHandler(m, clk)(rr, req)
+		return rr.Code
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		m.Handler(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	h.Assert(t, get(spotITNPath).Code == http.StatusNotFound, "Expected no spot itn before the delay")
+	h.Assert(t, change(http.MethodPut, spot.ITN, `{"action": "stop"}`) == http.StatusOK, "Expected the spot itn to be triggered")
+	rr := get(spotITNPath)
+	h.Assert(t, rr.Code == http.StatusOK && strings.Contains(rr.Body.String(), `"action": "stop"`), fmt.Sprintf("Expected the triggered action, but was %d %s", rr.Code, rr.Body.String()))
+	h.Assert(t, change(http.MethodDelete, spot.ITN, "") == http.StatusOK, "Expected the spot itn to be canceled")
+	h.Assert(t, get(spotITNPath).Code == http.StatusNotFound, "Expected no canceled spot itn")
+
+	h.Assert(t, change(http.MethodPut, spot.Rebalance, `{"delay-sec": 60}`) == http.StatusOK, "Expected the rebalance recommendation to be rescheduled")
+	h.Assert(t, get(rebalancePath).Code == http.StatusNotFound, "Expected no rebalance recommendation before the rescheduled time")
+	clk.Advance(time.Minute)
+	h.Assert(t, get(rebalancePath).Code == http.StatusOK, "Expected the rebalance recommendation after the rescheduled time")
+
+	code := change(http.MethodPut, spot.Rebalance, `{"action": "stop"}`)
+	h.Assert(t, code == http.StatusBadRequest, fmt.Sprintf("Expected 400 Bad Request for a rebalance recommendation with an action, but was %d", code))
+}
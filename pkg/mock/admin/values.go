@@ -0,0 +1,264 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"reflect"
+	"strings"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// ValuesPath lists and changes the values of a section, one of: metadata, dynamic, userdata
+	ValuesPath = PathPrefix + "/values/{section}"
+	// ValuePath reads and changes a single value of a section by its config key, e.g. /aemm/values/metadata/instance-type,
+	// or a node of the metadata tree or a network interface attribute by its path, e.g.
+	// /aemm/values/metadata/tree/latest/meta-data/foo/bar or /aemm/values/metadata/macs/0e:49:61:0f:c3:11/device-number
+	ValuePath = ValuesPath + "/{key:.+}"
+)
+
+// errUnknownKey is returned when a value is changed by a key that does not exist in its section
+var errUnknownKey = errors.New("unknown key")
+
+// sections maps the sections of the values API to the values they change
+var sections = map[string]func(c *cfg.Config) interface{}{
+	"metadata": func(c *cfg.Config) interface{} { return &c.Metadata.Values },
+	"dynamic":  func(c *cfg.Config) interface{} { return &c.Dynamic.Values },
+	"userdata": func(c *cfg.Config) interface{} { return &c.Userdata.Values },
+}
+
+// Updater is a mock whose config can be changed while it is running
+type Updater interface {
+	// Config returns the config currently served
+	Config() cfg.Config
+	// Update applies fn to a copy of the config currently served and reloads the mock with it, unless fn returns an error
+	Update(fn func(c *cfg.Config) error) error
+}
+
+// ValuesHandler reads and changes the values served by the mock. All changes of a request are validated and then applied
+// at once, like a reload of the config file:
+//
+//	GET    ValuesPath  returns all values of the section
+//	PATCH  ValuesPath  sets the values of the keys in a JSON object
+//	GET    ValuePath   returns the value
+//	PUT    ValuePath   replaces the value
+//	PATCH  ValuePath   merges a JSON object into the value
+//	DELETE ValuePath   empties the value, so its path is neither listed nor served anymore
+//
+// In the metadata section, keys starting with tree/ address the nodes of metadata.tree by their path, and keys starting
+// with macs/ the network interfaces of metadata.interfaces by their mac and their attributes by their names under it.
+// PUT adds missing nodes, interfaces and attributes, and DELETE removes them.
+func ValuesHandler(u Updater) server.HandlerType {
+	return func(res http.ResponseWriter, req *http.Request) {
+		section, key := mux.Vars(req)["section"], mux.Vars(req)["key"]
+		if _, ok := sections[section]; !ok {
+			server.ReturnNotFoundResponse(res)
+			return
+		}
+
+		switch {
+		case req.Method == http.MethodGet:
+		case req.Method == http.MethodPatch, key != "" && (req.Method == http.MethodPut || req.Method == http.MethodDelete):
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				log.Printf("Failed to read values request: %s", err)
+				server.ReturnBadRequestResponse(res)
+				return
+			}
+			var removed interface{}
+			err = u.Update(func(c *cfg.Config) error {
+				if isPathKey(section, key) && req.Method == http.MethodDelete {
+					// deleted nodes, interfaces and attributes no longer exist, so the response returns them as they were
+					removed, _ = pathValue(*c, key)
+				}
+				return updateValues(c, section, key, req.Method, body)
+			})
+			if errors.Is(err, errUnknownKey) && key != "" {
+				server.ReturnNotFoundResponse(res)
+				return
+			}
+			if err != nil {
+				log.Printf("Rejected change of %s values: %s", section, err)
+				server.ReturnBadRequestResponse(res)
+				return
+			}
+			log.Printf("Changed %s values via %s %s", section, req.Method, req.URL.Path)
+			if removed != nil {
+				returnJSON(res, http.StatusOK, removed)
+				return
+			}
+		case key == "":
+			server.ReturnMethodNotAllowedResponse(res, http.MethodGet, http.MethodPatch)
+			return
+		default:
+			server.ReturnMethodNotAllowedResponse(res, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+			return
+		}
+
+		c := u.Config()
+		if isPathKey(section, key) {
+			value, ok := pathValue(c, key)
+			if !ok {
+				server.ReturnNotFoundResponse(res)
+				return
+			}
+			returnJSON(res, http.StatusOK, value)
+			return
+		}
+		values := reflect.ValueOf(sections[section](&c)).Elem()
+		if key == "" {
+			returnJSON(res, http.StatusOK, cfg.ByKey(values.Interface()))
+			return
+		}
+		value, ok := valueByKey(values, key)
+		if !ok {
+			server.ReturnNotFoundResponse(res)
+			return
+		}
+		returnJSON(res, http.StatusOK, value.Interface())
+	}
+}
+
+// SetValues sets the values of the keys in a JSON object in a section, one of: metadata, dynamic, userdata. Like a PATCH
+// of ValuesPath, the values are validated. Paths containing a changed placeholder value, e.g. the mac address, follow it
+// once the config is loaded into the metadata tree.
+func SetValues(c *cfg.Config, section string, values []byte) error {
+	if _, ok := sections[section]; !ok {
+		return fmt.Errorf("unknown section %s", section)
+	}
+	return updateValues(c, section, "", http.MethodPatch, values)
+}
+
+// updateValues applies the change requested with method and body to the values of the section in c
+func updateValues(c *cfg.Config, section string, key string, method string, body []byte) error {
+	if isPathKey(section, key) {
+		return updatePath(c, key, method, body)
+	}
+	values := reflect.ValueOf(sections[section](c)).Elem()
+	// copy the explicit keys, so the config currently served does not share them with the new one
+	c.ExplicitKeys = maps.Clone(c.ExplicitKeys)
+	if c.ExplicitKeys == nil {
+		c.ExplicitKeys = map[string]bool{}
+	}
+
+	if key == "" {
+		var patch map[string]json.RawMessage
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return err
+		}
+		for k, raw := range patch {
+			value, ok := valueByKey(values, k)
+			if !ok {
+				return fmt.Errorf("%w %s", errUnknownKey, k)
+			}
+			if err := decodeValue(value, raw, false); err != nil {
+				return fmt.Errorf("invalid value for %s: %w", k, err)
+			}
+			markExplicit(c.ExplicitKeys, section+".values."+k, raw)
+		}
+	} else {
+		value, ok := valueByKey(values, key)
+		if !ok {
+			return fmt.Errorf("%w %s", errUnknownKey, key)
+		}
+		switch method {
+		case http.MethodDelete:
+			value.Set(reflect.Zero(value.Type()))
+		case http.MethodPut:
+			if err := decodeValue(value, body, false); err != nil {
+				return fmt.Errorf("invalid value for %s: %w", key, err)
+			}
+		case http.MethodPatch:
+			if err := decodeValue(value, body, true); err != nil {
+				return fmt.Errorf("invalid value for %s: %w", key, err)
+			}
+		}
+		markExplicit(c.ExplicitKeys, section+".values."+key, body)
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(c.Userdata.Values.Userdata); err != nil {
+		return fmt.Errorf("userdata is not base64 encoded: %w", err)
+	}
+	return nil
+}
+
+// decodeValue sets value to the given JSON. When merging, fields missing in the JSON keep their current values.
+func decodeValue(value reflect.Value, raw []byte, merge bool) error {
+	// decode into a copy, so the config currently served does not share slices or pointers with the new one
+	decoded := reflect.New(value.Type())
+	if merge {
+		current, err := json.Marshal(value.Interface())
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(current, decoded.Interface()); err != nil {
+			return err
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(decoded.Interface()); err != nil {
+		return err
+	}
+	value.Set(decoded.Elem())
+	return nil
+}
+
+// markExplicit marks the config key set to raw as set explicitly, along with the lower-case keys of the fields of an
+// object value, e.g. dynamic.values.instance-identity-document.imageid, so they are not derived
+func markExplicit(explicit map[string]bool, key string, raw []byte) {
+	explicit[key] = true
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) != nil {
+		return
+	}
+	for field := range fields {
+		explicit[key+"."+strings.ToLower(field)] = true
+	}
+}
+
+// valueByKey returns the field of values with the given config key
+func valueByKey(values reflect.Value, key string) (reflect.Value, bool) {
+	for i := 0; i < values.NumField(); i++ {
+		if values.Type().Field(i).Tag.Get("mapstructure") == key {
+			return values.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// returnJSON returns data as indented JSON. Unlike server.FormatAndReturnJSONResponse, lists are not reformatted
+// the way IMDS formats them, as values may contain brackets.
+func returnJSON(res http.ResponseWriter, statusCode int, data interface{}) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(statusCode)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(data); err != nil {
+		log.Printf("Failed to encode admin response: %s", err)
+	}
+}
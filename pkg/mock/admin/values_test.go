@@ -0,0 +1,233 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+
+	"github.com/gorilla/mux"
+)
+
+// testUpdater keeps the config in memory instead of reloading a mock
+type testUpdater struct {
+	config cfg.Config
+}
+
+func (u *testUpdater) Config() cfg.Config {
+	return u.config
+}
+
+func (u *testUpdater) Update(fn func(c *cfg.Config) error) error {
+	c := u.config
+	if err := fn(&c); err != nil {
+		return err
+	}
+	u.config = c
+	return nil
+}
+
+func newTestUpdater(t *testing.T) *testUpdater {
+	c, err := cfg.NewDefaultConfig()
+	h.Ok(t, err)
+	return &testUpdater{config: c}
+}
+
+func doValuesRequest(u *testUpdater, method string, section string, key string, body string) *httptest.ResponseRecorder {
+	path := PathPrefix + "/values/" + section
+	vars := map[string]string{"section": section}
+	if key != "" {
+		path += "/" + key
+		vars["key"] = key
+	}
+	req := mux.SetURLVars(httptest.NewRequest(method, path, strings.NewReader(body)), vars)
+	rr := httptest.NewRecorder()
+	ValuesHandler(u)(rr, req)
+	return rr
+}
+
+func TestValuesHandlerPutAndGet(t *testing.T) {
+	u := newTestUpdater(t)
+
+	rr := doValuesRequest(u, http.MethodPut, "metadata", "instance-type", `"m5.large"`)
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK, but was %d", rr.Code))
+	h.Assert(t, u.config.Metadata.Values.InstanceType == "m5.large", fmt.Sprintf("Expected instance-type m5.large, but was %s", u.config.Metadata.Values.InstanceType))
+
+	rr = doValuesRequest(u, http.MethodGet, "metadata", "instance-type", "")
+	h.Assert(t, strings.TrimSpace(rr.Body.String()) == `"m5.large"`, fmt.Sprintf("Expected \"m5.large\", but was %s", rr.Body.String()))
+	rr = doValuesRequest(u, http.MethodGet, "metadata", "", "")
+	h.Assert(t, strings.Contains(rr.Body.String(), `"instance-type": "m5.large"`), fmt.Sprintf("Expected instance-type in all values, but was %s", rr.Body.String()))
+}
+
+func TestValuesHandlerPatchMergesStructValues(t *testing.T) {
+	u := newTestUpdater(t)
+	before := u.config.Metadata.Values.IamSecurityCredentials
+
+	rr := doValuesRequest(u, http.MethodPatch, "metadata", "iam-security-credentials", `{"AccessKeyId": "AKIDROTATED"}`)
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK, but was %d", rr.Code))
+	after := u.config.Metadata.Values.IamSecurityCredentials
+	h.Assert(t, after.AccessKeyId == "AKIDROTATED", fmt.Sprintf("Expected AccessKeyId AKIDROTATED, but was %s", after.AccessKeyId))
+	h.Assert(t, after.SecretAccessKey == before.SecretAccessKey, "Expected fields missing in the patch to be kept")
+}
+
+func TestValuesHandlerPatchSectionChangesSeveralValues(t *testing.T) {
+	u := newTestUpdater(t)
+
+	rr := doValuesRequest(u, http.MethodPatch, "metadata", "", `{"tags-instance-name": "flipped", "instance-type": "c5.xlarge"}`)
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK, but was %d", rr.Code))
+	h.Assert(t, u.config.Metadata.Values.TagsInstanceName == "flipped", "Expected tags-instance-name to be changed")
+	h.Assert(t, u.config.Metadata.Values.InstanceType == "c5.xlarge", "Expected instance-type to be changed")
+}
+
+func TestValuesHandlerDeleteEmptiesValue(t *testing.T) {
+	u := newTestUpdater(t)
+
+	rr := doValuesRequest(u, http.MethodDelete, "metadata", "iam-info", "")
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK, but was %d", rr.Code))
+	h.Assert(t, u.config.Metadata.Values.IamInformation.Code == "", "Expected iam-info to be empty")
+}
+
+func TestValuesHandlerMarksKeysExplicit(t *testing.T) {
+	u := newTestUpdater(t)
+	served := u.config
+
+	doValuesRequest(u, http.MethodPut, "metadata", "placement-region", `"us-east-1"`)
+	doValuesRequest(u, http.MethodPatch, "dynamic", "", `{"instance-identity-document": {"imageId": "ami-0b69ea66ff7391e80"}}`)
+	for _, key := range []string{"metadata.values.placement-region", "dynamic.values.instance-identity-document", "dynamic.values.instance-identity-document.imageid"} {
+		h.Assert(t, u.config.ExplicitKeys[key], fmt.Sprintf("Expected %s to be explicit, but were %v", key, u.config.ExplicitKeys))
+	}
+	h.Assert(t, !u.config.ExplicitKeys["dynamic.values.instance-identity-document.region"], "Expected fields missing in the value not to be explicit")
+	h.Assert(t, len(served.ExplicitKeys) == 0, "Expected the explicit keys of the config served before not to change")
+}
+
+func TestValuesHandlerRejectsInvalidChanges(t *testing.T) {
+	u := newTestUpdater(t)
+	before := u.config
+
+	for _, tc := range []struct {
+		method, section, key, body string
+		expectedCode               int
+	}{
+		{http.MethodPut, "metadata", "instance-type", `42`, http.StatusBadRequest},
+		{http.MethodPut, "metadata", "iam-security-credentials", `{"NoSuchField": "x"}`, http.StatusBadRequest},
+		{http.MethodPatch, "metadata", "", `{"instance-type": "c5.xlarge", "no-such-key": "x"}`, http.StatusBadRequest},
+		{http.MethodPut, "userdata", "userdata", `"not base64!"`, http.StatusBadRequest},
+		{http.MethodPut, "metadata", "no-such-key", `"x"`, http.StatusNotFound},
+		{http.MethodGet, "no-such-section", "", "", http.StatusNotFound},
+		{http.MethodDelete, "metadata", "", "", http.StatusMethodNotAllowed},
+	} {
+		rr := doValuesRequest(u, tc.method, tc.section, tc.key, tc.body)
+		h.Assert(t, rr.Code == tc.expectedCode, fmt.Sprintf("Expected %d for %s %s/%s, but was %d", tc.expectedCode, tc.method, tc.section, tc.key, rr.Code))
+	}
+	h.Assert(t, u.config.Metadata.Values == before.Metadata.Values, "Expected rejected changes not to be applied")
+	h.Assert(t, u.config.Userdata.Values == before.Userdata.Values, "Expected rejected changes not to be applied")
+}
+
+func TestValuesHandlerChangesTreeNodes(t *testing.T) {
+	u := newTestUpdater(t)
+	u.config.Metadata.Tree = []cfg.Node{{Path: "/latest/meta-data/foo/bar", Value: "baz"}}
+	served := u.config
+
+	rr := doValuesRequest(u, http.MethodGet, "metadata", "tree/latest/meta-data/foo/bar", "")
+	h.Assert(t, strings.TrimSpace(rr.Body.String()) == `"baz"`, fmt.Sprintf("Expected \"baz\", but was %s", rr.Body.String()))
+	rr = doValuesRequest(u, http.MethodPut, "metadata", "tree/latest/meta-data/foo/bar", `"qux"`)
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK, but was %d", rr.Code))
+	rr = doValuesRequest(u, http.MethodPut, "metadata", "tree/latest/meta-data/foo/config", `{"enabled": true}`)
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK, but was %d", rr.Code))
+	rr = doValuesRequest(u, http.MethodPatch, "metadata", "tree/latest/meta-data/foo/config", `{"level": 2}`)
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK, but was %d", rr.Code))
+
+	expected := []cfg.Node{
+		{Path: "/latest/meta-data/foo/bar", Value: "qux"},
+		{Path: "/latest/meta-data/foo/config", Value: map[string]interface{}{"enabled": true, "level": float64(2)}},
+	}
+	h.Assert(t, fmt.Sprint(u.config.Metadata.Tree) == fmt.Sprint(expected), fmt.Sprintf("Expected nodes %v, but were %v", expected, u.config.Metadata.Tree))
+	h.Assert(t, served.Metadata.Tree[0].Value == "baz", "Expected the nodes of the config served before not to change")
+
+	rr = doValuesRequest(u, http.MethodDelete, "metadata", "tree/latest/meta-data/foo/bar", "")
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK, but was %d", rr.Code))
+	rr = doValuesRequest(u, http.MethodGet, "metadata", "tree/latest/meta-data/foo/bar", "")
+	h.Assert(t, rr.Code == http.StatusNotFound, fmt.Sprintf("Expected 404 Not Found for a deleted node, but was %d", rr.Code))
+}
+
+func TestValuesHandlerChangesInterfaceAttributes(t *testing.T) {
+	mac := "0e:49:61:0f:c3:11"
+	u := newTestUpdater(t)
+	u.config.Metadata.Interfaces = []cfg.NetworkInterface{{Mac: mac, Attributes: map[string]interface{}{
+		"device-number":      "1",
+		"ipv4-associations/": map[string]interface{}{"54.1.2.3": "10.0.1.10"},
+	}}}
+	served := u.config
+
+	rr := doValuesRequest(u, http.MethodGet, "metadata", "macs/"+mac+"/device-number", "")
+	h.Assert(t, strings.TrimSpace(rr.Body.String()) == `"1"`, fmt.Sprintf("Expected \"1\", but was %s", rr.Body.String()))
+	rr = doValuesRequest(u, http.MethodPut, "metadata", "macs/"+mac+"/ipv4-associations/54.1.2.4", `"10.0.1.11"`)
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK, but was %d", rr.Code))
+	rr = doValuesRequest(u, http.MethodDelete, "metadata", "macs/"+mac+"/device-number", "")
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK, but was %d", rr.Code))
+	rr = doValuesRequest(u, http.MethodGet, "metadata", "macs/"+mac, "")
+	h.Assert(t, strings.Contains(rr.Body.String(), `"54.1.2.4": "10.0.1.11"`) && !strings.Contains(rr.Body.String(), "device-number"), fmt.Sprintf("Expected the changed attributes, but were %s", rr.Body.String()))
+	h.Assert(t, served.Metadata.Interfaces[0].Attributes["device-number"] == "1", "Expected the attributes of the config served before not to change")
+	h.Assert(t, len(served.Metadata.Interfaces[0].Attributes["ipv4-associations/"].(map[string]interface{})) == 1, "Expected the attributes of the config served before not to change")
+
+	rr = doValuesRequest(u, http.MethodPatch, "metadata", "macs/0e:49:61:0f:c3:12", `{"device-number": 2}`)
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK, but was %d", rr.Code))
+	h.Assert(t, len(u.config.Metadata.Interfaces) == 2, fmt.Sprintf("Expected an interface to be added, but were %v", u.config.Metadata.Interfaces))
+	rr = doValuesRequest(u, http.MethodDelete, "metadata", "macs/"+mac, "")
+	h.Assert(t, rr.Code == http.StatusOK, fmt.Sprintf("Expected 200 OK, but was %d", rr.Code))
+	h.Assert(t, len(u.config.Metadata.Interfaces) == 1 && u.config.Metadata.Interfaces[0].Mac == "0e:49:61:0f:c3:12", fmt.Sprintf("Expected the interface to be removed, but were %v", u.config.Metadata.Interfaces))
+}
+
+func TestValuesHandlerRejectsInvalidPathChanges(t *testing.T) {
+	u := newTestUpdater(t)
+	u.config.Metadata.Tree = []cfg.Node{{Path: "/latest/meta-data/foo/bar", Type: "binary", Value: "YmF6"}}
+	before := u.config
+
+	for _, tc := range []struct {
+		method, section, key, body string
+		expectedCode               int
+	}{
+		{http.MethodPut, "metadata", "tree/latest/meta-data/foo/bar", `"not base64!"`, http.StatusBadRequest},
+		{http.MethodPut, "metadata", "tree/foo/bar", `"baz"`, http.StatusBadRequest},
+		{http.MethodPatch, "metadata", "tree/latest/meta-data/foo/bar", `{"x": 1}`, http.StatusBadRequest},
+		{http.MethodDelete, "metadata", "tree/latest/meta-data/foo/qux", "", http.StatusNotFound},
+		{http.MethodPut, "dynamic", "tree/latest/meta-data/foo/qux", `"baz"`, http.StatusNotFound},
+		{http.MethodPut, "metadata", "macs/not-a-mac/device-number", `"1"`, http.StatusBadRequest},
+		{http.MethodDelete, "metadata", "macs/0e:49:61:0f:c3:11", "", http.StatusNotFound},
+		{http.MethodGet, "metadata", "macs/0e:49:61:0f:c3:11/device-number", "", http.StatusNotFound},
+	} {
+		rr := doValuesRequest(u, tc.method, tc.section, tc.key, tc.body)
+		h.Assert(t, rr.Code == tc.expectedCode, fmt.Sprintf("Expected %d for %s %s/%s, but was %d", tc.expectedCode, tc.method, tc.section, tc.key, rr.Code))
+	}
+	h.Assert(t, fmt.Sprint(u.config.Metadata.Tree) == fmt.Sprint(before.Metadata.Tree), "Expected rejected changes not to be applied")
+	h.Assert(t, len(u.config.Metadata.Interfaces) == 0, "Expected rejected changes not to be applied")
+}
+
+func TestAuthorized(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, ClockPath, nil)
+	h.Assert(t, Authorized(httptest.NewRecorder(), req, ""), "Expected requests to be authorized without a token")
+
+	rr := httptest.NewRecorder()
+	h.Assert(t, !Authorized(rr, req, "s3cret"), "Expected requests without the token to be rejected")
+	h.Assert(t, rr.Code == http.StatusUnauthorized, fmt.Sprintf("Expected 401 Unauthorized, but was %d", rr.Code))
+
+	req.Header.Set("Authorization", "Bearer s3cret")
+	h.Assert(t, Authorized(httptest.NewRecorder(), req, "s3cret"), "Expected requests with the token to be authorized")
+}
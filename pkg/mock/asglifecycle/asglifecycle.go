@@ -14,76 +14,497 @@
 package asglifecycle
 
 import (
+	"crypto/rand"
+	"fmt"
 	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
+	asgcfg "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/asglifecycle/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/eligibility"
 	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
 )
 
 const (
 	targetLifeCycleStatePath = "/latest/meta-data/autoscaling/target-lifecycle-state"
+
+	// InService is the state of an instance serving in the group
+	InService = "InService"
+	// Terminated is the state of a terminated instance
+	Terminated = "Terminated"
+	// WarmedStopped is the state of a stopped instance in the warm pool
+	WarmedStopped = "Warmed:Stopped"
+	// WarmedRunning is the state of a running instance in the warm pool
+	WarmedRunning = "Warmed:Running"
+	// WarmedHibernated is the state of a hibernated instance in the warm pool
+	WarmedHibernated = "Warmed:Hibernated"
+	// PendingWait is the state of a launching instance waiting for its launch lifecycle hooks
+	PendingWait = "Pending:Wait"
+	// WarmedPendingWait is the state of an instance launching into the warm pool waiting for its launch lifecycle hooks
+	WarmedPendingWait = "Warmed:Pending:Wait"
+	// TerminatingWait is the state of a terminating instance waiting for its termination lifecycle hooks
+	TerminatingWait = "Terminating:Wait"
+
+	// Launching is the transition of lifecycle hooks run when an instance launches
+	Launching = "autoscaling:EC2_INSTANCE_LAUNCHING"
+	// Terminating is the transition of lifecycle hooks run when an instance terminates
+	Terminating = "autoscaling:EC2_INSTANCE_TERMINATING"
+	// Continue completes a lifecycle action, letting the instance proceed to its target state
+	Continue = "CONTINUE"
+	// Abandon completes a lifecycle action, terminating a launching instance and skipping the remaining hooks
+	Abandon = "ABANDON"
+
+	defaultHeartbeatTimeout = time.Hour
+	maxGlobalTimeout        = 48 * time.Hour
 )
 
 var (
-	eligibleIPs  = make(map[string]bool)
-	c            cfg.Config
-	asgStartTime int64 = time.Now().Unix()
-	state              = "InService"
+	// States are the target lifecycle states an instance can go through
+	States = []string{InService, WarmedStopped, WarmedRunning, WarmedHibernated, Terminated}
+	// Transitions are the transitions of lifecycle hooks
+	Transitions = []string{Launching, Terminating}
+	// Results are the results completing a lifecycle action
+	Results = []string{Continue, Abandon}
 )
 
-func Mock(config cfg.Config) {
-	SetConfig(config)
-	server.ListenAndServe(config.Server.HostName, config.Server.Port)
+// Status is the lifecycle of the instance at the current mock time
+type Status struct {
+	TargetLifecycleState string            `json:"target-lifecycle-state"`
+	LifecycleState       string            `json:"lifecycle-state"`
+	LifecycleActions     []LifecycleAction `json:"lifecycle-actions,omitempty"`
+}
+
+// LifecycleAction is a lifecycle hook run for the current transition of the instance
+type LifecycleAction struct {
+	LifecycleHookName    string `json:"hook-name"`
+	LifecycleActionToken string `json:"token"`
+	HeartbeatTimeoutTime string `json:"heartbeat-timeout-time"`
+	Result               string `json:"result,omitempty"`
+}
+
+// lifecycleAction tracks a lifecycle hook until it is completed or its heartbeat timeout passes
+type lifecycleAction struct {
+	hook         asgcfg.LifecycleHook
+	token        string
+	startTime    time.Time
+	timeoutTime  time.Time
+	result       string
+	completeTime time.Time
+}
+
+// Mock serves the auto scaling target lifecycle state
+type Mock struct {
+	mu           sync.Mutex
+	clock        *clock.Clock
+	c            cfg.Config
+	eligibility  *eligibility.Tracker
+	asgStartTime int64
+	// state is the target lifecycle state served, lifecycleState the state of the instance in the group and stage
+	// the index of the target lifecycle state in the configured sequence of states
+	state          string
+	lifecycleState string
+	stateTime      time.Time
+	stage          int
+	actions        []*lifecycleAction
+}
+
+// stage is a target lifecycle state of the configured sequence and the time the instance stays in it, if timed
+type stage struct {
+	state    string
+	duration time.Duration
+	timed    bool
+}
+
+// New returns an asg lifecycle mock launching the instance at the current mock time into the first of the configured
+// states, InService if none are configured. The instance waits for the launch lifecycle hooks in config, if any,
+// when it launches and when it enters service from the warm pool. The termination delay starts at launch.
+func New(config cfg.Config, clk *clock.Clock) *Mock {
+	now := clk.Now()
+	m := &Mock{
+		clock:        clk,
+		c:            config,
+		eligibility:  eligibility.New("asglifecycle", config, clk),
+		asgStartTime: now.Unix(),
+	}
+	m.enter(0, now)
+	return m
 }
 
 // SetConfig sets the local config
-func SetConfig(config cfg.Config) {
-	c = config
+func (m *Mock) SetConfig(config cfg.Config) {
+	m.mu.Lock()
+	m.c = config
+	m.mu.Unlock()
+	m.eligibility.SetConfig(config)
+}
+
+// Eligibility returns the tracker deciding which clients are served the mock
+func (m *Mock) Eligibility() *eligibility.Tracker {
+	return m.eligibility
 }
 
 // Handler processes http requests
-func Handler(res http.ResponseWriter, req *http.Request) {
-	if c.MockIPCount >= 0 {
-		// req.RemoteAddr is formatted as IP:port
-		requestIP := strings.Split(req.RemoteAddr, ":")[0]
-		if !eligibleIPs[requestIP] {
-			if len(eligibleIPs) < c.MockIPCount {
-				eligibleIPs[requestIP] = true
-			} else {
-				log.Printf("Requesting IP %s is not eligible for ASG Lifecycle State because the max number of IPs configured (%d) has been reached.\n", requestIP, c.MockIPCount)
-				server.ReturnNotFoundResponse(res)
+func (m *Mock) Handler(res http.ResponseWriter, req *http.Request) {
+	if eligible, reason := m.eligibility.Eligible(req); !eligible {
+		log.Printf("Requesting IP %s is not eligible for ASG Lifecycle State: %s\n", server.ClientIP(req), reason)
+		server.ReturnNotFoundResponse(res)
+		return
+	}
+
+	switch req.URL.Path {
+	case targetLifeCycleStatePath:
+		m.handleASGTargetLifecycleState(res, req)
+	}
+}
+
+func (m *Mock) handleASGTargetLifecycleState(res http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+		server.FormatAndReturnTextResponse(res, m.Status().TargetLifecycleState)
+	}
+}
+
+// Status returns the lifecycle of the instance at the current mock time
+func (m *Mock) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.advance(m.clock.Now())
+
+	s := Status{TargetLifecycleState: m.state, LifecycleState: m.lifecycleState}
+	for _, a := range m.actions {
+		s.LifecycleActions = append(s.LifecycleActions, LifecycleAction{
+			LifecycleHookName:    a.hook.Name,
+			LifecycleActionToken: a.token,
+			HeartbeatTimeoutTime: a.timeoutTime.UTC().Format(time.RFC3339),
+			Result:               a.result,
+		})
+	}
+	return s
+}
+
+// CompleteLifecycleAction completes the pending lifecycle action of a hook, identified by its token or the instance id,
+// like the auto scaling action of the same name
+func (m *Mock) CompleteLifecycleAction(hookName string, token string, instanceID string, result string) error {
+	if result != Continue && result != Abandon {
+		return fmt.Errorf("invalid lifecycle action result %s, expected one of %s", result, strings.Join(Results, ","))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.clock.Now()
+	m.advance(now)
+
+	a, err := m.pendingAction(hookName, token, instanceID)
+	if err != nil {
+		return err
+	}
+	a.result, a.completeTime = result, now
+	log.Printf("Completed lifecycle action of hook %s with result %s", hookName, result)
+	m.advance(now)
+	return nil
+}
+
+// RecordLifecycleActionHeartbeat restarts the heartbeat timeout of the pending lifecycle action of a hook, like the auto
+// scaling action of the same name. The instance waits for 100 heartbeat timeouts or 48 hours at most, whichever is less.
+func (m *Mock) RecordLifecycleActionHeartbeat(hookName string, token string, instanceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.clock.Now()
+	m.advance(now)
+
+	a, err := m.pendingAction(hookName, token, instanceID)
+	if err != nil {
+		return err
+	}
+	timeout := heartbeatTimeout(a.hook)
+	a.timeoutTime = now.Add(timeout)
+	if globalTimeoutTime := a.startTime.Add(min(100*timeout, maxGlobalTimeout)); a.timeoutTime.After(globalTimeoutTime) {
+		a.timeoutTime = globalTimeoutTime
+	}
+	log.Printf("Recorded heartbeat of lifecycle hook %s, timing out at %s", hookName, a.timeoutTime.UTC().Format(time.RFC3339))
+	return nil
+}
+
+// Terminate terminates the instance at the given time, e.g. on a scale in, unless it is terminating already. Pending
+// launch lifecycle actions are dropped.
+func (m *Mock) Terminate(at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.advance(at)
+	if m.state == Terminated {
+		return
+	}
+	if at.Before(m.stateTime) {
+		at = m.stateTime
+	}
+	m.actions = nil
+	m.terminate(at)
+}
+
+// pendingAction returns the pending lifecycle action of a hook by its token, or by the instance id if no token is given;
+// callers hold m.mu
+func (m *Mock) pendingAction(hookName string, token string, instanceID string) (*lifecycleAction, error) {
+	for _, a := range m.actions {
+		if a.hook.Name != hookName || a.result != "" {
+			continue
+		}
+		if (token != "" && token == a.token) || (token == "" && instanceID == m.c.Metadata.Values.InstanceID) {
+			return a, nil
+		}
+	}
+	if token != "" {
+		return nil, fmt.Errorf("No active Lifecycle Action found with token %s", token)
+	}
+	return nil, fmt.Errorf("No active Lifecycle Action found with instance ID %s", instanceID)
+}
+
+// advance moves the instance through its lifecycle up to the given time; callers hold m.mu
+func (m *Mock) advance(now time.Time) {
+	for {
+		switch m.lifecycleState {
+		case PendingWait, WarmedPendingWait, TerminatingWait:
+			completeTime, result, ok := m.completeActions(now)
+			if !ok {
 				return
 			}
+			m.actions = nil
+			if m.lifecycleState == TerminatingWait {
+				m.setLifecycleState(Terminated, completeTime)
+				continue
+			}
+			if result == Continue {
+				m.setLifecycleState(m.state, completeTime)
+				continue
+			}
+			// an abandoned launch terminates the instance
+			m.terminate(completeTime)
+		case Terminated:
+			return
+		default:
+			stages := m.stages()
+			if m.stage < len(stages)-1 {
+				nextTime := m.stateTime.Add(stages[m.stage].duration)
+				if now.Before(nextTime) {
+					return
+				}
+				m.enter(m.stage+1, nextTime)
+				continue
+			}
+			// the last state of the sequence lasts for its time, if given, or until the termination time
+			terminationTime := m.terminationTime()
+			if last := stages[m.stage]; last.timed {
+				terminationTime = m.stateTime.Add(last.duration)
+			} else if terminationTime.Before(m.stateTime) {
+				terminationTime = m.stateTime
+			}
+			if now.Before(terminationTime) {
+				return
+			}
+			m.terminate(terminationTime)
 		}
 	}
+}
 
-	switch req.URL.Path {
-	case targetLifeCycleStatePath:
-		handleASGTargetLifecycleState(res, req)
+// completeActions completes the pending lifecycle actions whose heartbeat timeout has passed with their default result,
+// and returns when and how the wait for the hooks completed, if it did; callers hold m.mu
+func (m *Mock) completeActions(now time.Time) (time.Time, string, bool) {
+	var completeTime time.Time
+	pending := false
+	for _, a := range m.actions {
+		if a.result == "" && !now.Before(a.timeoutTime) {
+			a.result, a.completeTime = a.hook.DefaultResult, a.timeoutTime
+			if a.result == "" {
+				a.result = Abandon
+			}
+			log.Printf("Heartbeat timeout of lifecycle hook %s passed, completing it with result %s", a.hook.Name, a.result)
+		}
+		if a.result == "" {
+			pending = true
+			continue
+		}
+		if a.result == Abandon {
+			// abandoning a lifecycle action skips the remaining hooks
+			return a.completeTime, Abandon, true
+		}
+		if a.completeTime.After(completeTime) {
+			completeTime = a.completeTime
+		}
 	}
+	return completeTime, Continue, !pending
 }
 
-func handleASGTargetLifecycleState(res http.ResponseWriter, req *http.Request) {
-	requestTime := time.Now().Unix()
-	if c.ASGTerminationTriggerTime != "" {
-		triggerTime, _ := time.Parse(time.RFC3339, c.ASGTerminationTriggerTime)
-		delayRemaining := triggerTime.Unix() - requestTime
-		if delayRemaining <= 0 {
-			state = "Terminated"
+// enter moves the instance into the target lifecycle state at index i of the configured sequence. The instance waits
+// for the launch lifecycle hooks, if any, when it launches and when it enters service from the warm pool; callers hold m.mu
+func (m *Mock) enter(i int, at time.Time) {
+	stages := m.stages()
+	m.stage = i
+	m.state = stages[i].state
+	m.setLifecycleState(m.state, at)
+	switch {
+	case m.state == Terminated:
+		m.terminate(at)
+	case i == 0 && m.state != InService:
+		m.startLifecycleActions(Launching, WarmedPendingWait, at)
+	case m.state == InService && (i == 0 || isWarmed(stages[i-1].state)):
+		m.startLifecycleActions(Launching, PendingWait, at)
+	}
+}
+
+// stages returns the configured sequence of target lifecycle states; callers hold m.mu
+func (m *Mock) stages() []stage {
+	stages, err := parseStates(m.c.ASGLifecycleConfig.States)
+	if err != nil || len(stages) == 0 {
+		return []stage{{state: InService}}
+	}
+	// keep the instance in its state if the sequence was shortened by a config change
+	for len(stages) <= m.stage {
+		stages = append(stages, stage{state: m.state})
+	}
+	return stages
+}
+
+// terminate sets the target lifecycle state to Terminated and waits for the termination lifecycle hooks, if any;
+// callers hold m.mu
+func (m *Mock) terminate(at time.Time) {
+	m.state = Terminated
+	m.setLifecycleState(Terminated, at)
+	m.startLifecycleActions(Terminating, TerminatingWait, at)
+}
+
+// startLifecycleActions puts the instance into the wait state for the hooks of a transition, if it has any;
+// callers hold m.mu
+func (m *Mock) startLifecycleActions(transition string, waitState string, at time.Time) {
+	for _, hook := range m.c.ASGLifecycleConfig.LifecycleHooks {
+		if hook.Transition != transition {
+			continue
 		}
-	} else {
-		delayInSeconds := c.ASGTerminationDelayInSec
-		delayRemaining := delayInSeconds - (requestTime - asgStartTime)
-		if delayRemaining <= 0 {
-			state = "Terminated"
+		m.actions = append(m.actions, &lifecycleAction{
+			hook:        hook,
+			token:       newToken(),
+			startTime:   at,
+			timeoutTime: at.Add(heartbeatTimeout(hook)),
+		})
+	}
+	if len(m.actions) > 0 {
+		log.Printf("Waiting for %d lifecycle hooks in %s", len(m.actions), waitState)
+		m.setLifecycleState(waitState, at)
+	}
+}
+
+// setLifecycleState sets the state of the instance in the group and when it entered it; callers hold m.mu
+func (m *Mock) setLifecycleState(state string, at time.Time) {
+	m.lifecycleState, m.stateTime = state, at
+}
+
+// terminationTime returns when the instance is terminated, if it is in service by then
+func (m *Mock) terminationTime() time.Time {
+	if m.c.ASGTerminationTriggerTime != "" {
+		triggerTime, _ := time.Parse(time.RFC3339, m.c.ASGTerminationTriggerTime)
+		return triggerTime
+	}
+	return time.Unix(m.asgStartTime+m.c.ASGTerminationDelayInSec, 0)
+}
+
+// isWarmed returns whether a target lifecycle state is a state in the warm pool
+func isWarmed(state string) bool {
+	return strings.HasPrefix(state, "Warmed:")
+}
+
+// parseStates parses a sequence of target lifecycle states, each formatted as STATE or STATE=SECONDS
+func parseStates(states []string) ([]stage, error) {
+	var stages []stage
+	for _, s := range states {
+		state, seconds, hasDuration := strings.Cut(s, "=")
+		if !slices.Contains(States, state) {
+			return nil, fmt.Errorf("unknown target lifecycle state %s", state)
 		}
+		var duration time.Duration
+		if hasDuration {
+			sec, err := strconv.ParseInt(seconds, 10, 64)
+			if err != nil || sec < 0 {
+				return nil, fmt.Errorf("invalid time in state %s", s)
+			}
+			duration = time.Duration(sec) * time.Second
+		}
+		stages = append(stages, stage{state: state, duration: duration, timed: hasDuration})
 	}
+	return stages, nil
+}
 
-	switch req.Method {
-	case "GET":
-		server.FormatAndReturnTextResponse(res, state)
+// heartbeatTimeout returns the heartbeat timeout of a hook
+func heartbeatTimeout(hook asgcfg.LifecycleHook) time.Duration {
+	if hook.HeartbeatTimeoutSec <= 0 {
+		return defaultHeartbeatTimeout
+	}
+	return time.Duration(hook.HeartbeatTimeoutSec) * time.Second
+}
+
+// newToken returns a random lifecycle action token formatted like a UUID
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// ValidateStates validates a sequence of target lifecycle states and returns a slice of error messages
+func ValidateStates(key string, states []string) []string {
+	var errStrings []string
+	for i, s := range states {
+		if _, err := parseStates([]string{s}); err != nil || (strings.HasPrefix(s, Terminated) && i < len(states)-1) {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     key,
+				Allowed:      "STATE or STATE=SECONDS, the time spent in the state, with Terminated last if given. STATE can be one of the following: " + strings.Join(States, ","),
+				InvalidValue: s}.Error(),
+			)
+		}
+	}
+	return errStrings
+}
+
+// ValidateLifecycleHooks validates a list of lifecycle hooks and returns a slice of error messages. Keys of invalid
+// values are prefixed with keyPrefix and the index of the hook, e.g. asglifecycle.lifecycle-hooks[0].name.
+func ValidateLifecycleHooks(keyPrefix string, hooks []asgcfg.LifecycleHook) []string {
+	var errStrings []string
+	names := make(map[string]bool)
+	for i, hook := range hooks {
+		hookPrefix := fmt.Sprintf("%s[%d].", keyPrefix, i)
+		if hook.Name == "" || names[hook.Name] {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     hookPrefix + "name",
+				Allowed:      "a unique hook name, e.g. my-termination-hook",
+				InvalidValue: hook.Name}.Error(),
+			)
+		}
+		names[hook.Name] = true
+
+		if !slices.Contains(Transitions, hook.Transition) {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     hookPrefix + "transition",
+				Allowed:      strings.Join(Transitions, ","),
+				InvalidValue: hook.Transition}.Error(),
+			)
+		}
+		// the heartbeat timeout and default result are optional
+		if hook.HeartbeatTimeoutSec != 0 && (hook.HeartbeatTimeoutSec < 30 || hook.HeartbeatTimeoutSec > 7200) {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     hookPrefix + "heartbeat-timeout-sec",
+				Allowed:      "30 to 7200 seconds",
+				InvalidValue: strconv.FormatInt(hook.HeartbeatTimeoutSec, 10)}.Error(),
+			)
+		}
+		if hook.DefaultResult != "" && !slices.Contains(Results, hook.DefaultResult) {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     hookPrefix + "default-result",
+				Allowed:      strings.Join(Results, ","),
+				InvalidValue: hook.DefaultResult}.Error(),
+			)
+		}
 	}
+	return errStrings
 }
@@ -0,0 +1,134 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package asglifecycle
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	asgcfg "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/asglifecycle/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+const testInstanceID = "i-1234567890abcdef0"
+
+func newTestMock(states []string, hooks ...asgcfg.LifecycleHook) (*Mock, *clock.Clock) {
+	var c cfg.Config
+	c.Metadata.Values.InstanceID = testInstanceID
+	c.ASGTerminationDelayInSec = 600
+	c.ASGLifecycleConfig.States = states
+	c.ASGLifecycleConfig.LifecycleHooks = hooks
+	clk := clock.New()
+	clk.Freeze()
+	return New(c, clk), clk
+}
+
+func assertStates(t *testing.T, m *Mock, target string, lifecycle string) {
+	t.Helper()
+	s := m.Status()
+	h.Assert(t, s.TargetLifecycleState == target && s.LifecycleState == lifecycle,
+		fmt.Sprintf("Expected target state %s in %s, but was %s in %s", target, lifecycle, s.TargetLifecycleState, s.LifecycleState))
+}
+
+func TestLaunchHookHoldsInstanceUntilCompleted(t *testing.T) {
+	m, clk := newTestMock(nil, asgcfg.LifecycleHook{Name: "launch", Transition: Launching})
+	assertStates(t, m, InService, PendingWait)
+
+	// the termination delay passes while the instance waits
+	clk.Advance(20 * time.Minute)
+	assertStates(t, m, InService, PendingWait)
+
+	h.Ok(t, m.CompleteLifecycleAction("launch", "", testInstanceID, Continue))
+	assertStates(t, m, Terminated, Terminated)
+}
+
+func TestAbandonedLaunchTerminatesInstance(t *testing.T) {
+	m, _ := newTestMock(nil, asgcfg.LifecycleHook{Name: "launch", Transition: Launching})
+	token := m.Status().LifecycleActions[0].LifecycleActionToken
+
+	err := m.CompleteLifecycleAction("launch", "unknown-token", "", Abandon)
+	h.Assert(t, err != nil, "Expected an error completing a lifecycle action with an unknown token")
+	h.Ok(t, m.CompleteLifecycleAction("launch", token, "", Abandon))
+	assertStates(t, m, Terminated, Terminated)
+}
+
+func TestTerminationHookHonorsHeartbeatTimeout(t *testing.T) {
+	m, clk := newTestMock(nil, asgcfg.LifecycleHook{Name: "drain", Transition: Terminating, HeartbeatTimeoutSec: 60, DefaultResult: Continue})
+	assertStates(t, m, InService, InService)
+
+	clk.Advance(10 * time.Minute)
+	assertStates(t, m, Terminated, TerminatingWait)
+
+	clk.Advance(45 * time.Second)
+	h.Ok(t, m.RecordLifecycleActionHeartbeat("drain", "", testInstanceID))
+	clk.Advance(45 * time.Second)
+	assertStates(t, m, Terminated, TerminatingWait)
+
+	clk.Advance(15 * time.Second)
+	assertStates(t, m, Terminated, Terminated)
+	err := m.RecordLifecycleActionHeartbeat("drain", "", testInstanceID)
+	h.Assert(t, err != nil, "Expected an error recording a heartbeat after the heartbeat timeout")
+}
+
+func TestWarmPoolSequence(t *testing.T) {
+	m, clk := newTestMock([]string{WarmedStopped + "=60", WarmedRunning + "=60", InService}, asgcfg.LifecycleHook{Name: "launch", Transition: Launching})
+	assertStates(t, m, WarmedStopped, WarmedPendingWait)
+	h.Ok(t, m.CompleteLifecycleAction("launch", "", testInstanceID, Continue))
+	assertStates(t, m, WarmedStopped, WarmedStopped)
+
+	clk.Advance(time.Minute)
+	assertStates(t, m, WarmedRunning, WarmedRunning)
+
+	// the launch hook runs again when the instance enters service from the warm pool
+	clk.Advance(time.Minute)
+	assertStates(t, m, InService, PendingWait)
+	h.Ok(t, m.CompleteLifecycleAction("launch", "", testInstanceID, Continue))
+	assertStates(t, m, InService, InService)
+
+	// the last state lasts until the termination delay
+	clk.Advance(7 * time.Minute)
+	assertStates(t, m, InService, InService)
+	clk.Advance(time.Minute)
+	assertStates(t, m, Terminated, Terminated)
+}
+
+func TestTimedLastStateTerminatesInstance(t *testing.T) {
+	m, clk := newTestMock([]string{WarmedHibernated + "=30", InService + "=900"})
+	clk.Advance(15 * time.Minute)
+	assertStates(t, m, InService, InService)
+	clk.Advance(30 * time.Second)
+	assertStates(t, m, Terminated, Terminated)
+}
+
+func TestValidateStates(t *testing.T) {
+	h.Assert(t, len(ValidateStates("states", []string{"Warmed:Stopped=60", "InService=600", "Terminated"})) == 0, "Expected a valid sequence of states to pass validation")
+
+	errs := ValidateStates("states", []string{"Pending", "Warmed:Running=soon", "Terminated", "InService=-1"})
+	h.Assert(t, len(errs) == 4, fmt.Sprintf("Expected 4 validation errors for an unknown state, invalid times and a state after Terminated, but was %d: %v", len(errs), errs))
+}
+
+func TestValidateLifecycleHooks(t *testing.T) {
+	valid := asgcfg.LifecycleHook{Name: "drain", Transition: Terminating}
+	h.Assert(t, len(ValidateLifecycleHooks("asglifecycle.lifecycle-hooks", []asgcfg.LifecycleHook{valid})) == 0, "Expected a valid lifecycle hook to pass validation")
+
+	invalid := []asgcfg.LifecycleHook{
+		valid,
+		{Name: "drain", Transition: "autoscaling:EC2_INSTANCE_STOPPING", HeartbeatTimeoutSec: 10, DefaultResult: "RETRY"},
+	}
+	errs := ValidateLifecycleHooks("asglifecycle.lifecycle-hooks", invalid)
+	h.Assert(t, len(errs) == 4, fmt.Sprintf("Expected 4 validation errors for name, transition, heartbeat timeout and default result, but was %d: %v", len(errs), errs))
+}
@@ -0,0 +1,31 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+// Config represents the configuration for the mock
+type Config struct {
+	// States is the sequence of target lifecycle states the instance goes through, each as STATE or STATE=SECONDS, the
+	// time spent in the state. The last state lasts until the termination delay or trigger time, unless its time is given.
+	States []string `mapstructure:"states"`
+	// LifecycleHooks hold the instance in a wait state when it launches or terminates, until the hook is completed
+	LifecycleHooks []LifecycleHook `mapstructure:"lifecycle-hooks"`
+}
+
+// LifecycleHook represents the configuration of a lifecycle hook of the auto scaling group
+type LifecycleHook struct {
+	Name                string `mapstructure:"name"`                  // The name of the hook, e.g. my-termination-hook
+	Transition          string `mapstructure:"transition"`            // autoscaling:EC2_INSTANCE_LAUNCHING or autoscaling:EC2_INSTANCE_TERMINATING
+	HeartbeatTimeoutSec int64  `mapstructure:"heartbeat-timeout-sec"` // The time to wait for a heartbeat or completion, 3600 seconds if not set
+	DefaultResult       string `mapstructure:"default-result"`        // The result when the heartbeat timeout passes, CONTINUE or ABANDON
+}
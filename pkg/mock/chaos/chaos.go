@@ -0,0 +1,201 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package chaos interrupts random clients of a mock at random times within a window, for resilience testing of node
+// termination handling. Decisions are derived from the seed and the client only, so a run is reproduced by configuring
+// the seed it logged, whatever order clients send their requests in.
+package chaos
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+)
+
+const (
+	// Terminate interrupts with a spot itn terminating the instance
+	Terminate = "terminate"
+	// Stop interrupts with a spot itn stopping the instance
+	Stop = "stop"
+	// Hibernate interrupts with a spot itn hibernating the instance
+	Hibernate = "hibernate"
+	// RebalanceOnly recommends a rebalance without a spot itn
+	RebalanceOnly = "rebalance-only"
+)
+
+// Actions are the actions of an interruption, in the order their weights are applied in
+var Actions = []string{Terminate, Stop, Hibernate, RebalanceOnly}
+
+// Decision is whether and how chaos mode interrupts a client
+type Decision struct {
+	InstanceID  string `json:"instance-id"`
+	Client      string `json:"client"`
+	Interrupted bool   `json:"interrupted"`
+	Action      string `json:"action,omitempty"`
+	// Time is when the rebalance recommendation and spot itn are served from
+	Time string `json:"time,omitempty"`
+	at   time.Time
+}
+
+// At returns when the rebalance recommendation and spot itn are served from
+func (d Decision) At() time.Time {
+	return d.at
+}
+
+// State is the seed of chaos mode and the decisions it made, in the order of the first request of each client
+type State struct {
+	Enabled   bool       `json:"enabled"`
+	Seed      int64      `json:"seed"`
+	Decisions []Decision `json:"decisions"`
+}
+
+// Planner decides which clients are interrupted, when and how. It is safe for concurrent use.
+type Planner struct {
+	mu         sync.Mutex
+	start      time.Time
+	c          cfg.Chaos
+	seed       int64
+	randomSeed int64
+	decisions  map[string]Decision
+	order      []string
+}
+
+// New returns a planner for the chaos config, whose window starts at the current mock time. A random seed is picked
+// if none is configured.
+func New(config cfg.Config, clk *clock.Clock) *Planner {
+	p := &Planner{
+		start:      clk.Now(),
+		randomSeed: rand.Int64N(1<<31) + 1,
+		decisions:  make(map[string]Decision),
+	}
+	p.SetConfig(config)
+	return p
+}
+
+// SetConfig applies the chaos config. Decisions already made are kept, so no client is interrupted twice.
+func (p *Planner) SetConfig(config cfg.Config) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := config.Chaos
+	seed := c.Seed
+	if seed == 0 {
+		seed = p.randomSeed
+	}
+	if c.Rate > 0 && (p.c.Rate <= 0 || seed != p.seed) {
+		log.Printf("Chaos mode interrupts %g of the clients between %ds and %ds after start, with seed %d", c.Rate, c.WindowStartSec, c.WindowEndSec, seed)
+	}
+	p.c, p.seed = c, seed
+}
+
+// Enabled returns whether chaos mode interrupts clients
+func (p *Planner) Enabled() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.c.Rate > 0
+}
+
+// Decide returns whether and how the client is interrupted while it is served the instance with the given id. The
+// decision is made and logged on the first call for the client and instance, and kept after that.
+func (p *Planner) Decide(instanceID string, client string) Decision {
+	key := instanceID + "/" + client
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if d, ok := p.decisions[key]; ok {
+		return d
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	r := rand.New(rand.NewPCG(uint64(p.seed), h.Sum64()))
+	d := Decision{InstanceID: instanceID, Client: client}
+	if r.Float64() < p.c.Rate {
+		offset := p.c.WindowStartSec + r.Int64N(max(p.c.WindowEndSec-p.c.WindowStartSec, 0)+1)
+		d.Interrupted, d.Action = true, p.action(r)
+		d.at = p.start.Add(time.Duration(offset) * time.Second)
+		d.Time = d.at.UTC().Format(time.RFC3339)
+		log.Printf("Chaos mode (seed %d) interrupts %s of %s with %s at %s", p.seed, client, instanceID, d.Action, d.Time)
+	} else {
+		log.Printf("Chaos mode (seed %d) does not interrupt %s of %s", p.seed, client, instanceID)
+	}
+	p.decisions[key] = d
+	p.order = append(p.order, key)
+	return d
+}
+
+// action picks an action by its weight, terminate if no weights are configured; callers hold p.mu
+func (p *Planner) action(r *rand.Rand) string {
+	total := 0
+	for _, a := range Actions {
+		total += max(p.c.Actions[a], 0)
+	}
+	if total == 0 {
+		return Terminate
+	}
+	n := r.IntN(total)
+	for _, a := range Actions {
+		if n -= max(p.c.Actions[a], 0); n < 0 {
+			return a
+		}
+	}
+	return Terminate
+}
+
+// State returns the seed and the decisions made so far
+func (p *Planner) State() State {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := State{Enabled: p.c.Rate > 0, Seed: p.seed, Decisions: make([]Decision, 0, len(p.order))}
+	for _, key := range p.order {
+		s.Decisions = append(s.Decisions, p.decisions[key])
+	}
+	return s
+}
+
+// ValidateChaos validates the chaos config and returns the validation errors, if any
+func ValidateChaos(keyPrefix string, c cfg.Chaos) []string {
+	var errStrings []string
+	if c.Rate < 0 || c.Rate > 1 {
+		errStrings = append(errStrings, e.FlagValidationError{
+			FlagName:     keyPrefix + "rate",
+			Allowed:      "the share of the clients interrupted, from 0 to 1",
+			InvalidValue: fmt.Sprint(c.Rate)}.Error(),
+		)
+	}
+	if c.WindowStartSec < 0 || c.WindowEndSec < c.WindowStartSec {
+		errStrings = append(errStrings, e.FlagValidationError{
+			FlagName:     keyPrefix + "window-end-sec",
+			Allowed:      "a window-start-sec of 0 or more seconds, and a window-end-sec not before it",
+			InvalidValue: fmt.Sprintf("%d to %d seconds", c.WindowStartSec, c.WindowEndSec)}.Error(),
+		)
+	}
+	for _, action := range slices.Sorted(maps.Keys(c.Actions)) {
+		if !slices.Contains(Actions, action) || c.Actions[action] < 0 {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     keyPrefix + "actions",
+				Allowed:      "weights of 0 or more for " + strings.Join(Actions, ","),
+				InvalidValue: fmt.Sprintf("%s: %d", action, c.Actions[action])}.Error(),
+			)
+		}
+	}
+	return errStrings
+}
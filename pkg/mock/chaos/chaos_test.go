@@ -0,0 +1,83 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package chaos
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+func TestDecisionsAreReproducibleWithSeed(t *testing.T) {
+	c := cfg.Config{Chaos: cfg.Chaos{Seed: 42, Rate: 0.5, WindowStartSec: 60, WindowEndSec: 600}}
+	clk := clock.New()
+	clk.Freeze()
+	first, second := New(c, clk), New(c, clk)
+	h.Assert(t, first.Enabled(), "Expected chaos mode to be enabled with a rate")
+
+	interrupted := 0
+	for i := 0; i < 200; i++ {
+		client := fmt.Sprintf("10.0.0.%d", i)
+		d := first.Decide("i-1234567890abcdef0", client)
+		// the second planner sees the clients in reverse order
+		second.Decide("i-1234567890abcdef0", fmt.Sprintf("10.0.0.%d", 199-i))
+		if d.Interrupted {
+			interrupted++
+			offset := d.At().Sub(clk.Now())
+			h.Assert(t, offset >= 60*time.Second && offset <= 600*time.Second, fmt.Sprintf("Expected %s to be interrupted within the window, but was at %s", client, d.Time))
+			h.Assert(t, d.Action == Terminate, fmt.Sprintf("Expected terminate without action weights, but was %s", d.Action))
+		}
+	}
+	h.Assert(t, interrupted > 70 && interrupted < 130, fmt.Sprintf("Expected about half of the clients to be interrupted, but were %d of 200", interrupted))
+	for i := 0; i < 200; i++ {
+		client := fmt.Sprintf("10.0.0.%d", i)
+		d, other := first.Decide("i-1234567890abcdef0", client), second.Decide("i-1234567890abcdef0", client)
+		h.Assert(t, d == other, fmt.Sprintf("Expected the same decision for %s with the same seed, but were %+v and %+v", client, d, other))
+	}
+	h.Assert(t, len(first.State().Decisions) == 200, "Expected every decision to be made once")
+}
+
+func TestActionsFollowWeights(t *testing.T) {
+	p := New(cfg.Config{Chaos: cfg.Chaos{Seed: 7, Rate: 1, Actions: map[string]int{Stop: 1, RebalanceOnly: 3}}}, clock.New())
+	counts := make(map[string]int)
+	for i := 0; i < 400; i++ {
+		counts[p.Decide("i-1234567890abcdef0", fmt.Sprintf("10.0.%d.%d", i/200, i%200)).Action]++
+	}
+	h.Assert(t, counts[Terminate] == 0 && counts[Hibernate] == 0, fmt.Sprintf("Expected only weighted actions, but were %v", counts))
+	h.Assert(t, counts[RebalanceOnly] > 2*counts[Stop], fmt.Sprintf("Expected about 3 rebalance-only per stop, but were %v", counts))
+}
+
+func TestRandomSeedIsKept(t *testing.T) {
+	p := New(cfg.Config{Chaos: cfg.Chaos{Rate: 1}}, clock.New())
+	seed := p.State().Seed
+	h.Assert(t, seed != 0, "Expected a random seed to be picked")
+	p.SetConfig(cfg.Config{Chaos: cfg.Chaos{Rate: 0.5}})
+	h.Assert(t, p.State().Seed == seed, "Expected the random seed to be kept across config changes")
+	p.SetConfig(cfg.Config{})
+	h.Assert(t, !p.Enabled(), "Expected chaos mode to be disabled without a rate")
+}
+
+func TestValidateChaos(t *testing.T) {
+	errStrings := ValidateChaos("chaos.", cfg.Chaos{Rate: 1.5, WindowStartSec: 60, WindowEndSec: 30, Actions: map[string]int{"reboot": 1, Stop: -1}})
+	h.Assert(t, len(errStrings) == 4, fmt.Sprintf("Expected 4 validation errors, but were %d: %v", len(errStrings), errStrings))
+	for i, key := range []string{"chaos.rate", "chaos.window-end-sec", "chaos.actions", "chaos.actions"} {
+		h.Assert(t, strings.Contains(errStrings[i], key), fmt.Sprintf("Expected an error for %s, but was %s", key, errStrings[i]))
+	}
+	h.Assert(t, len(ValidateChaos("chaos.", cfg.Chaos{})) == 0, "Expected the default config to be valid")
+}
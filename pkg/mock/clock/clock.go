@@ -0,0 +1,117 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package clock provides the mock time used for interruption delays, trigger times and token expiry. Mock time can be
+// moved forward, set or frozen, so tests do not have to wait for delays or TTLs to elapse.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the mock time: wall clock time shifted by an offset, or a fixed time while frozen.
+// It is safe for concurrent use.
+type Clock struct {
+	mu       sync.RWMutex
+	offset   time.Duration
+	frozen   bool
+	frozenAt time.Time
+
+	now func() time.Time // wall clock
+}
+
+// State represents the mock time and how it relates to wall clock time
+type State struct {
+	Now       time.Time `json:"now"`
+	OffsetSec int64     `json:"offset-sec"`
+	Frozen    bool      `json:"frozen"`
+}
+
+// New returns a clock telling wall clock time
+func New() *Clock {
+	return &Clock{now: time.Now}
+}
+
+// Now returns the mock time
+func (c *Clock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.nowLocked()
+}
+
+// Since returns the mock time elapsed since t
+func (c *Clock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Advance moves mock time by d, which may be negative
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.frozen {
+		c.frozenAt = c.frozenAt.Add(d)
+		return
+	}
+	c.offset += d
+}
+
+// Set sets the mock time to t. If the clock is not frozen, mock time keeps moving on from t.
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.frozen {
+		c.frozenAt = t
+		return
+	}
+	c.offset = t.Sub(c.now())
+}
+
+// Freeze stops mock time until Unfreeze is called
+func (c *Clock) Freeze() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.frozen {
+		c.frozenAt = c.nowLocked()
+		c.frozen = true
+	}
+}
+
+// Unfreeze lets mock time move on from the time it was frozen at
+func (c *Clock) Unfreeze() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.frozen {
+		c.offset = c.frozenAt.Sub(c.now())
+		c.frozen = false
+	}
+}
+
+// State returns the mock time, its offset from wall clock time and whether it is frozen
+func (c *Clock) State() State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.nowLocked()
+	return State{
+		Now:       now,
+		OffsetSec: int64(now.Sub(c.now()) / time.Second),
+		Frozen:    c.frozen,
+	}
+}
+
+func (c *Clock) nowLocked() time.Time {
+	if c.frozen {
+		return c.frozenAt
+	}
+	return c.now().Add(c.offset)
+}
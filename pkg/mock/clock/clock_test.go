@@ -0,0 +1,61 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package clock
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+var wallClock = time.Date(2020, 1, 7, 1, 0, 0, 0, time.UTC)
+
+func newTestClock() (*Clock, *time.Time) {
+	wall := wallClock
+	return &Clock{now: func() time.Time { return wall }}, &wall
+}
+
+func TestAdvance(t *testing.T) {
+	c, wall := newTestClock()
+	c.Advance(2 * time.Minute)
+	h.Assert(t, c.Now().Equal(wallClock.Add(2*time.Minute)), fmt.Sprintf("Expected mock time 2m ahead, but was %s", c.Now()))
+
+	*wall = wall.Add(time.Second)
+	h.Assert(t, c.Now().Equal(wallClock.Add(2*time.Minute+time.Second)), fmt.Sprintf("Expected mock time to move with wall clock, but was %s", c.Now()))
+	h.Assert(t, c.State().OffsetSec == 120, fmt.Sprintf("Expected offset of 120s, but was %d", c.State().OffsetSec))
+}
+
+func TestSet(t *testing.T) {
+	c, _ := newTestClock()
+	target := wallClock.Add(6 * time.Hour)
+	c.Set(target)
+	h.Assert(t, c.Now().Equal(target), fmt.Sprintf("Expected mock time %s, but was %s", target, c.Now()))
+}
+
+func TestFreeze(t *testing.T) {
+	c, wall := newTestClock()
+	c.Freeze()
+	*wall = wall.Add(time.Hour)
+	h.Assert(t, c.Now().Equal(wallClock), fmt.Sprintf("Expected frozen mock time %s, but was %s", wallClock, c.Now()))
+
+	c.Advance(time.Minute)
+	h.Assert(t, c.Now().Equal(wallClock.Add(time.Minute)), fmt.Sprintf("Expected frozen mock time to advance, but was %s", c.Now()))
+
+	c.Unfreeze()
+	*wall = wall.Add(time.Second)
+	h.Assert(t, c.Now().Equal(wallClock.Add(time.Minute+time.Second)), fmt.Sprintf("Expected mock time to move on from frozen time, but was %s", c.Now()))
+	h.Assert(t, !c.State().Frozen, "Expected clock not to be frozen")
+}
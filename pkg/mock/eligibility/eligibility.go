@@ -0,0 +1,294 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package eligibility decides which clients of a mock are served the notices of a feature, e.g. spot interruption
+// notices, so that only some of the nodes of a cluster are interrupted. Every feature tracks its clients on its own.
+package eligibility
+
+import (
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+const (
+	// First makes the first clients eligible, up to the count of the feature
+	First = "first"
+	// Percent makes a share of the clients eligible, picked by a hash of the seed and the client IP
+	Percent = "percent"
+	// Waves makes the clients eligible in waves, which they are assigned round-robin in the order of their first request
+	Waves = "waves"
+)
+
+var (
+	// Strategies are the strategies deciding which clients are eligible
+	Strategies = []string{First, Percent, Waves}
+	// Features are the features whose clients are tracked
+	Features = []string{"spot", "events", "asglifecycle"}
+)
+
+// Client is a client that requested the notices of a feature, with the reason it is eligible or not
+type Client struct {
+	IP        string `json:"ip"`
+	Eligible  bool   `json:"eligible"`
+	Reason    string `json:"reason"`
+	FirstSeen string `json:"first-seen"`
+	Wave      *int   `json:"wave,omitempty"`
+}
+
+// State is the eligibility of the clients of a feature
+type State struct {
+	Feature  string `json:"feature"`
+	Strategy string `json:"strategy"`
+	// Count is the number of clients eligible with the first strategy, -1 if there is no limit
+	Count   int      `json:"count"`
+	Clients []Client `json:"clients"`
+}
+
+// client is a client in the order of its first request
+type client struct {
+	ip        string
+	firstSeen time.Time
+	eligible  bool
+	reason    string
+	// slot tells whether the client is one of the first clients, wave is the wave of the client or -1 if not assigned
+	slot bool
+	wave int
+}
+
+// Tracker tracks the clients of a feature and decides whether they are eligible. It is safe for concurrent use.
+type Tracker struct {
+	mu          sync.Mutex
+	feature     string
+	clock       *clock.Clock
+	start       time.Time
+	c           cfg.Eligibility
+	mockIPCount int
+	allow, deny []*net.IPNet
+	clients     map[string]*client
+	order       []*client
+	slots       int
+	waves       int
+}
+
+// New returns a tracker of the clients of the feature. Waves start from the current mock time.
+func New(feature string, config cfg.Config, clk *clock.Clock) *Tracker {
+	t := &Tracker{
+		feature: feature,
+		clock:   clk,
+		start:   clk.Now(),
+		clients: make(map[string]*client),
+	}
+	t.SetConfig(config)
+	return t
+}
+
+// SetConfig applies the eligibility config. Clients keep their slots and waves, so eligible clients stay eligible
+// unless they are denied or the strategy changes.
+func (t *Tracker) SetConfig(config cfg.Config) {
+	allow, deny := parseNets(config.Eligibility.Allow), parseNets(config.Eligibility.Deny)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.c, t.mockIPCount = config.Eligibility, config.MockIPCount
+	t.allow, t.deny = allow, deny
+}
+
+// Eligible returns whether the client sending the request is served the notices of the feature, and why
+func (t *Tracker) Eligible(req *http.Request) (bool, string) {
+	ip := server.ClientIP(req)
+	now := t.clock.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cl, ok := t.clients[ip]
+	if !ok {
+		cl = &client{ip: ip, firstSeen: now, wave: -1}
+		t.clients[ip] = cl
+		t.order = append(t.order, cl)
+	}
+	cl.eligible, cl.reason = t.decide(cl, now)
+	return cl.eligible, cl.reason
+}
+
+// IsEligible returns whether the client with the given IP was eligible on its last request. Clients that did not
+// request the notices of the feature are not.
+func (t *Tracker) IsEligible(ip string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cl, ok := t.clients[ip]
+	return ok && cl.eligible
+}
+
+// WouldBeEligible returns whether the client with the given IP would be eligible if it requested the notices of the
+// feature now. Unlike Eligible, it does not track the client, so it does not take a slot or wave from other clients.
+func (t *Tracker) WouldBeEligible(ip string) bool {
+	now := t.clock.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cl := client{ip: ip, wave: -1}
+	if tracked, ok := t.clients[ip]; ok {
+		cl = *tracked
+	}
+	// decide assigns slots and waves to new clients; they are given back, as cl is not tracked
+	slots, waves := t.slots, t.waves
+	eligible, _ := t.decide(&cl, now)
+	t.slots, t.waves = slots, waves
+	return eligible
+}
+
+// decide returns whether the client is eligible at the given time, and why; callers hold t.mu
+func (t *Tracker) decide(cl *client, now time.Time) (bool, string) {
+	if ip := net.ParseIP(cl.ip); ip != nil {
+		if server.ContainsIP(t.deny, ip) {
+			return false, "denied"
+		}
+		if server.ContainsIP(t.allow, ip) {
+			return true, "allowed"
+		}
+	}
+
+	switch t.c.Strategy {
+	case Percent:
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%d/%s", t.c.Seed, cl.ip)
+		bucket := int(h.Sum64() % 100)
+		if bucket < t.c.Percent {
+			return true, fmt.Sprintf("bucket %d is within %d percent", bucket, t.c.Percent)
+		}
+		return false, fmt.Sprintf("bucket %d is not within %d percent", bucket, t.c.Percent)
+	case Waves:
+		if cl.wave < 0 {
+			cl.wave = t.waves % max(t.c.Waves, 1)
+			t.waves++
+		}
+		waveTime := t.start.Add(time.Duration(int64(cl.wave)*t.c.WaveIntervalSec) * time.Second)
+		if now.Before(waveTime) {
+			return false, fmt.Sprintf("wave %d starts at %s", cl.wave, waveTime.UTC().Format(time.RFC3339))
+		}
+		return true, fmt.Sprintf("wave %d started at %s", cl.wave, waveTime.UTC().Format(time.RFC3339))
+	default:
+		count := t.count()
+		if count < 0 {
+			return true, "no limit"
+		}
+		if !cl.slot && t.slots < count {
+			cl.slot = true
+			t.slots++
+		}
+		if cl.slot {
+			return true, fmt.Sprintf("one of the first %d clients", count)
+		}
+		return false, fmt.Sprintf("the max number of IPs configured (%d) has been reached", count)
+	}
+}
+
+// count returns the number of clients eligible with the first strategy, -1 if there is no limit; callers hold t.mu
+func (t *Tracker) count() int {
+	if n, ok := t.c.Counts[t.feature]; ok {
+		return n
+	}
+	return t.mockIPCount
+}
+
+// State returns the clients of the feature in the order of their first request, as decided on their last request
+func (t *Tracker) State() State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := State{Feature: t.feature, Strategy: t.c.Strategy, Count: t.count(), Clients: make([]Client, 0, len(t.order))}
+	if s.Strategy == "" {
+		s.Strategy = First
+	}
+	if s.Count < 0 {
+		s.Count = -1
+	}
+	for _, cl := range t.order {
+		c := Client{IP: cl.ip, Eligible: cl.eligible, Reason: cl.reason, FirstSeen: cl.firstSeen.UTC().Format(time.RFC3339)}
+		if cl.wave >= 0 {
+			wave := cl.wave
+			c.Wave = &wave
+		}
+		s.Clients = append(s.Clients, c)
+	}
+	return s
+}
+
+// parseNets parses IPs and CIDRs, ignoring invalid ones
+func parseNets(clients []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, c := range clients {
+		if ipNet, err := server.ParseIPNet(c); err == nil {
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets
+}
+
+// ValidateEligibility validates the eligibility config and returns the validation errors, if any
+func ValidateEligibility(keyPrefix string, c cfg.Eligibility) []string {
+	var errStrings []string
+	if c.Strategy != "" && !slices.Contains(Strategies, c.Strategy) {
+		errStrings = append(errStrings, e.FlagValidationError{
+			FlagName:     keyPrefix + "strategy",
+			Allowed:      strings.Join(Strategies, ","),
+			InvalidValue: c.Strategy}.Error(),
+		)
+	}
+	validateNets := func(key string, clients []string) {
+		for _, client := range clients {
+			if _, err := server.ParseIPNet(client); err != nil {
+				errStrings = append(errStrings, e.FlagValidationError{
+					FlagName:     keyPrefix + key,
+					Allowed:      "IPs or CIDRs, e.g. 10.244.1.5 or fd00::/64",
+					InvalidValue: client}.Error(),
+				)
+			}
+		}
+	}
+	validateNets("allow", c.Allow)
+	validateNets("deny", c.Deny)
+	for _, feature := range slices.Sorted(maps.Keys(c.Counts)) {
+		if !slices.Contains(Features, feature) {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     keyPrefix + "counts",
+				Allowed:      strings.Join(Features, ","),
+				InvalidValue: feature}.Error(),
+			)
+		}
+	}
+	if c.Percent < 0 || c.Percent > 100 {
+		errStrings = append(errStrings, e.FlagValidationError{
+			FlagName:     keyPrefix + "percent",
+			Allowed:      "0-100",
+			InvalidValue: strconv.Itoa(c.Percent)}.Error(),
+		)
+	}
+	if c.Strategy == Waves && (c.Waves < 1 || c.WaveIntervalSec < 0) {
+		errStrings = append(errStrings, e.FlagValidationError{
+			FlagName:     keyPrefix + "waves",
+			Allowed:      "at least 1 wave, with a wave-interval-sec of 0 or more seconds",
+			InvalidValue: fmt.Sprintf("%d waves every %d seconds", c.Waves, c.WaveIntervalSec)}.Error(),
+		)
+	}
+	return errStrings
+}
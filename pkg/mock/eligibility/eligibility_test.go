@@ -0,0 +1,138 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eligibility
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+func eligible(t *Tracker, remoteAddr string) bool {
+	req := httptest.NewRequest("GET", "/latest/meta-data/spot/instance-action", nil)
+	req.RemoteAddr = remoteAddr
+	ok, _ := t.Eligible(req)
+	return ok
+}
+
+func TestFirstClientsAreEligible(t *testing.T) {
+	tracker := New("spot", cfg.Config{MockIPCount: 2}, clock.New())
+	h.Assert(t, eligible(tracker, "[fd00::1]:4000"), "Expected the first client to be eligible")
+	h.Assert(t, eligible(tracker, "[fd00::2]:4000"), "Expected an IPv6 client on another address to be counted separately")
+	h.Assert(t, !eligible(tracker, "10.0.0.3:4000"), "Expected a client beyond the count not to be eligible")
+	h.Assert(t, eligible(tracker, "[fd00::1]:5000"), "Expected an eligible client to stay eligible")
+
+	tracker.SetConfig(cfg.Config{MockIPCount: 2, Eligibility: cfg.Eligibility{Counts: map[string]int{"spot": 3, "events": 0}}})
+	h.Assert(t, eligible(tracker, "10.0.0.3:4000"), "Expected the count of the feature to take priority over mock-ip-count")
+	tracker.SetConfig(cfg.Config{MockIPCount: -1})
+	h.Assert(t, eligible(tracker, "10.0.0.4:4000"), "Expected every client to be eligible with a negative count")
+}
+
+func TestWouldBeEligibleDoesNotTrackClients(t *testing.T) {
+	tracker := New("spot", cfg.Config{MockIPCount: 1}, clock.New())
+	h.Assert(t, tracker.WouldBeEligible("10.0.0.1"), "Expected a new client to be eligible while a slot is free")
+	h.Assert(t, tracker.WouldBeEligible("10.0.0.2"), "Expected checking a client not to take the slot")
+	h.Assert(t, len(tracker.State().Clients) == 0, "Expected checked clients not to be tracked")
+
+	h.Assert(t, eligible(tracker, "10.0.0.2:4000"), "Expected the first requesting client to take the slot")
+	h.Assert(t, tracker.WouldBeEligible("10.0.0.2"), "Expected the client with the slot to be eligible")
+	h.Assert(t, !tracker.WouldBeEligible("10.0.0.1"), "Expected a new client not to be eligible once the slots are taken")
+}
+
+func TestAllowAndDenyTakePriorityOverStrategy(t *testing.T) {
+	tracker := New("events", cfg.Config{Eligibility: cfg.Eligibility{
+		Allow: []string{"10.0.0.0/24"},
+		Deny:  []string{"10.0.0.9", "fd00::/64"},
+	}}, clock.New())
+	h.Assert(t, eligible(tracker, "10.0.0.5:4000"), "Expected an allowed client to be eligible beyond the count")
+	h.Assert(t, !eligible(tracker, "10.0.0.9:4000"), "Expected a denied client not to be eligible, even if allowed")
+	h.Assert(t, !eligible(tracker, "[fd00::5]:4000"), "Expected a client in a denied CIDR not to be eligible")
+	h.Assert(t, !eligible(tracker, "10.0.1.5:4000"), "Expected a client neither allowed nor denied to be subject to the count")
+}
+
+func TestPercentIsStableForSeed(t *testing.T) {
+	c := cfg.Config{Eligibility: cfg.Eligibility{Strategy: Percent, Percent: 30, Seed: 7}}
+	first, second := New("spot", c, clock.New()), New("spot", c, clock.New())
+	count := 0
+	for i := 0; i < 1000; i++ {
+		addr := fmt.Sprintf("10.0.%d.%d:4000", i/250, i%250)
+		ok := eligible(first, addr)
+		h.Assert(t, ok == eligible(second, addr), fmt.Sprintf("Expected %s to be picked the same way with the same seed", addr))
+		if ok {
+			count++
+		}
+	}
+	h.Assert(t, count > 230 && count < 370, fmt.Sprintf("Expected about 30 percent of the clients to be eligible, but were %d of 1000", count))
+
+	c.Eligibility.Percent = 100
+	first.SetConfig(c)
+	h.Assert(t, eligible(first, "10.9.9.9:4000"), "Expected every client to be eligible with 100 percent")
+}
+
+func TestWavesStartOneAfterAnother(t *testing.T) {
+	clk := clock.New()
+	tracker := New("asglifecycle", cfg.Config{Eligibility: cfg.Eligibility{Strategy: Waves, Waves: 2, WaveIntervalSec: 60}}, clk)
+	h.Assert(t, eligible(tracker, "10.0.0.1:4000"), "Expected the first client to be in the first wave")
+	h.Assert(t, !eligible(tracker, "10.0.0.2:4000"), "Expected the second client to wait for the second wave")
+	h.Assert(t, eligible(tracker, "10.0.0.3:4000"), "Expected the third client to be in the first wave again")
+
+	clk.Advance(time.Minute)
+	h.Assert(t, eligible(tracker, "10.0.0.2:4000"), "Expected the second client to be eligible once the second wave started")
+
+	state := tracker.State()
+	h.Assert(t, state.Strategy == Waves && len(state.Clients) == 3, fmt.Sprintf("Expected the state of 3 clients, but was %+v", state))
+	h.Assert(t, *state.Clients[1].Wave == 1 && strings.HasPrefix(state.Clients[1].Reason, "wave 1 started"), fmt.Sprintf("Expected the second client in wave 1, but was %+v", state.Clients[1]))
+}
+
+func TestEligibleIsSafeForConcurrentUse(t *testing.T) {
+	tracker := New("spot", cfg.Config{MockIPCount: 10}, clock.New())
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			eligible(tracker, fmt.Sprintf("10.0.0.%d:4000", i))
+		}(i)
+	}
+	wg.Wait()
+
+	count := 0
+	for _, c := range tracker.State().Clients {
+		if c.Eligible {
+			count++
+		}
+	}
+	h.Assert(t, count == 10, fmt.Sprintf("Expected exactly 10 eligible clients, but were %d", count))
+}
+
+func TestValidateEligibility(t *testing.T) {
+	errStrings := ValidateEligibility("eligibility.", cfg.Eligibility{
+		Strategy: Waves,
+		Deny:     []string{"10.0.0.300"},
+		Counts:   map[string]int{"spot": 1, "userdata": 1},
+		Percent:  101,
+	})
+	h.Assert(t, len(errStrings) == 4, fmt.Sprintf("Expected 4 validation errors, but were %d: %v", len(errStrings), errStrings))
+	for i, key := range []string{"eligibility.deny", "eligibility.counts", "eligibility.percent", "eligibility.waves"} {
+		h.Assert(t, strings.Contains(errStrings[i], key), fmt.Sprintf("Expected an error for %s, but was %s", key, errStrings[i]))
+	}
+	h.Assert(t, len(ValidateEligibility("eligibility.", cfg.Eligibility{})) == 0, "Expected the default config to be valid")
+}
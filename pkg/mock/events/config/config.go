@@ -20,4 +20,16 @@ type Config struct {
 	NotBefore         string `mapstructure:"not-before"`          //  The earliest start time for the scheduled event
 	NotAfter          string `mapstructure:"not-after"`           // The latest end time for the scheduled event
 	NotBeforeDeadline string `mapstructure:"not-before-deadline"` // The deadline for starting the event
+	// Scheduled replaces the single event above with a list of events, if not empty
+	Scheduled []Event `mapstructure:"scheduled"`
+}
+
+// Event represents the configuration of one of several scheduled events
+type Event struct {
+	EventCode         string `mapstructure:"code" json:"code"`
+	EventID           string `mapstructure:"event-id" json:"event-id"`
+	EventState        string `mapstructure:"state" json:"state"`
+	NotBefore         string `mapstructure:"not-before" json:"not-before"`                   //  The earliest start time for the scheduled event
+	NotAfter          string `mapstructure:"not-after" json:"not-after"`                     // The latest end time for the scheduled event
+	NotBeforeDeadline string `mapstructure:"not-before-deadline" json:"not-before-deadline"` // The deadline for starting the event
 }
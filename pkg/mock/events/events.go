@@ -14,12 +14,18 @@
 package events
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/eligibility"
+	eventscfg "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events/config"
 	t "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events/internal/types"
 	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
 )
@@ -27,45 +33,113 @@ import (
 const (
 	descriptionPrefix = "The instance is scheduled for "
 	timeLayout        = "2 Jan 2006 15:04:05 GMT"
+
+	// Active events are served as scheduled events
+	Active = "active"
+	// Completed events are served in the maintenance history
+	Completed = "completed"
+	// Canceled events are served in the maintenance history
+	Canceled = "canceled"
 )
 
 var (
-	eligibleIPs        = make(map[string]bool)
-	appStartTime int64 = time.Now().Unix()
-	c            cfg.Config
+	// Codes are the codes of scheduled events
+	Codes = []string{"instance-reboot", "system-reboot", "system-maintenance", "instance-retirement", "instance-stop"}
+	// States are the states of scheduled events
+	States = []string{Active, Completed, Canceled}
+
+	// historyDescriptionPrefixes prefix the descriptions of events in the maintenance history, as IMDS does
+	historyDescriptionPrefixes = map[string]string{Completed: "[Completed] ", Canceled: "[Canceled] "}
 )
 
-// Mock starts scheduled events mock
-func Mock(config cfg.Config) {
-	SetConfig(config)
-	server.ListenAndServe(config.Server.HostName, config.Server.Port)
+// Mock serves scheduled maintenance events
+type Mock struct {
+	mu           sync.RWMutex
+	clock        *clock.Clock
+	c            cfg.Config
+	eligibility  *eligibility.Tracker
+	appStartTime int64
+	// runtime holds the events added or changed at runtime, which replace the events in config if not nil
+	runtime []eventscfg.Event
+}
+
+// New returns a scheduled events mock, starting its delay from the current mock time
+func New(config cfg.Config, clk *clock.Clock) *Mock {
+	return &Mock{
+		clock:        clk,
+		c:            config,
+		eligibility:  eligibility.New("events", config, clk),
+		appStartTime: clk.Now().Unix(),
+	}
 }
 
 // SetConfig sets the local config
-func SetConfig(config cfg.Config) {
-	c = config
+func (m *Mock) SetConfig(config cfg.Config) {
+	m.mu.Lock()
+	m.c = config
+	m.mu.Unlock()
+	m.eligibility.SetConfig(config)
+}
+
+// Eligibility returns the tracker deciding which clients are served the mock
+func (m *Mock) Eligibility() *eligibility.Tracker {
+	return m.eligibility
+}
+
+// Events returns a copy of the scheduled events currently served, including completed and canceled events
+func (m *Mock) Events() []eventscfg.Event {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.runtime != nil {
+		return slices.Clone(m.runtime)
+	}
+	return Scheduled(m.c)
+}
+
+// Update applies fn to a copy of the scheduled events currently served and serves the result from then on, replacing
+// the events in config, unless fn returns an error or the result is invalid. Events changed at runtime are served
+// right away, regardless of the mock delay or trigger time.
+func (m *Mock) Update(fn func(scheduled []eventscfg.Event) ([]eventscfg.Event, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	scheduled := slices.Clone(m.runtime)
+	if scheduled == nil {
+		scheduled = Scheduled(m.c)
+	}
+	scheduled, err := fn(scheduled)
+	if err != nil {
+		return err
+	}
+	if errStrings := ValidateEvents("scheduled", scheduled); len(errStrings) > 0 {
+		for i := range errStrings {
+			errStrings[i] = strings.TrimSpace(errStrings[i])
+		}
+		return errors.New(strings.Join(errStrings, "\n"))
+	}
+	m.runtime = slices.Clip(scheduled)
+	return nil
 }
 
 // Handler processes http requests
-func Handler(res http.ResponseWriter, req *http.Request) {
+func (m *Mock) Handler(res http.ResponseWriter, req *http.Request) {
+	m.mu.RLock()
+	c, runtime := m.c, m.runtime
+	m.mu.RUnlock()
 	log.Printf("RemoteAddr: %s sent request to mock scheduled event: %s\n", req.URL.Path, req.RemoteAddr)
 
-	// specify negative value to disable this feature
-	if c.MockIPCount >= 0 {
-		// req.RemoteAddr is formatted as IP:port
-		requestIP := strings.Split(req.RemoteAddr, ":")[0]
-		if !eligibleIPs[requestIP] {
-			if len(eligibleIPs) < c.MockIPCount {
-				eligibleIPs[requestIP] = true
-			} else {
-				log.Printf("Requesting IP %s is not eligible for Scheduled Event because the max number of IPs configured (%d) has been reached.\n", requestIP, c.MockIPCount)
-				server.ReturnNotFoundResponse(res)
-				return
-			}
-		}
+	if eligible, reason := m.eligibility.Eligible(req); !eligible {
+		log.Printf("Requesting IP %s is not eligible for Scheduled Event: %s\n", server.ClientIP(req), reason)
+		server.ReturnNotFoundResponse(res)
+		return
+	}
+
+	if runtime != nil {
+		scheduled, history := listEvents(runtime, m.clock.Now())
+		returnEvents(res, req, c, scheduled, history)
+		return
 	}
 
-	requestTime := time.Now().Unix()
+	requestTime := m.clock.Now().Unix()
 
 	if c.MockTriggerTime != "" {
 		triggerTime, _ := time.Parse(time.RFC3339, c.MockTriggerTime)
@@ -78,7 +152,7 @@ func Handler(res http.ResponseWriter, req *http.Request) {
 		}
 	} else {
 		delayInSeconds := c.MockDelayInSec
-		delayRemaining := delayInSeconds - (requestTime - appStartTime)
+		delayRemaining := delayInSeconds - (requestTime - m.appStartTime)
 		if delayRemaining > 0 {
 			log.Printf("Delaying the response by %ds as requested. The mock response will be available in %ds. Returning `notFoundResponse` for now", delayInSeconds, delayRemaining)
 			server.ReturnNotFoundResponse(res)
@@ -87,10 +161,101 @@ func Handler(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// return mock response after the delay or trigger time has elapsed
-	server.FormatAndReturnJSONResponse(res, getMetadata())
+	scheduled, history := getEvents(c, m.clock.Now())
+	returnEvents(res, req, c, scheduled, history)
+}
+
+// Active returns the codes of the scheduled events served to the client of the request, if the client would be
+// eligible for them. It does not make the client a client of scheduled events.
+func (m *Mock) Active(req *http.Request) []string {
+	m.mu.RLock()
+	c, runtime := m.c, m.runtime
+	m.mu.RUnlock()
+	if !m.eligibility.WouldBeEligible(server.ClientIP(req)) {
+		return nil
+	}
+
+	var scheduled []t.Event
+	if runtime != nil {
+		scheduled, _ = listEvents(runtime, m.clock.Now())
+	} else if m.delayRemaining(c) <= 0 {
+		scheduled, _ = getEvents(c, m.clock.Now())
+	}
+	var codes []string
+	for _, e := range scheduled {
+		if e.State == Active {
+			codes = append(codes, e.Code)
+		}
+	}
+	return codes
+}
+
+// delayRemaining returns the seconds left until the events in config are served
+func (m *Mock) delayRemaining(c cfg.Config) int64 {
+	requestTime := m.clock.Now().Unix()
+	if c.MockTriggerTime != "" {
+		triggerTime, _ := time.Parse(time.RFC3339, c.MockTriggerTime)
+		return triggerTime.Unix() - requestTime
+	}
+	return c.MockDelayInSec - (requestTime - m.appStartTime)
+}
+
+// returnEvents returns the scheduled events or the maintenance history, depending on the requested path
+func returnEvents(res http.ResponseWriter, req *http.Request, c cfg.Config, scheduled []t.Event, history []t.Event) {
+	if req.URL.Path == c.Metadata.Paths.EventsHistory {
+		server.FormatAndReturnJSONResponse(res, history)
+		return
+	}
+	server.FormatAndReturnJSONResponse(res, scheduled)
+}
+
+// getEvents returns the scheduled events and the maintenance history at the given time. Active events are completed
+// once their NotAfter time has passed; completed and canceled events are history.
+func getEvents(c cfg.Config, now time.Time) ([]t.Event, []t.Event) {
+	if len(c.EventsConfig.Scheduled) == 0 {
+		// the single event configured by flags is served as configured, regardless of its state and window
+		return getMetadata(c), []t.Event{}
+	}
+	return listEvents(c.EventsConfig.Scheduled, now)
+}
+
+// listEvents splits a list of events into the scheduled events and the maintenance history at the given time
+func listEvents(events []eventscfg.Event, now time.Time) ([]t.Event, []t.Event) {
+	scheduled, history := []t.Event{}, []t.Event{}
+	for _, e := range events {
+		state := e.EventState
+		if notAfter, err := time.Parse(time.RFC3339, e.NotAfter); state == Active && err == nil && !now.Before(notAfter) {
+			state = Completed
+		}
+		event := t.Event{
+			Code:              e.EventCode,
+			Description:       descriptionPrefix + e.EventCode,
+			EventID:           e.EventID,
+			State:             state,
+			NotBefore:         formatTime(e.NotBefore),
+			NotAfter:          formatTime(e.NotAfter),
+			NotBeforeDeadline: formatTime(e.NotBeforeDeadline),
+		}
+		if state == Active {
+			scheduled = append(scheduled, event)
+		} else {
+			event.Description = historyDescriptionPrefixes[state] + event.Description
+			history = append(history, event)
+		}
+	}
+	return scheduled, history
+}
+
+// formatTime formats an RFC3339 time the way IMDS formats event times; empty times stay empty
+func formatTime(rfc3339 string) string {
+	if rfc3339 == "" {
+		return ""
+	}
+	tm, _ := time.Parse(time.RFC3339, rfc3339)
+	return tm.UTC().Format(timeLayout)
 }
 
-func getMetadata() []t.Event {
+func getMetadata(c cfg.Config) []t.Event {
 	md := c.Metadata.Values
 	se := c.EventsConfig
 
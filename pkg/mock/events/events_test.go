@@ -0,0 +1,114 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package events
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	eventscfg "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events/internal/types"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+func eventIDs(events []types.Event) []string {
+	ids := []string{}
+	for _, e := range events {
+		ids = append(ids, e.EventID)
+	}
+	return ids
+}
+
+func TestGetEventsMovesEventsIntoHistory(t *testing.T) {
+	var c cfg.Config
+	c.EventsConfig.Scheduled = []eventscfg.Event{
+		{EventCode: "system-reboot", EventID: "upcoming", EventState: Active, NotBefore: "2020-01-02T00:00:00Z", NotAfter: "2020-01-03T00:00:00Z"},
+		{EventCode: "instance-stop", EventID: "ongoing", EventState: Active, NotBefore: "2020-01-01T00:00:00Z", NotAfter: "2020-01-01T12:00:00Z"},
+		{EventCode: "instance-reboot", EventID: "canceled", EventState: Canceled, NotBefore: "2020-01-02T00:00:00Z"},
+	}
+	now, _ := time.Parse(time.RFC3339, "2020-01-01T06:00:00Z")
+
+	scheduled, history := getEvents(c, now)
+	h.ItemsMatch(t, []string{"upcoming", "ongoing"}, eventIDs(scheduled))
+	h.ItemsMatch(t, []string{"canceled"}, eventIDs(history))
+	h.Assert(t, history[0].Description == "[Canceled] The instance is scheduled for instance-reboot", fmt.Sprintf("Unexpected description of a canceled event: %s", history[0].Description))
+	h.Assert(t, history[0].NotAfter == "", fmt.Sprintf("Expected no NotAfter for an event without end time, but was %s", history[0].NotAfter))
+
+	scheduled, history = getEvents(c, now.Add(6*time.Hour))
+	h.ItemsMatch(t, []string{"upcoming"}, eventIDs(scheduled))
+	h.ItemsMatch(t, []string{"ongoing", "canceled"}, eventIDs(history))
+	for _, e := range history {
+		if e.EventID == "ongoing" {
+			h.Assert(t, e.State == Completed, fmt.Sprintf("Expected the event to be completed once NotAfter passed, but was %s", e.State))
+			h.Assert(t, e.NotAfter == "1 Jan 2020 12:00:00 GMT", fmt.Sprintf("Unexpected NotAfter %s", e.NotAfter))
+		}
+	}
+}
+
+func TestGetEventsServesSingleEventAsConfigured(t *testing.T) {
+	var c cfg.Config
+	c.EventsConfig = eventscfg.Config{EventCode: "instance-stop", EventState: Canceled, NotBefore: "2020-01-01T00:00:00Z", NotAfter: "2020-01-01T12:00:00Z", NotBeforeDeadline: "2020-01-02T00:00:00Z"}
+
+	scheduled, history := getEvents(c, time.Now())
+	h.Assert(t, len(scheduled) == 1 && scheduled[0].State == Canceled, "Expected the single event to be scheduled in its configured state")
+	h.Assert(t, len(history) == 0, "Expected an empty history for the single event")
+}
+
+func TestValidateEvents(t *testing.T) {
+	valid := eventscfg.Event{EventCode: "instance-stop", EventID: "instance-event-1", EventState: Active, NotBefore: "2020-01-01T01:03:47Z"}
+	h.Assert(t, len(ValidateEvents("events.scheduled", []eventscfg.Event{valid})) == 0, "Expected a valid scheduled event to pass validation")
+
+	invalid := []eventscfg.Event{
+		valid,
+		{EventCode: "instance-launch", EventID: "instance-event-1", EventState: "pending", NotBefore: "2020-01-01", NotAfter: "tomorrow"},
+	}
+	errs := ValidateEvents("events.scheduled", invalid)
+	h.Assert(t, len(errs) == 5, fmt.Sprintf("Expected 5 validation errors for code, state, duplicate id, not-before and not-after, but was %d: %v", len(errs), errs))
+}
+
+func TestScheduledSeedsListWithSingleEvent(t *testing.T) {
+	var c cfg.Config
+	c.EventsConfig.EventCode, c.EventsConfig.EventState, c.EventsConfig.NotBefore = "instance-stop", Active, "2020-01-01T00:00:00Z"
+	c.Metadata.Values.EventID = "instance-event-1"
+
+	expected := []eventscfg.Event{{EventCode: "instance-stop", EventID: "instance-event-1", EventState: Active, NotBefore: "2020-01-01T00:00:00Z"}}
+	h.Assert(t, fmt.Sprint(Scheduled(c)) == fmt.Sprint(expected), fmt.Sprintf("Expected %v, but was %v", expected, Scheduled(c)))
+
+	c.EventsConfig.Scheduled = []eventscfg.Event{{EventID: "listed"}}
+	scheduled := Scheduled(c)
+	scheduled[0].EventID = "changed"
+	h.Assert(t, c.EventsConfig.Scheduled[0].EventID == "listed", "Expected Scheduled to return a copy of the list")
+}
+
+func TestActiveDoesNotRegisterClients(t *testing.T) {
+	var c cfg.Config
+	c.MockIPCount = 1
+	c.EventsConfig.Scheduled = []eventscfg.Event{{EventCode: "instance-stop", EventID: "instance-event-1", EventState: Active, NotBefore: "2020-01-01T00:00:00Z"}}
+	m := New(c, clock.New())
+	bystander := httptest.NewRequest("GET", "/latest/meta-data/instance-action", nil)
+	bystander.RemoteAddr = "10.0.0.1:4000"
+	client := httptest.NewRequest("GET", "/latest/meta-data/events/maintenance/scheduled", nil)
+	client.RemoteAddr = "10.0.0.2:4000"
+
+	h.ItemsMatch(t, []string{"instance-stop"}, m.Active(bystander))
+	h.Assert(t, len(m.Eligibility().State().Clients) == 0, fmt.Sprintf("Expected no clients of scheduled events, but was %v", m.Eligibility().State().Clients))
+	eligible, _ := m.Eligibility().Eligible(client)
+	h.Assert(t, eligible, "Expected the first client of scheduled events to be eligible")
+	h.ItemsMatch(t, []string{"instance-stop"}, m.Active(client))
+	h.Assert(t, len(m.Active(bystander)) == 0, "Expected no active events for a client that would not be eligible")
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
+	eventscfg "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events/config"
+)
+
+// Scheduled returns a copy of the scheduled events in config. The single event configured by flags is returned
+// as the only event of the list, if no list is configured.
+func Scheduled(c cfg.Config) []eventscfg.Event {
+	if len(c.EventsConfig.Scheduled) == 0 {
+		if c.EventsConfig.EventCode == "" {
+			return []eventscfg.Event{}
+		}
+		return []eventscfg.Event{{
+			EventCode:         c.EventsConfig.EventCode,
+			EventID:           c.Metadata.Values.EventID,
+			EventState:        c.EventsConfig.EventState,
+			NotBefore:         c.EventsConfig.NotBefore,
+			NotAfter:          c.EventsConfig.NotAfter,
+			NotBeforeDeadline: c.EventsConfig.NotBeforeDeadline,
+		}}
+	}
+	return slices.Clone(c.EventsConfig.Scheduled)
+}
+
+// WithDefaults returns the event with a random id, the active state and the given time as not-before, if not set
+func WithDefaults(event eventscfg.Event, now time.Time) eventscfg.Event {
+	if event.EventID == "" {
+		event.EventID = NewEventID()
+	}
+	if event.EventState == "" {
+		event.EventState = Active
+	}
+	if event.NotBefore == "" {
+		event.NotBefore = now.UTC().Format(time.RFC3339)
+	}
+	return event
+}
+
+// NewEventID returns a random event id formatted like the ids of IMDS, e.g. instance-event-0d59937288b749b32
+func NewEventID() string {
+	b := make([]byte, 9)
+	rand.Read(b)
+	return "instance-event-" + hex.EncodeToString(b)[:17]
+}
+
+// ValidateEvents validates a list of scheduled events and returns a slice of error messages. Keys of invalid
+// values are prefixed with keyPrefix and the index of the event, e.g. events.scheduled[0].code.
+func ValidateEvents(keyPrefix string, scheduled []eventscfg.Event) []string {
+	var errStrings []string
+	eventIDs := make(map[string]bool)
+	for i, event := range scheduled {
+		eventPrefix := fmt.Sprintf("%s[%d].", keyPrefix, i)
+		if !slices.Contains(Codes, event.EventCode) {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     eventPrefix + "code",
+				Allowed:      strings.Join(Codes, ","),
+				InvalidValue: event.EventCode}.Error(),
+			)
+		}
+		if !slices.Contains(States, event.EventState) {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     eventPrefix + "state",
+				Allowed:      strings.Join(States, ","),
+				InvalidValue: event.EventState}.Error(),
+			)
+		}
+		if event.EventID == "" || eventIDs[event.EventID] {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     eventPrefix + "event-id",
+				Allowed:      "a unique event id, e.g. instance-event-1234567890abcdef0",
+				InvalidValue: event.EventID}.Error(),
+			)
+		}
+		eventIDs[event.EventID] = true
+
+		if err := validateTime(eventPrefix+"not-before", event.NotBefore); err != nil {
+			errStrings = append(errStrings, err.Error())
+		}
+		// the end time and deadline are optional
+		if event.NotAfter != "" {
+			if err := validateTime(eventPrefix+"not-after", event.NotAfter); err != nil {
+				errStrings = append(errStrings, err.Error())
+			}
+		}
+		if event.NotBeforeDeadline != "" {
+			if err := validateTime(eventPrefix+"not-before-deadline", event.NotBeforeDeadline); err != nil {
+				errStrings = append(errStrings, err.Error())
+			}
+		}
+	}
+	return errStrings
+}
+
+// validateTime validates a time of an event matches RFC3339 format
+func validateTime(key string, input string) error {
+	if _, err := time.Parse(time.RFC3339, input); err != nil {
+		return e.FlagValidationError{
+			FlagName:     key,
+			Allowed:      "time in RFC3339 format, e.g. 2020-01-07T01:03:47Z",
+			InvalidValue: input}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/admin"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/fleet"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+// member is a mock serving one instance identity of the fleet. It shares the clock of the mock it belongs to, but
+// has its own metadata values, interruption state and IMDSv2 tokens.
+type member struct {
+	mock      *Mock
+	handler   http.Handler
+	generated bool
+	clientIP  string
+}
+
+// routeFleet serves requests mapped to an identity of the fleet with the mock of that identity. Admin requests are
+// mapped by the identity header only; admin requests to the main port are not served if the admin API has a port
+// of its own.
+func (m *Mock) routeFleet(byClient bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			resolver := m.resolver.Load()
+			isAdmin := strings.HasPrefix(req.URL.Path, admin.PathPrefix+"/")
+			if !resolver.Enabled() || isAdmin && byClient && m.adminServer != nil {
+				next.ServeHTTP(res, req)
+				return
+			}
+			name, configured := resolver.Resolve(req, byClient && !isAdmin)
+			if mb := m.member(name, configured, server.ClientIP(req)); mb != nil {
+				mb.handler.ServeHTTP(res, req)
+				return
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// member returns the member serving the identity with the given name, generating it for clientIP if it is not a
+// configured identity. It returns nil if the name is empty or the fleet is full, so the request is served by m.
+func (m *Mock) member(name string, configured bool, clientIP string) *member {
+	if name == "" {
+		return nil
+	}
+	// the config is read before locking the members, as reloads lock the members while holding m.mu
+	c := m.Config()
+
+	m.membersMu.Lock()
+	defer m.membersMu.Unlock()
+	if mb, ok := m.members[name]; ok {
+		return mb
+	}
+	if configured {
+		return nil
+	}
+	generated := 0
+	for _, mb := range m.members {
+		if mb.generated {
+			generated++
+		}
+	}
+	if generated >= c.Fleet.Size {
+		return nil
+	}
+	memberCfg, err := memberConfig(c, name, clientIP, nil)
+	if err != nil {
+		log.Printf("Not generating fleet identity %s: %s", name, err)
+		return nil
+	}
+	mb := m.newMember(memberCfg, true, clientIP)
+	m.members[name] = mb
+	log.Printf("Generated fleet identity %s with instance id %s for %s", name, memberCfg.Metadata.Values.InstanceID, clientIP)
+	return mb
+}
+
+// newMember returns a member serving the given config; callers hold m.membersMu
+func (m *Mock) newMember(c cfg.Config, generated bool, clientIP string) *member {
+	var features []Feature
+	for f := range m.features {
+		features = append(features, f)
+	}
+	mk := newMock(c, m.clock, features)
+	if m.ctx != nil {
+		mk.tokens.StartSweeper(m.ctx, time.Duration(c.Imdsv2SweepIntervalInSec)*time.Second)
+	}
+	return &member{mock: mk, handler: mk.server.Handler(), generated: generated, clientIP: clientIP}
+}
+
+// syncMembers creates, reloads and removes the members of the fleet to match config. Generated members are kept.
+func (m *Mock) syncMembers(config cfg.Config) {
+	m.membersMu.Lock()
+	defer m.membersMu.Unlock()
+
+	configured := make(map[string]bool)
+	for i := range config.Fleet.Identities {
+		id := &config.Fleet.Identities[i]
+		configured[id.Name] = true
+		c, err := memberConfig(config, id.Name, "", id)
+		if err != nil {
+			log.Printf("Ignoring fleet identity %s: %s", id.Name, err)
+			continue
+		}
+		if mb, ok := m.members[id.Name]; ok && !mb.generated {
+			mb.mock.Reload(c)
+			continue
+		} else if ok {
+			mb.mock.Close()
+		}
+		m.members[id.Name] = m.newMember(c, false, "")
+	}
+	for name, mb := range m.members {
+		switch {
+		case mb.generated:
+			if c, err := memberConfig(config, name, mb.clientIP, nil); err == nil {
+				mb.mock.Reload(c)
+			}
+		case !configured[name]:
+			mb.mock.Close()
+			delete(m.members, name)
+		}
+	}
+}
+
+// startMembers starts the token sweepers of the members created before the mock is started
+func (m *Mock) startMembers(ctx context.Context) {
+	m.membersMu.Lock()
+	defer m.membersMu.Unlock()
+	m.ctx = ctx
+	for _, mb := range m.members {
+		c := mb.mock.Config()
+		mb.mock.tokens.StartSweeper(ctx, time.Duration(c.Imdsv2SweepIntervalInSec)*time.Second)
+	}
+}
+
+// closeMembers stops the token sweepers and scenarios of all members
+func (m *Mock) closeMembers() {
+	m.membersMu.Lock()
+	defer m.membersMu.Unlock()
+	for _, mb := range m.members {
+		mb.mock.Close()
+	}
+}
+
+// Members returns the identities served to the clients mapped to them, ordered by name. Clients that are not mapped
+// to an identity are served the identity of the top level config, which is not listed.
+func (m *Mock) Members() []fleet.Member {
+	m.membersMu.Lock()
+	defer m.membersMu.Unlock()
+	members := make([]fleet.Member, 0, len(m.members))
+	for name, mb := range m.members {
+		values := mb.mock.Config().Metadata.Values
+		members = append(members, fleet.Member{
+			Name:       name,
+			Generated:  mb.generated,
+			InstanceID: values.InstanceID,
+			Mac:        values.Mac,
+			LocalIpv4:  values.LocalIpv4,
+			PublicIpv4: values.PublicIpv4,
+		})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members
+}
+
+// memberConfig returns the config serving an identity of the fleet: the top level config with the values generated
+// for the identity, then the values and delays of the identity, if it is configured. Members have neither an admin
+// port, a scenario nor a fleet of their own.
+func memberConfig(parent cfg.Config, name string, clientIP string, id *cfg.Identity) (cfg.Config, error) {
+	c := parent
+	c.AdminPort, c.Scenario, c.Fleet = "", "", cfg.Fleet{}
+	if c.Imdsv2TokenSecret != "" {
+		// signed tokens of one identity must not be valid for another
+		c.Imdsv2TokenSecret += "/" + name
+	}
+
+	values := []map[string]interface{}{fleet.Values(parent.Metadata.Values, name, clientIP)}
+	if id != nil {
+		values = append(values, id.Values)
+		if id.MockDelayInSec != 0 {
+			c.MockDelayInSec = id.MockDelayInSec
+		}
+		if id.RebalanceDelayInSec != 0 {
+			c.RebalanceDelayInSec = id.RebalanceDelayInSec
+		}
+		if id.ASGTerminationDelayInSec != 0 {
+			c.ASGTerminationDelayInSec = id.ASGTerminationDelayInSec
+		}
+	}
+	for _, v := range values {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return cfg.Config{}, err
+		}
+		if err := admin.SetValues(&c, "metadata", raw); err != nil {
+			return cfg.Config{}, fmt.Errorf("invalid values of identity %s: %w", name, err)
+		}
+	}
+	if !c.DeriveValues {
+		c.Dynamic.Values.InstanceIdentityDocument.InstanceId = c.Metadata.Values.InstanceID
+		c.Dynamic.Values.InstanceIdentityDocument.PrivateIp = c.Metadata.Values.LocalIpv4
+	}
+	return c, nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package fleet maps the clients of a mock to instance identities, so every client can look like a different instance.
+// Clients are mapped by a request header naming their identity, by their IP or CIDR, or get an identity generated
+// for their IP.
+package fleet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+// Member is an instance identity served to the clients mapped to it
+type Member struct {
+	Name       string `json:"name"`
+	Generated  bool   `json:"generated"`
+	InstanceID string `json:"instance-id"`
+	Mac        string `json:"mac"`
+	LocalIpv4  string `json:"local-ipv4"`
+	PublicIpv4 string `json:"public-ipv4"`
+}
+
+// identity is a configured identity with the networks of its clients
+type identity struct {
+	name string
+	nets []*net.IPNet
+}
+
+// Resolver maps requests to the names of the identities serving them
+type Resolver struct {
+	size       int
+	header     string
+	identities []identity
+}
+
+// NewResolver returns the resolver for the fleet config. Invalid client IPs and CIDRs are ignored.
+func NewResolver(c cfg.Fleet) *Resolver {
+	r := &Resolver{size: c.Size, header: c.IdentityHeader}
+	for _, id := range c.Identities {
+		var nets []*net.IPNet
+		for _, client := range id.Clients {
+			if ipNet, err := server.ParseIPNet(client); err == nil {
+				nets = append(nets, ipNet)
+			}
+		}
+		r.identities = append(r.identities, identity{name: id.Name, nets: nets})
+	}
+	return r
+}
+
+// Enabled returns whether clients are served identities other than the one of the top level config
+func (r *Resolver) Enabled() bool {
+	return r.size > 0 || r.header != "" || len(r.identities) > 0
+}
+
+// Size returns the maximum number of generated identities
+func (r *Resolver) Size() int {
+	return r.size
+}
+
+// Resolve returns the name of the identity serving the request: the identity named by the identity header, or
+// else the identity the client IP is mapped to, or else the client IP itself. Only the identity header is consulted
+// unless byClient is set, e.g. for admin requests, which come from operators rather than instances. configured
+// reports whether the name is the name of a configured identity; name is empty if the request names no identity.
+func (r *Resolver) Resolve(req *http.Request, byClient bool) (name string, configured bool) {
+	if r.header != "" {
+		if name = req.Header.Get(r.header); name != "" {
+			return name, r.configured(name)
+		}
+	}
+	if !byClient {
+		return "", false
+	}
+	ip := net.ParseIP(server.ClientIP(req))
+	if ip == nil {
+		return "", false
+	}
+	for _, id := range r.identities {
+		if server.ContainsIP(id.nets, ip) {
+			return id.name, true
+		}
+	}
+	return ip.String(), false
+}
+
+// configured returns whether name is the name of a configured identity
+func (r *Resolver) configured(name string) bool {
+	return slices.ContainsFunc(r.identities, func(id identity) bool { return id.name == name })
+}
+
+// Values returns the metadata values identifying a generated identity. The instance id, mac and IPs are derived from
+// the identity name, so an identity keeps them across restarts, and the hostnames of base are changed to match the IPs.
+// The local IPv4 is the client IP, if it is an IPv4 address other than loopback.
+func Values(base cfg.Values, name string, clientIP string) map[string]interface{} {
+	sum := sha256.Sum256([]byte(name))
+	localIpv4 := fmt.Sprintf("172.16.%d.%d", sum[14], sum[15]%254+1)
+	if ip := net.ParseIP(clientIP); ip != nil && ip.To4() != nil && !ip.IsLoopback() {
+		localIpv4 = ip.String()
+	}
+	publicIpv4 := fmt.Sprintf("54.%d.%d.%d", sum[16], sum[17], sum[18]%254+1)
+	mac := fmt.Sprintf("0e:%02x:%02x:%02x:%02x:%02x", sum[9], sum[10], sum[11], sum[12], sum[13])
+
+	values := map[string]interface{}{
+		"instance-id": "i-" + hex.EncodeToString(sum[:9])[:17],
+		"mac":         mac,
+		"mac-mac":     mac,
+		"local-ipv4":  localIpv4,
+	}
+	if base.MacLocalIpv4s == base.LocalIpv4 {
+		values["mac-local-ipv4s"] = localIpv4
+	}
+	local := strings.NewReplacer(dashed(base.LocalIpv4), dashed(localIpv4))
+	values["hostname"] = local.Replace(base.Hostname)
+	values["local-hostname"] = local.Replace(base.LocalHostName)
+	values["mac-local-hostname"] = local.Replace(base.MacLocalHostname)
+	for k, v := range PublicIpv4Values(base, publicIpv4) {
+		values[k] = v
+	}
+	return values
+}
+
+// PublicIpv4Values returns the metadata values changing the public IPv4 of base to the given address, including the
+// public hostnames and the IPs of the mac that match the current public IPv4
+func PublicIpv4Values(base cfg.Values, publicIpv4 string) map[string]interface{} {
+	values := map[string]interface{}{"public-ipv4": publicIpv4}
+	if base.MacPublicIpv4s == base.PublicIpv4 {
+		values["mac-public-ipv4s"] = publicIpv4
+	}
+	if base.MacIpv4Associations == base.PublicIpv4 {
+		values["mac-ipv4-associations"] = publicIpv4
+	}
+	public := strings.NewReplacer(dashed(base.PublicIpv4), dashed(publicIpv4))
+	values["public-hostname"] = public.Replace(base.PublicHostName)
+	values["mac-public-hostname"] = public.Replace(base.MacPublicHostname)
+	return values
+}
+
+// dashed returns an IPv4 address the way it is written in EC2 hostnames, e.g. 172-16-34-43
+func dashed(ip string) string {
+	if ip == "" {
+		// an empty old string would make the replacer insert the new string everywhere
+		return "\x00"
+	}
+	return strings.ReplaceAll(ip, ".", "-")
+}
+
+// ValidateIdentities validates the names and clients of the configured identities and returns the validation errors, if any
+func ValidateIdentities(keyPrefix string, identities []cfg.Identity) []string {
+	var errStrings []string
+	names := make(map[string]bool)
+	for i, id := range identities {
+		idPrefix := fmt.Sprintf("%s[%d].", keyPrefix, i)
+		if id.Name == "" || names[id.Name] {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     idPrefix + "name",
+				Allowed:      "a unique identity name, e.g. node-a",
+				InvalidValue: id.Name}.Error(),
+			)
+		}
+		names[id.Name] = true
+
+		for _, client := range id.Clients {
+			if _, err := server.ParseIPNet(client); err != nil {
+				errStrings = append(errStrings, e.FlagValidationError{
+					FlagName:     idPrefix + "clients",
+					Allowed:      "IPs or CIDRs, e.g. 10.244.1.5 or 10.244.1.0/24",
+					InvalidValue: client}.Error(),
+				)
+			}
+		}
+	}
+	return errStrings
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fleet
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+func TestResolve(t *testing.T) {
+	r := NewResolver(cfg.Fleet{
+		IdentityHeader: "X-Aemm-Identity",
+		Identities: []cfg.Identity{
+			{Name: "node-a", Clients: []string{"10.244.1.0/24"}},
+			{Name: "node-b", Clients: []string{"10.244.2.7", "fd00::7"}},
+		},
+	})
+	h.Assert(t, r.Enabled(), "Expected a fleet with identities to be enabled")
+
+	tests := []struct {
+		remoteAddr, header string
+		byClient           bool
+		name               string
+		configured         bool
+	}{
+		{remoteAddr: "10.244.1.5:4000", byClient: true, name: "node-a", configured: true},
+		{remoteAddr: "10.244.2.7:4000", byClient: true, name: "node-b", configured: true},
+		{remoteAddr: "[fd00::7]:4000", byClient: true, name: "node-b", configured: true},
+		{remoteAddr: "10.244.2.8:4000", byClient: true, name: "10.244.2.8"},
+		{remoteAddr: "10.244.2.8:4000", header: "node-a", byClient: true, name: "node-a", configured: true},
+		{remoteAddr: "10.244.1.5:4000", header: "pod-1", byClient: true, name: "pod-1"},
+		{remoteAddr: "10.244.1.5:4000", header: "node-b", name: "node-b", configured: true},
+		{remoteAddr: "10.244.1.5:4000"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/latest/meta-data/instance-id", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.header != "" {
+			req.Header.Set("X-Aemm-Identity", test.header)
+		}
+		name, configured := r.Resolve(req, test.byClient)
+		h.Assert(t, name == test.name && configured == test.configured,
+			fmt.Sprintf("Expected %s (configured: %t) for %+v, but was %s (configured: %t)", test.name, test.configured, test, name, configured))
+	}
+}
+
+func TestValues(t *testing.T) {
+	base := cfg.Values{
+		LocalIpv4:      "172.16.34.43",
+		PublicIpv4:     "192.0.2.54",
+		Hostname:       "ip-172-16-34-43.ec2.internal",
+		PublicHostName: "ec2-192-0-2-54.compute-1.amazonaws.com",
+	}
+	values := Values(base, "10.244.1.5", "10.244.1.5")
+	h.Assert(t, values["local-ipv4"] == "10.244.1.5", fmt.Sprintf("Expected the client IP as local-ipv4, but was %s", values["local-ipv4"]))
+	h.Assert(t, values["hostname"] == "ip-10-244-1-5.ec2.internal", fmt.Sprintf("Expected the hostname of the client IP, but was %s", values["hostname"]))
+	publicHostname := "ec2-" + strings.ReplaceAll(values["public-ipv4"].(string), ".", "-") + ".compute-1.amazonaws.com"
+	h.Assert(t, values["public-hostname"] == publicHostname, fmt.Sprintf("Expected public-hostname %s, but was %s", publicHostname, values["public-hostname"]))
+
+	again := Values(base, "10.244.1.5", "10.244.1.5")
+	h.Assert(t, values["instance-id"] == again["instance-id"] && values["mac"] == again["mac"], "Expected the same values for the same identity")
+	other := Values(base, "pod-1", "127.0.0.1")
+	h.Assert(t, values["instance-id"] != other["instance-id"], "Expected different instance ids for different identities")
+	h.Assert(t, other["local-ipv4"] != "127.0.0.1", "Expected a loopback client IP not to be used as local-ipv4")
+}
+
+func TestValidateIdentities(t *testing.T) {
+	errStrings := ValidateIdentities("fleet.identities", []cfg.Identity{
+		{Name: "node-a", Clients: []string{"10.244.1.0/24", "fd00::7"}},
+		{Name: "node-a"},
+		{Clients: []string{"10.244.300.1"}},
+	})
+	h.Assert(t, len(errStrings) == 3, fmt.Sprintf("Expected 3 validation errors, but were %d: %v", len(errStrings), errStrings))
+	for i, key := range []string{"fleet.identities[1].name", "fleet.identities[2].name", "fleet.identities[2].clients"} {
+		h.Assert(t, strings.Contains(errStrings[i], key), fmt.Sprintf("Expected an error for %s, but was %s", key, errStrings[i]))
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package mock
+
+import (
+	"log"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/signing"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/tree"
+)
+
+// Certificate returns the PEM encoded certificate verifying the signatures of the instance identity document, nil if
+// the signing key and certificate of the config cannot be loaded
+func (m *Mock) Certificate() []byte {
+	if signer := m.signer.Load(); signer != nil {
+		return signer.Certificate()
+	}
+	return nil
+}
+
+// signIdentity adds the signatures of the instance identity document in the tree to it, unless their values are set
+// in config. They are signed at the current mock time.
+func (m *Mock) signIdentity(t *tree.Tree, config cfg.Config) {
+	signer, err := signing.Load(config.Signing)
+	if err != nil {
+		log.Printf("Not signing the instance identity document: %s", err)
+		m.signer.Store(nil)
+		return
+	}
+	m.signer.Store(signer)
+	document, ok := t.Value(config.Dynamic.Paths.InstanceIdentityDocument)
+	if !ok {
+		return
+	}
+	data, err := document.Bytes()
+	if err != nil {
+		log.Printf("There was an issue formatting the instance identity document: %s", err)
+		return
+	}
+
+	now := m.clock.Now()
+	paths, values := config.Dynamic.Paths, config.Dynamic.Values
+	for _, s := range []struct {
+		path  string
+		value string
+		sign  func() (string, error)
+	}{
+		{paths.InstanceIdentitySignature, values.InstanceIdentitySignature, func() (string, error) { return signer.Signature(data) }},
+		{paths.InstanceIdentityPKCS, values.InstanceIdentityPKCS, func() (string, error) { return signer.PKCS7(data, now) }},
+		{paths.InstanceIdentityRSA2048, values.InstanceIdentityRSA2048, func() (string, error) { return signer.RSA2048(data, now) }},
+	} {
+		if s.path == "" || s.value != "" {
+			continue
+		}
+		signature, err := s.sign()
+		if err != nil {
+			log.Printf("There was an issue signing the instance identity document for %s: %s", s.path, err)
+			continue
+		}
+		t.Set(s.path, tree.Value{Kind: tree.Text, Data: signature})
+	}
+}
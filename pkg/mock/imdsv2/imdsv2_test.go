@@ -14,6 +14,8 @@
 package imdsv2
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -21,9 +23,11 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
 	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
 	h "github.com/aws/amazon-ec2-metadata-mock/test"
 )
@@ -32,6 +36,7 @@ const (
 	testURL             = "http://test-example.com/"
 	tokenRegex          = "^[a-zA-Z0-9+/]{43}="
 	successMockResponse = "Success!"
+	testSecret          = "test-secret"
 )
 
 func MockHandler(res http.ResponseWriter, req *http.Request) {
@@ -40,76 +45,220 @@ func MockHandler(res http.ResponseWriter, req *http.Request) {
 
 // Token Generator Tests
 func TestGenerateToken(t *testing.T) {
+	tokens := NewTokenStore(0, "", clock.New())
 	req := httptest.NewRequest("PUT", testURL, nil)
 	req.Header.Set(tokenTTLHeader, "21500")
-	generateTokenResp := executeTestHTTPRequest(req, GenerateToken)
+	generateTokenResp := executeTestHTTPRequest(req, tokens.GenerateToken)
 	token, ttl := parseGenTokenResp(generateTokenResp)
 	h.Assert(t, isTokenValid(token), fmt.Sprintf("Expected valid token generation, but was %s", token))
 	h.Assert(t, ttl == 21500, fmt.Sprintf("Expected Token TTL header to equal requested value, but was %d", ttl))
 }
 func TestInvalidGenerateTokenRequestGet(t *testing.T) {
+	tokens := NewTokenStore(0, "", clock.New())
 	req := httptest.NewRequest("GET", testURL, nil)
 	req.Header.Set(tokenTTLHeader, "21500")
-	generateTokenResp := executeTestHTTPRequest(req, GenerateToken)
-	token, _ := parseGenTokenResp(generateTokenResp)
-	h.Assert(t, token == "", fmt.Sprintf("Expected no token, but was %s", token))
+	generateTokenResp := executeTestHTTPRequest(req, tokens.GenerateToken)
+	respContent, _ := parseGenTokenResp(generateTokenResp)
+	h.Assert(t, generateTokenResp.StatusCode == http.StatusMethodNotAllowed, fmt.Sprintf("Expected 405 -- Method Not Allowed, but was %d", generateTokenResp.StatusCode))
+	h.Assert(t, respContent == server.MethodNotAllowedResponse, fmt.Sprintf("Expected 405 -- Method Not Allowed response, but was %s", respContent))
+	allow := generateTokenResp.Header.Get("Allow")
+	h.Assert(t, allow == "OPTIONS, PUT", fmt.Sprintf("Expected Allow header OPTIONS, PUT, but was %s", allow))
+}
+func TestInvalidGenerateTokenForwardedRequest(t *testing.T) {
+	tokens := NewTokenStore(0, "", clock.New())
+	req := httptest.NewRequest("PUT", testURL, nil)
+	req.Header.Set(tokenTTLHeader, "21500")
+	req.Header.Set(forwardedForHeader, "203.0.113.1")
+	generateTokenResp := executeTestHTTPRequest(req, tokens.GenerateToken)
+	respContent, _ := parseGenTokenResp(generateTokenResp)
+	h.Assert(t, respContent == server.ForbiddenResponse, fmt.Sprintf("Expected 403 -- Forbidden, but was %s", respContent))
 }
 func TestInvalidGenerateTokenInvalidTTL(t *testing.T) {
+	tokens := NewTokenStore(0, "", clock.New())
 	req := httptest.NewRequest("PUT", testURL, nil)
 	req.Header.Set(tokenTTLHeader, "0")
-	generateTokenResp := executeTestHTTPRequest(req, GenerateToken)
+	generateTokenResp := executeTestHTTPRequest(req, tokens.GenerateToken)
 	respContent, _ := parseGenTokenResp(generateTokenResp)
 	h.Assert(t, respContent == server.BadRequestResponse, fmt.Sprintf("Expected 400 -- Bad Request, but was %s", respContent))
 }
 func TestInvalidGenerateTokenNoTTL(t *testing.T) {
+	tokens := NewTokenStore(0, "", clock.New())
 	req := httptest.NewRequest("PUT", testURL, nil)
-	generateTokenResp := executeTestHTTPRequest(req, GenerateToken)
+	generateTokenResp := executeTestHTTPRequest(req, tokens.GenerateToken)
 	respContent, _ := parseGenTokenResp(generateTokenResp)
 	h.Assert(t, respContent == server.BadRequestResponse, fmt.Sprintf("Expected 400 -- Bad Request, but was %s", respContent))
 }
 
 // Token Validator Tests
 func TestValidateToken(t *testing.T) {
+	tokens := NewTokenStore(0, "", clock.New())
 	req := httptest.NewRequest("PUT", testURL, nil)
 	req.Header.Set(tokenTTLHeader, "21500")
-	generateTokenResp := executeTestHTTPRequest(req, GenerateToken)
+	generateTokenResp := executeTestHTTPRequest(req, tokens.GenerateToken)
 	validTestToken, _ := parseGenTokenResp(generateTokenResp)
 
 	req = httptest.NewRequest("GET", testURL, nil)
 	req.Header.Set(tokenRequestHeader, validTestToken)
-	validateTokenResp := executeTestHTTPRequest(req, http.HandlerFunc(ValidateToken(MockHandler)))
+	validateTokenResp := executeTestHTTPRequest(req, http.HandlerFunc(tokens.ValidateToken(MockHandler)))
 	respContent, _ := ioutil.ReadAll(validateTokenResp.Body)
 	h.Assert(t, strings.TrimSpace(string(respContent)) == successMockResponse, fmt.Sprintf("Expected successful token validation, but was %s", respContent))
 }
 func TestValidateTokenNoToken(t *testing.T) {
+	tokens := NewTokenStore(0, "", clock.New())
 	req := httptest.NewRequest("GET", testURL, nil)
-	validateTokenResp := executeTestHTTPRequest(req, http.HandlerFunc(ValidateToken(MockHandler)))
+	validateTokenResp := executeTestHTTPRequest(req, http.HandlerFunc(tokens.ValidateToken(MockHandler)))
 	respContent, _ := ioutil.ReadAll(validateTokenResp.Body)
 	h.Assert(t, strings.TrimSpace(string(respContent)) == server.UnauthorizedResponse, fmt.Sprintf("Expected 401 -- Unauthorized for no token, but was %s", respContent))
 }
 func TestValidateTokenInvalidToken(t *testing.T) {
+	tokens := NewTokenStore(0, "", clock.New())
 	invalidTestToken := "ThisTokenIsNotValid!"
 	req := httptest.NewRequest("GET", testURL, nil)
 	req.Header.Set(tokenRequestHeader, invalidTestToken)
-	validateTokenResp := executeTestHTTPRequest(req, http.HandlerFunc(ValidateToken(MockHandler)))
+	validateTokenResp := executeTestHTTPRequest(req, http.HandlerFunc(tokens.ValidateToken(MockHandler)))
 	respContent, _ := ioutil.ReadAll(validateTokenResp.Body)
 	h.Assert(t, strings.TrimSpace(string(respContent)) == server.UnauthorizedResponse, fmt.Sprintf("401 -- Unauthorized for invalid token, but was %s", respContent))
 }
 func TestValidateTokenExpiredToken(t *testing.T) {
+	clk := clock.New()
+	tokens := NewTokenStore(0, "", clk)
 	req := httptest.NewRequest("PUT", testURL, nil)
-	req.Header.Set(tokenTTLHeader, "1")
-	generateTokenResp := executeTestHTTPRequest(req, GenerateToken)
+	req.Header.Set(tokenTTLHeader, "21600")
+	generateTokenResp := executeTestHTTPRequest(req, tokens.GenerateToken)
 	expiredTestToken, _ := parseGenTokenResp(generateTokenResp)
 
-	time.Sleep(1 * time.Second)
+	clk.Advance(6 * time.Hour)
 
 	req = httptest.NewRequest("GET", testURL, nil)
 	req.Header.Set(tokenRequestHeader, expiredTestToken)
-	validateTokenResp := executeTestHTTPRequest(req, http.HandlerFunc(ValidateToken(MockHandler)))
+	validateTokenResp := executeTestHTTPRequest(req, http.HandlerFunc(tokens.ValidateToken(MockHandler)))
 	respContent, _ := ioutil.ReadAll(validateTokenResp.Body)
 	h.Assert(t, strings.TrimSpace(string(respContent)) == server.UnauthorizedResponse, fmt.Sprintf("401 -- Unauthorized for expired token, but was %s", respContent))
 }
 
+// Token Store Tests
+func TestGenerateTokenAtCapacity(t *testing.T) {
+	tokens := NewTokenStore(1, "", clock.New())
+	req := httptest.NewRequest("PUT", testURL, nil)
+	req.Header.Set(tokenTTLHeader, "21500")
+	generateTokenResp := executeTestHTTPRequest(req, tokens.GenerateToken)
+	h.Assert(t, generateTokenResp.StatusCode == http.StatusOK, fmt.Sprintf("Expected 200 OK for first token, but was %d", generateTokenResp.StatusCode))
+
+	generateTokenResp = executeTestHTTPRequest(req, tokens.GenerateToken)
+	respContent, _ := parseGenTokenResp(generateTokenResp)
+	h.Assert(t, generateTokenResp.StatusCode == http.StatusTooManyRequests, fmt.Sprintf("Expected 429 -- Too Many Requests at capacity, but was %d", generateTokenResp.StatusCode))
+	h.Assert(t, respContent == server.TooManyRequestsResponse, fmt.Sprintf("Expected 429 -- Too Many Requests response, but was %s", respContent))
+}
+func TestGenerateTokenAtCapacitySweepsExpiredTokens(t *testing.T) {
+	tokens := NewTokenStore(1, "", clock.New())
+	tokens.generatedTokens["expired"] = v2Token{Value: "expired", TTL: 1, CreatedAt: time.Now().Add(-time.Minute)}
+	req := httptest.NewRequest("PUT", testURL, nil)
+	req.Header.Set(tokenTTLHeader, "21500")
+	generateTokenResp := executeTestHTTPRequest(req, tokens.GenerateToken)
+	token, _ := parseGenTokenResp(generateTokenResp)
+	h.Assert(t, isTokenValid(token), fmt.Sprintf("Expected valid token generation once expired tokens are swept, but was %s", token))
+	_, ok := tokens.generatedTokens["expired"]
+	h.Assert(t, !ok, "Expected expired token to be swept")
+}
+func TestSweep(t *testing.T) {
+	tokens := NewTokenStore(0, "", clock.New())
+	tokens.generatedTokens["expired"] = v2Token{Value: "expired", TTL: 1, CreatedAt: time.Now().Add(-time.Minute)}
+	tokens.generatedTokens["live"] = v2Token{Value: "live", TTL: 21600, CreatedAt: time.Now()}
+	removed := tokens.Sweep()
+	h.Assert(t, removed == 1, fmt.Sprintf("Expected 1 token to be swept, but was %d", removed))
+	_, ok := tokens.generatedTokens["live"]
+	h.Assert(t, ok, "Expected live token to be kept")
+}
+func TestSetSweepIntervalRestartsSweeper(t *testing.T) {
+	tokens := NewTokenStore(0, "", clock.New())
+	defer tokens.Close()
+	addExpired := func() {
+		tokens.mu.Lock()
+		defer tokens.mu.Unlock()
+		tokens.generatedTokens["expired"] = v2Token{Value: "expired", TTL: 1, CreatedAt: time.Now().Add(-time.Minute)}
+	}
+	swept := func() bool {
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			tokens.mu.Lock()
+			_, ok := tokens.generatedTokens["expired"]
+			tokens.mu.Unlock()
+			if !ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	tokens.SetSweepInterval(10 * time.Millisecond)
+	addExpired()
+	h.Assert(t, !swept(), "Expected no sweeper before it is started")
+	tokens.StartSweeper(context.Background(), 0)
+	h.Assert(t, !swept(), "Expected no sweeper with an interval of 0")
+	tokens.SetSweepInterval(10 * time.Millisecond)
+	h.Assert(t, swept(), "Expected the sweeper to remove expired tokens once its interval is set")
+	tokens.SetSweepInterval(0)
+	addExpired()
+	h.Assert(t, !swept(), "Expected the sweeper to stop once its interval is 0")
+}
+func TestConcurrentGenerateAndValidateToken(t *testing.T) {
+	tokens := NewTokenStore(0, "", clock.New())
+	handler := http.HandlerFunc(tokens.ValidateToken(MockHandler))
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("PUT", testURL, nil)
+			req.Header.Set(tokenTTLHeader, "21500")
+			token, _ := parseGenTokenResp(executeTestHTTPRequest(req, tokens.GenerateToken))
+			req = httptest.NewRequest("GET", testURL, nil)
+			req.Header.Set(tokenRequestHeader, token)
+			executeTestHTTPRequest(req, handler)
+			tokens.Sweep()
+		}()
+	}
+	wg.Wait()
+	h.Assert(t, len(tokens.generatedTokens) == 50, fmt.Sprintf("Expected 50 live tokens, but was %d", len(tokens.generatedTokens)))
+}
+
+// Signed Token Tests
+func TestValidateSignedTokenFromOtherStore(t *testing.T) {
+	issuer := NewTokenStore(0, testSecret, clock.New())
+	verifier := NewTokenStore(0, testSecret, clock.New())
+	req := httptest.NewRequest("PUT", testURL, nil)
+	req.Header.Set(tokenTTLHeader, "21500")
+	signedToken, ttl := parseGenTokenResp(executeTestHTTPRequest(req, issuer.GenerateToken))
+	h.Assert(t, ttl == 21500, fmt.Sprintf("Expected Token TTL header to equal requested value, but was %d", ttl))
+	h.Assert(t, len(issuer.generatedTokens) == 0, "Expected signed tokens not to be stored")
+
+	req = httptest.NewRequest("GET", testURL, nil)
+	req.Header.Set(tokenRequestHeader, signedToken)
+	validateTokenResp := executeTestHTTPRequest(req, http.HandlerFunc(verifier.ValidateToken(MockHandler)))
+	respContent, _ := ioutil.ReadAll(validateTokenResp.Body)
+	h.Assert(t, strings.TrimSpace(string(respContent)) == successMockResponse, fmt.Sprintf("Expected successful token validation, but was %s", respContent))
+}
+func TestValidateSignedTokenOtherSecret(t *testing.T) {
+	signedToken, err := signToken([]byte("other-secret"), time.Now(), 21500)
+	h.Ok(t, err)
+	h.Assert(t, !NewTokenStore(0, testSecret, clock.New()).isValid(signedToken), "Expected token signed with another secret to be invalid")
+}
+func TestValidateSignedTokenTampered(t *testing.T) {
+	signedToken, err := signToken([]byte(testSecret), time.Now(), 1)
+	h.Ok(t, err)
+	buf, _ := base64.StdEncoding.DecodeString(signedToken)
+	buf[11] = 0xff // extend the ttl
+	h.Assert(t, !NewTokenStore(0, testSecret, clock.New()).isValid(base64.StdEncoding.EncodeToString(buf)), "Expected tampered token to be invalid")
+}
+func TestValidateSignedTokenExpired(t *testing.T) {
+	clk := clock.New()
+	tokens := NewTokenStore(0, testSecret, clk)
+	signedToken, err := signToken([]byte(testSecret), clk.Now(), 21600)
+	h.Ok(t, err)
+	h.Assert(t, tokens.isValid(signedToken), "Expected token to be valid before its TTL elapsed")
+	clk.Advance(6 * time.Hour)
+	h.Assert(t, !tokens.isValid(signedToken), "Expected expired token to be invalid")
+}
+
 // Test Helpers
 func isTokenValid(token string) bool {
 	matched, _ := regexp.Match(tokenRegex, []byte(token))
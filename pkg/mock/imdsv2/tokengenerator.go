@@ -14,37 +14,40 @@
 package imdsv2
 
 import (
+	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"log"
-	"math/rand"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
 )
 
 const (
-	tokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
-	maxTTL         = 21600 // 6 hours
+	tokenTTLHeader     = "X-aws-ec2-metadata-token-ttl-seconds"
+	forwardedForHeader = "X-Forwarded-For"
+	maxTTL             = 21600 // 6 hours
 )
 
-var (
-	generatedTokens = make(map[string]v2Token)
-)
-
-type v2Token struct {
-	Value     string    // actual token value
-	TTL       int       // token ttl
-	CreatedAt time.Time // time the token was created
-}
-
 // GenerateToken returns a token with the specified TTL used for IMDSv2 requests
-func GenerateToken(res http.ResponseWriter, req *http.Request) {
+func (ts *TokenStore) GenerateToken(res http.ResponseWriter, req *http.Request) {
 	log.Printf("GenerateToken Received request: %v", req)
 	// only valid with PUT
-	if req.Method != http.MethodPut {
+	switch req.Method {
+	case http.MethodPut:
+	case http.MethodOptions:
+		res.Header().Set("Allow", "OPTIONS, PUT")
+		return
+	default:
+		log.Printf("Method %s is not allowed for token requests", req.Method)
+		server.ReturnMethodNotAllowedResponse(res, http.MethodOptions, http.MethodPut)
+		return
+	}
+	// requests forwarded by a proxy are refused, which protects tokens against SSRF
+	if req.Header.Get(forwardedForHeader) != "" {
+		log.Printf("Refusing token request with %s header", forwardedForHeader)
+		server.ReturnForbiddenResponse(res)
 		return
 	}
 	// check that header contains valid ttl
@@ -56,6 +59,17 @@ func GenerateToken(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if secret := ts.signingSecret(); secret != nil {
+		tokenValue, err := signToken(secret, ts.clock.Now(), validTTL)
+		if err != nil {
+			server.FormatAndReturnTextResponse(res, "Something went wrong with token creation")
+			return
+		}
+		res.Header().Set(tokenTTLHeader, strconv.Itoa(validTTL))
+		server.FormatAndReturnTextResponse(res, tokenValue)
+		return
+	}
+
 	key := make([]byte, 32)
 	_, err = rand.Read(key)
 	if err != nil {
@@ -67,9 +81,13 @@ func GenerateToken(res http.ResponseWriter, req *http.Request) {
 	token := v2Token{
 		Value:     tokenValue,
 		TTL:       validTTL,
-		CreatedAt: time.Now(),
+		CreatedAt: ts.clock.Now(),
+	}
+	if !ts.add(token) {
+		log.Println("Rejecting token request; the maximum number of live tokens has been reached.")
+		server.ReturnTooManyRequestsResponse(res)
+		return
 	}
-	generatedTokens[token.Value] = token
 	res.Header().Set(tokenTTLHeader, strconv.Itoa(token.TTL))
 	server.FormatAndReturnTextResponse(res, token.Value)
 }
@@ -0,0 +1,64 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package imdsv2
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"time"
+)
+
+const (
+	signedTokenNonceLen   = 16
+	signedTokenPayloadLen = 8 + 4 + signedTokenNonceLen // issue time in ms, ttl, nonce
+	signedTokenLen        = signedTokenPayloadLen + sha256.Size
+)
+
+// signToken returns a self-describing token carrying its issue time and TTL, signed with the secret
+func signToken(secret []byte, issuedAt time.Time, ttl int) (string, error) {
+	buf := make([]byte, signedTokenLen)
+	binary.BigEndian.PutUint64(buf[0:8], uint64(issuedAt.UnixMilli()))
+	binary.BigEndian.PutUint32(buf[8:12], uint32(ttl))
+	if _, err := rand.Read(buf[12:signedTokenPayloadLen]); err != nil {
+		return "", err
+	}
+	copy(buf[signedTokenPayloadLen:], tokenMAC(secret, buf[:signedTokenPayloadLen]))
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// verifyToken returns whether the token was signed with the secret and has not expired at the given time
+func verifyToken(secret []byte, value string, now time.Time) bool {
+	buf, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(buf) != signedTokenLen {
+		return false
+	}
+	if !hmac.Equal(buf[signedTokenPayloadLen:], tokenMAC(secret, buf[:signedTokenPayloadLen])) {
+		return false
+	}
+	token := v2Token{
+		Value:     value,
+		TTL:       int(binary.BigEndian.Uint32(buf[8:12])),
+		CreatedAt: time.UnixMilli(int64(binary.BigEndian.Uint64(buf[0:8]))),
+	}
+	return !token.expired(now)
+}
+
+func tokenMAC(secret []byte, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package imdsv2
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+)
+
+// TokenStore generates IMDSv2 session tokens and validates them on later requests.
+// It is safe for concurrent use.
+//
+// Without a secret, tokens are random values kept in memory until they expire. With a secret, tokens are signed
+// and carry their own issue time and TTL, so any store sharing the secret, e.g. another replica, accepts them.
+type TokenStore struct {
+	mu              sync.Mutex
+	clock           *clock.Clock
+	maxTokens       int
+	secret          []byte
+	generatedTokens map[string]v2Token
+
+	sweepCtx      context.Context // set once the sweeper is started
+	sweepInterval time.Duration
+	sweepStop     chan struct{} // stops the running sweeper when its interval changes
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type v2Token struct {
+	Value     string    // actual token value
+	TTL       int       // token ttl
+	CreatedAt time.Time // time the token was created
+}
+
+// expired returns whether the token's TTL has elapsed at the given time
+func (t v2Token) expired(now time.Time) bool {
+	return int(now.Sub(t.CreatedAt).Seconds()) >= t.TTL
+}
+
+// NewTokenStore returns a TokenStore without any generated tokens, holding at most maxTokens live tokens.
+// A maxTokens of 0 or less does not limit the number of live tokens. If secret is not empty, signed tokens are
+// generated instead and maxTokens does not apply. Token TTLs elapse in the mock time told by clk.
+func NewTokenStore(maxTokens int, secret string, clk *clock.Clock) *TokenStore {
+	return &TokenStore{
+		clock:           clk,
+		maxTokens:       maxTokens,
+		secret:          []byte(secret),
+		generatedTokens: make(map[string]v2Token),
+		stop:            make(chan struct{}),
+	}
+}
+
+// SetMaxTokens changes the number of live tokens the store holds. Tokens generated before are kept.
+func (ts *TokenStore) SetMaxTokens(maxTokens int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.maxTokens = maxTokens
+}
+
+// SetSecret changes the secret used to sign tokens; an empty secret switches back to tokens kept in memory.
+// Tokens generated before are no longer valid if they were signed with a different secret.
+func (ts *TokenStore) SetSecret(secret string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.secret = []byte(secret)
+}
+
+// StartSweeper removes expired tokens every interval until ctx is done or the store is closed. An interval of 0 or
+// less does not remove tokens until it is changed with SetSweepInterval.
+func (ts *TokenStore) StartSweeper(ctx context.Context, interval time.Duration) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.sweepCtx = ctx
+	ts.restartSweeperLocked(interval)
+}
+
+// SetSweepInterval changes how often the sweeper removes expired tokens, restarting it with the new interval. An
+// interval of 0 or less stops it. It has no effect before the sweeper is started.
+func (ts *TokenStore) SetSweepInterval(interval time.Duration) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.sweepCtx == nil || interval == ts.sweepInterval {
+		return
+	}
+	ts.restartSweeperLocked(interval)
+}
+
+// restartSweeperLocked stops the running sweeper, if any, and starts one with the given interval; callers hold ts.mu
+func (ts *TokenStore) restartSweeperLocked(interval time.Duration) {
+	if ts.sweepStop != nil {
+		close(ts.sweepStop)
+		ts.sweepStop = nil
+	}
+	ts.sweepInterval = interval
+	if interval <= 0 {
+		return
+	}
+	ctx, sweepStop := ts.sweepCtx, make(chan struct{})
+	ts.sweepStop = sweepStop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if n := ts.Sweep(); n > 0 {
+					log.Printf("Removed %d expired IMDSv2 tokens", n)
+				}
+			case <-ctx.Done():
+				return
+			case <-ts.stop:
+				return
+			case <-sweepStop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the sweeper
+func (ts *TokenStore) Close() {
+	ts.stopOnce.Do(func() { close(ts.stop) })
+}
+
+// Sweep removes expired tokens and returns how many were removed
+func (ts *TokenStore) Sweep() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.sweepLocked(ts.clock.Now())
+}
+
+func (ts *TokenStore) sweepLocked(now time.Time) int {
+	removed := 0
+	for value, token := range ts.generatedTokens {
+		if token.expired(now) {
+			delete(ts.generatedTokens, value)
+			removed++
+		}
+	}
+	return removed
+}
+
+// signingSecret returns the secret used to sign tokens, or nil if tokens are kept in memory
+func (ts *TokenStore) signingSecret() []byte {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if len(ts.secret) == 0 {
+		return nil
+	}
+	return ts.secret
+}
+
+// add stores the token unless the store is full. Expired tokens are swept first so they never count towards the
+// cap; live tokens are never evicted, matching IMDS which throttles token requests instead of revoking sessions.
+func (ts *TokenStore) add(token v2Token) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.maxTokens > 0 && len(ts.generatedTokens) >= ts.maxTokens {
+		ts.sweepLocked(ts.clock.Now())
+		if len(ts.generatedTokens) >= ts.maxTokens {
+			return false
+		}
+	}
+	ts.generatedTokens[token.Value] = token
+	return true
+}
+
+// isValid returns whether a token with the given value exists and has not expired; expired tokens are removed
+func (ts *TokenStore) isValid(value string) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if len(ts.secret) > 0 {
+		return verifyToken(ts.secret, value, ts.clock.Now())
+	}
+	token, ok := ts.generatedTokens[value]
+	if !ok {
+		return false
+	}
+	if token.expired(ts.clock.Now()) {
+		log.Println("Token has expired")
+		delete(ts.generatedTokens, value)
+		return false
+	}
+	return true
+}
@@ -16,7 +16,6 @@ package imdsv2
 import (
 	"log"
 	"net/http"
-	"time"
 
 	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
 )
@@ -26,7 +25,7 @@ const (
 )
 
 // ValidateToken is a wrapper to validate token before passing request to provided handler
-func ValidateToken(pathHandler server.HandlerType) server.HandlerType {
+func (ts *TokenStore) ValidateToken(pathHandler server.HandlerType) server.HandlerType {
 	return func(res http.ResponseWriter, req *http.Request) {
 		log.Printf("ValidateToken Received request: %v", req)
 		providedToken := req.Header.Get(tokenRequestHeader)
@@ -36,15 +35,7 @@ func ValidateToken(pathHandler server.HandlerType) server.HandlerType {
 			return
 		}
 
-		if actualToken, ok := generatedTokens[providedToken]; ok {
-			accessTime := time.Now()
-			duration := accessTime.Sub(actualToken.CreatedAt)
-			if int(duration.Seconds()) >= actualToken.TTL {
-				log.Println("Token has expired")
-				delete(generatedTokens, providedToken)
-				server.ReturnUnauthorizedResponse(res)
-				return
-			}
+		if ts.isValid(providedToken) {
 			log.Println("Token validated!")
 			pathHandler(res, req)
 		} else {
@@ -0,0 +1,54 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package mock
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+// eventActions are the instance actions pending while scheduled events with these codes are active. System maintenance
+// does not affect the instance.
+var eventActions = map[string]string{
+	"instance-reboot":     "reboot",
+	"system-reboot":       "reboot",
+	"instance-stop":       "stop",
+	"instance-retirement": "stop",
+}
+
+// instanceActionHandler serves the instance action pending for the client of the request
+func (m *Mock) instanceActionHandler(res http.ResponseWriter, req *http.Request) {
+	log.Println("Received request to mock instance action:", req.URL.Path)
+	server.FormatAndReturnTextResponse(res, m.instanceAction(req))
+}
+
+// instanceAction returns the action of the spot itn served to the client of the request, else the action of the first
+// active scheduled event that stops or reboots the instance, else the configured instance action
+func (m *Mock) instanceAction(req *http.Request) string {
+	if m.features[Spot] {
+		if action, ok := m.spot.PendingAction(req); ok {
+			return action
+		}
+	}
+	if m.features[Events] {
+		for _, code := range m.events.Active(req) {
+			if action, ok := eventActions[code]; ok {
+				return action
+			}
+		}
+	}
+	return m.Config().Metadata.Values.InstanceAction
+}
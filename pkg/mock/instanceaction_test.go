@@ -0,0 +1,68 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package mock
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	eventscfg "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+func TestInstanceActionAloneServesPendingActions(t *testing.T) {
+	c := testConfig(t)
+	c.MockIPCount = 1
+	c.SpotConfig.InstanceAction = spot.Stop
+	c.EventsConfig.Scheduled = []eventscfg.Event{{EventCode: "instance-reboot", EventID: "instance-event-1", EventState: "active", NotBefore: "2020-01-01T00:00:00Z"}}
+	m := New(c)
+	serve := func() string {
+		req := httptest.NewRequest(http.MethodGet, instanceActionPath, nil)
+		req.RemoteAddr = "10.0.0.1:4000"
+		res := httptest.NewRecorder()
+		m.server.Handler().ServeHTTP(res, req)
+		return res.Body.String()
+	}
+
+	body := serve()
+	h.Assert(t, body == spot.Stop, fmt.Sprintf("Expected the action of the spot itn for a client polling only instance-action, but was %s", body))
+	m.spot.Cancel(spot.ITN)
+	body = serve()
+	h.Assert(t, body == "reboot", fmt.Sprintf("Expected the action of the scheduled event for a client polling only instance-action, but was %s", body))
+}
+
+func TestInstanceActionDoesNotUseUpEligibility(t *testing.T) {
+	c := testConfig(t)
+	c.MockIPCount = 1
+	m := New(c)
+	serve := func(path string, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		res := httptest.NewRecorder()
+		m.server.Handler().ServeHTTP(res, req)
+		return res
+	}
+
+	for i := 0; i < 3; i++ {
+		res := serve(instanceActionPath, "10.0.0.1:4000")
+		h.Assert(t, res.Code == http.StatusOK, fmt.Sprintf("Expected the instance action, but was %d", res.Code))
+	}
+	res := serve("/latest/meta-data/spot/instance-action", "10.0.0.2:4000")
+	h.Assert(t, res.Code == http.StatusOK, fmt.Sprintf("Expected the first client of spot itns to be served the itn, but was %d", res.Code))
+	res = serve("/latest/meta-data/events/maintenance/scheduled", "10.0.0.3:4000")
+	h.Assert(t, res.Code == http.StatusOK, fmt.Sprintf("Expected the first client of scheduled events to be served the events, but was %d", res.Code))
+}
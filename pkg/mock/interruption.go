@@ -0,0 +1,181 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package mock
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/admin"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/asglifecycle"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/fleet"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+const (
+	// Serve keeps serving metadata normally after the instance is terminated
+	Serve = "serve"
+	// Unresponsive takes over the connections of requests after the instance is terminated without ever responding
+	Unresponsive = "unresponsive"
+	// Reset resets the connections of requests after the instance is terminated
+	Reset = "reset"
+)
+
+// TerminatedModes are the ways requests fail after the instance is terminated
+var TerminatedModes = []string{Serve, Unresponsive, Reset}
+
+// afterInterruption fails requests the way requests to an instance fail once its interruption is executed: for good
+// after a termination, or for the configured time after a stop or hibernation, after which the instance starts again
+func (m *Mock) afterInterruption(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		c := m.Config().AfterInterruption
+		if strings.HasPrefix(req.URL.Path, admin.PathPrefix+"/") || (c.Terminated == "" || c.Terminated == Serve) && c.StoppedForSec <= 0 {
+			next.ServeHTTP(res, req)
+			return
+		}
+		if c.Terminated != "" && c.Terminated != Serve && m.terminated(req) {
+			if c.Terminated == Unresponsive {
+				server.HangConnection(res)
+			} else {
+				server.ResetConnection(res)
+			}
+			return
+		}
+		if c.StoppedForSec > 0 && m.stopped(req, time.Duration(c.StoppedForSec)*time.Second) {
+			server.ResetConnection(res)
+			return
+		}
+		if r := m.restarted(req); r != nil {
+			m.enforcePolicy(r.router).ServeHTTP(res, req)
+			return
+		}
+		next.ServeHTTP(res, req)
+	})
+}
+
+// terminated returns whether the instance served to the client of the request was terminated by its spot itn, or in
+// its auto scaling group if the client was eligible on its last request for the target lifecycle state
+func (m *Mock) terminated(req *http.Request) bool {
+	if m.features[Spot] {
+		if action, _, ok := m.spot.Interruption(req); ok && action == spot.Terminate {
+			return true
+		}
+	}
+	return m.features[ASGLifecycle] && m.asgLifecycle.Eligibility().IsEligible(server.ClientIP(req)) &&
+		m.asgLifecycle.Status().LifecycleState == asglifecycle.Terminated
+}
+
+// stopped returns whether the instance served to the client of the request is stopped or hibernated by its spot itn.
+// Once it has been down for the given time, the instance starts again.
+func (m *Mock) stopped(req *http.Request, downtime time.Duration) bool {
+	if !m.features[Spot] {
+		return false
+	}
+	m.restartMu.Lock()
+	defer m.restartMu.Unlock()
+	action, stoppedAt, ok := m.spot.Interruption(req)
+	if !ok || action != spot.Stop && action != spot.Hibernate {
+		return false
+	}
+	if m.clock.Now().Before(stoppedAt.Add(downtime)) {
+		return true
+	}
+	m.restart(server.ClientIP(req), stoppedAt)
+	return false
+}
+
+// restart is an instance of a client that started again after it was stopped or hibernated
+type restart struct {
+	stoppedAt  time.Time
+	publicIpv4 string
+	// router serves the metadata of the instance, with its new public IPv4
+	router *server.Router
+}
+
+// restart starts the instance of the client with the given IP again after it was stopped or hibernated at the given
+// time: its spot notices are withdrawn and it gets a new public IPv4, like instances do. Other clients are not affected.
+func (m *Mock) restart(ip string, stoppedAt time.Time) {
+	m.spot.Restart(ip, m.clock.Now())
+	c := m.Config()
+	sum := sha256.Sum256([]byte(c.Metadata.Values.InstanceID + "/" + ip + "/" + stoppedAt.UTC().Format(time.RFC3339)))
+	r := &restart{stoppedAt: stoppedAt, publicIpv4: fmt.Sprintf("54.%d.%d.%d", sum[0], sum[1], sum[2]%254+1)}
+	if err := m.routeRestart(r, c); err != nil {
+		log.Printf("Failed to update the public ipv4 of the instance of %s started again: %v", ip, err)
+		return
+	}
+	m.restartsMu.Lock()
+	m.restarts[ip] = r
+	m.restartsMu.Unlock()
+	log.Printf("Instance of %s started again with public ipv4 %s after it was stopped at %s", ip, r.publicIpv4, stoppedAt.UTC().Format(time.RFC3339))
+}
+
+// routeRestart sets the router of the restarted instance to serve config with the public IPv4 of the instance
+func (m *Mock) routeRestart(r *restart, config cfg.Config) error {
+	values, err := json.Marshal(fleet.PublicIpv4Values(config.Metadata.Values, r.publicIpv4))
+	if err != nil {
+		return err
+	}
+	if err := admin.SetValues(&config, "metadata", values); err != nil {
+		return err
+	}
+	r.router = m.newRouter(config, nil)
+	return nil
+}
+
+// restarted returns the instance of the client of the request, if it started again after it was stopped or hibernated
+func (m *Mock) restarted(req *http.Request) *restart {
+	m.restartsMu.Lock()
+	defer m.restartsMu.Unlock()
+	return m.restarts[server.ClientIP(req)]
+}
+
+// rerouteRestarts serves config to the instances that started again, keeping their public IPv4
+func (m *Mock) rerouteRestarts(config cfg.Config) {
+	m.restartsMu.Lock()
+	defer m.restartsMu.Unlock()
+	for ip, r := range m.restarts {
+		if err := m.routeRestart(r, config); err != nil {
+			log.Printf("Failed to reload the instance of %s started again: %v", ip, err)
+		}
+	}
+}
+
+// ValidateAfterInterruption returns the errors in the after interruption config, with keys prefixed with keyPrefix
+func ValidateAfterInterruption(keyPrefix string, c cfg.AfterInterruption) []string {
+	var errStrings []string
+	if c.Terminated != "" && !slices.Contains(TerminatedModes, c.Terminated) {
+		errStrings = append(errStrings, e.FlagValidationError{
+			FlagName:     keyPrefix + "terminated",
+			Allowed:      strings.Join(TerminatedModes, ","),
+			InvalidValue: c.Terminated,
+		}.Error())
+	}
+	if c.StoppedForSec < 0 {
+		errStrings = append(errStrings, e.FlagValidationError{
+			FlagName:     keyPrefix + "stopped-for-sec",
+			Allowed:      "0 or more seconds",
+			InvalidValue: fmt.Sprint(c.StoppedForSec),
+		}.Error())
+	}
+	return errStrings
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package mock
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+const publicIpv4Path = "/latest/meta-data/public-ipv4"
+
+// serveClient serves a request to path from the client with the given remote address with the handlers of m
+func serveClient(m *Mock, path string, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	res := httptest.NewRecorder()
+	m.server.Handler().ServeHTTP(res, req)
+	return res
+}
+
+func TestRestartOnlyAffectsItsClient(t *testing.T) {
+	c := testConfig(t)
+	c.MockIPCount = 1
+	c.SpotConfig.InstanceAction = spot.Stop
+	c.AfterInterruption = cfg.AfterInterruption{StoppedForSec: 60}
+	m := New(c)
+	m.Clock().Freeze()
+	const restarted, other = "10.0.0.1:4000", "10.0.0.2:4000"
+	publicIpv4 := serveClient(m, publicIpv4Path, restarted).Body.String()
+
+	h.Assert(t, serveClient(m, spotPath, restarted).Code == http.StatusOK, "Expected the spot itn for the first client")
+	m.Clock().Advance(150 * time.Second)
+	h.Assert(t, serveClient(m, instanceIDPath, other).Code == http.StatusOK, "Expected another client to be served while the instance is stopped")
+	m.Clock().Advance(time.Minute)
+	res := serveClient(m, spotPath, restarted)
+	h.Assert(t, res.Code == http.StatusNotFound, fmt.Sprintf("Expected no spot itn once started again, but was %d", res.Code))
+	newPublicIpv4 := serveClient(m, publicIpv4Path, restarted).Body.String()
+	h.Assert(t, newPublicIpv4 != publicIpv4, fmt.Sprintf("Expected a new public ipv4 instead of %s", publicIpv4))
+
+	res = serveClient(m, publicIpv4Path, other)
+	h.Assert(t, res.Body.String() == publicIpv4, fmt.Sprintf("Expected the public ipv4 %s for another client, but was %s", publicIpv4, res.Body.String()))
+	h.Assert(t, !m.spot.Schedule(spot.ITN).Canceled, "Expected the spot itn not to be canceled for other clients")
+	m.Clock().Advance(time.Second)
+	m.spot.Trigger(spot.ITN, m.Clock().Now(), "")
+	h.Assert(t, serveClient(m, spotPath, restarted).Code == http.StatusOK, "Expected a spot itn triggered after the restart to be served")
+
+	// the restarted instance keeps its public ipv4 across reloads
+	h.Ok(t, m.Update(func(c *cfg.Config) error { c.Metadata.Values.Hostname = "reloaded"; return nil }))
+	res = serveClient(m, publicIpv4Path, restarted)
+	h.Assert(t, res.Body.String() == newPublicIpv4, fmt.Sprintf("Expected the public ipv4 %s after a reload, but was %s", newPublicIpv4, res.Body.String()))
+	res = serveClient(m, "/latest/meta-data/hostname", restarted)
+	h.Assert(t, res.Body.String() == "reloaded", fmt.Sprintf("Expected the reloaded hostname, but was %s", res.Body.String()))
+}
+
+func TestTerminationDoesNotRequireSpotPoll(t *testing.T) {
+	c := testConfig(t)
+	c.MockIPCount = 1
+	c.AfterInterruption = cfg.AfterInterruption{Terminated: Reset}
+	m := New(c)
+	m.Clock().Freeze()
+	req := httptest.NewRequest(http.MethodGet, instanceIDPath, nil)
+	req.RemoteAddr = "10.0.0.1:4000"
+
+	h.Assert(t, !m.terminated(req), "Expected the instance not to be terminated before the termination time")
+	m.Clock().Advance(3 * time.Minute)
+	h.Assert(t, m.terminated(req), "Expected the instance of a client that never polled the spot path to be terminated")
+	h.Assert(t, len(m.spot.Eligibility().State().Clients) == 0, "Expected the client not to become a client of spot itns")
+}
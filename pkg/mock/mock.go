@@ -0,0 +1,441 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package mock runs the EC2 metadata mock in-process. Every Mock owns its router, IMDSv2 tokens and
+// interruption state, so several mocks can be started in the same process, e.g. by parallel go tests:
+//
+//	c, _ := config.NewDefaultConfig()
+//	c.Server.Port = "0"
+//	m := mock.New(c)
+//	addr, err := m.Start(ctx)
+//	defer m.Close()
+package mock
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/access"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/admin"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/asglifecycle"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/dynamic"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/eligibility"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/fleet"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/handlers"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/imdsv2"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/scenario"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/signing"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/static"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/tree"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/versions"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+// Feature represents an interruption mock served in addition to the static, dynamic and userdata metadata
+type Feature string
+
+const (
+	// Spot serves spot interruption notices and rebalance recommendations
+	Spot Feature = "spot"
+	// Events serves scheduled maintenance events
+	Events Feature = "events"
+	// ASGLifecycle serves the auto scaling target lifecycle state
+	ASGLifecycle Feature = "asglifecycle"
+)
+
+// Mock is an EC2 metadata mock that does not share any state with other mocks
+type Mock struct {
+	mu        sync.Mutex
+	config    cfg.Config
+	features  map[Feature]bool
+	adminAddr string
+
+	server       *server.Server
+	adminServer  *server.Server
+	clock        *clock.Clock
+	policy       atomic.Pointer[access.Policy]
+	tokens       *imdsv2.TokenStore
+	spot         *spot.Mock
+	events       *events.Mock
+	asgLifecycle *asglifecycle.Mock
+	scenario     *scenario.Scheduler
+	resolver     atomic.Pointer[fleet.Resolver]
+	versions     atomic.Pointer[versions.Table]
+	signer       atomic.Pointer[signing.Signer]
+	// restartMu serializes starting instances again after a stop or hibernation
+	restartMu sync.Mutex
+
+	restartsMu sync.Mutex
+	// restarts holds the instances that started again after a stop or hibernation, by client IP
+	restarts map[string]*restart
+
+	membersMu sync.Mutex
+	members   map[string]*member
+	// ctx is the context the mock is started with, which also stops the token sweepers of its members
+	ctx context.Context
+}
+
+// handlerPair holds a tuple of a path and its associated handler
+type handlerPair struct {
+	path    string
+	handler server.HandlerType
+}
+
+// New returns a mock for the given config serving the given features; all features are served if none are given.
+// Interruption delays are relative to the time New is called.
+func New(config cfg.Config, features ...Feature) *Mock {
+	if len(features) == 0 {
+		features = []Feature{Spot, Events, ASGLifecycle}
+	}
+	m := newMock(config, newClock(config), features)
+	m.syncMembers(config)
+	return m
+}
+
+// newMock returns a mock for the given config serving the given features and telling time with clk
+func newMock(config cfg.Config, clk *clock.Clock, features []Feature) *Mock {
+	m := &Mock{
+		config:       config,
+		features:     make(map[Feature]bool),
+		server:       server.New(),
+		clock:        clk,
+		tokens:       imdsv2.NewTokenStore(config.Imdsv2MaxTokens, config.Imdsv2TokenSecret, clk),
+		spot:         spot.New(config, clk),
+		events:       events.New(config, clk),
+		asgLifecycle: asglifecycle.New(config, clk),
+		members:      make(map[string]*member),
+		restarts:     make(map[string]*restart),
+	}
+	for _, f := range features {
+		m.features[f] = true
+	}
+	m.scenario = scenario.NewScheduler(loadScenario(config), clk, m.runStep)
+	m.policy.Store(access.NewPolicy(config))
+	m.resolver.Store(fleet.NewResolver(config.Fleet))
+	m.versions.Store(versions.New(config.APIVersions))
+	m.server.Use(m.routeFleet(true))
+	if config.AdminPort != "" {
+		m.adminServer = server.New()
+		m.adminServer.Use(m.routeFleet(false))
+		m.adminServer.Use(m.authorizeAdmin)
+	} else {
+		m.server.Use(m.authorizeAdmin)
+	}
+	m.server.Use(m.routeVersion)
+	m.server.Use(m.runScenario)
+	m.server.Use(m.afterInterruption)
+	m.server.Use(m.enforcePolicy)
+	m.registerHandlers(config)
+	return m
+}
+
+// newClock returns a clock telling the mock time configured in config
+func newClock(config cfg.Config) *clock.Clock {
+	clk := clock.New()
+	if config.ClockStartTime != "" {
+		if t, err := time.Parse(time.RFC3339, config.ClockStartTime); err == nil {
+			clk.Set(t)
+		} else {
+			log.Printf("Ignoring invalid clock start time %s: %s", config.ClockStartTime, err)
+		}
+	} else {
+		clk.Advance(time.Duration(config.ClockOffsetInSec) * time.Second)
+	}
+	if config.FreezeClock {
+		clk.Freeze()
+	}
+	return clk
+}
+
+// Clock returns the clock telling the mock time, which can be changed to get past delays and token TTLs
+func (m *Mock) Clock() *clock.Clock {
+	return m.clock
+}
+
+// Config returns the config currently served by the mock
+func (m *Mock) Config() cfg.Config {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.config
+}
+
+// Start starts serving on the hostname and port in the config and returns the address the mock is bound to.
+// Use port "0" to bind to any free port. The mock shuts down when ctx is done, giving in-flight requests
+// the configured shutdown timeout to complete.
+func (m *Mock) Start(ctx context.Context) (string, error) {
+	c := m.Config()
+
+	m.server.ShutdownTimeout = time.Duration(c.Server.ShutdownTimeoutInSec) * time.Second
+	addr, err := m.server.Start(ctx, c.Server.HostName, c.Server.Port)
+	if err != nil {
+		return "", err
+	}
+	adminAddr := addr
+	if m.adminServer != nil {
+		m.adminServer.ShutdownTimeout = m.server.ShutdownTimeout
+		if adminAddr, err = m.adminServer.Start(ctx, c.Server.HostName, c.AdminPort); err != nil {
+			m.server.Close()
+			return "", err
+		}
+	}
+	m.mu.Lock()
+	m.adminAddr = adminAddr
+	m.mu.Unlock()
+	m.tokens.StartSweeper(ctx, time.Duration(c.Imdsv2SweepIntervalInSec)*time.Second)
+	m.startMembers(ctx)
+	m.scenario.Start(ctx, scenarioInterval)
+	return addr, nil
+}
+
+// AdminAddr returns the address the admin API is served on once the mock is started. It is the address returned by
+// Start, unless the config sets an admin port.
+func (m *Mock) AdminAddr() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.adminAddr
+}
+
+// Wait blocks until the mock stops serving
+func (m *Mock) Wait() error {
+	err := m.server.Wait()
+	if m.adminServer != nil {
+		if adminErr := m.adminServer.Wait(); err == nil {
+			err = adminErr
+		}
+	}
+	return err
+}
+
+// Shutdown stops serving once in-flight requests complete or ctx is done, whichever happens first
+func (m *Mock) Shutdown(ctx context.Context) error {
+	m.tokens.Close()
+	m.scenario.Close()
+	m.closeMembers()
+	var adminErr error
+	if m.adminServer != nil {
+		adminErr = m.adminServer.Shutdown(ctx)
+	}
+	return errors.Join(m.server.Shutdown(ctx), adminErr)
+}
+
+// Close stops serving immediately
+func (m *Mock) Close() error {
+	m.tokens.Close()
+	m.scenario.Close()
+	m.closeMembers()
+	if m.adminServer != nil {
+		m.adminServer.Close()
+	}
+	return m.server.Close()
+}
+
+// Reload applies the given config to a mock, swapping in handlers for all paths at once. Interruption delays
+// are not restarted, the mock time is not changed and the hostname and ports are not rebound. The token sweeper
+// is restarted if its interval changed.
+func (m *Mock) Reload(config cfg.Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reload(config)
+}
+
+// Update applies fn to a copy of the config currently served and reloads the mock with the result, unless fn
+// returns an error. Concurrent updates are applied one after another, so none of them is lost.
+func (m *Mock) Update(fn func(c *cfg.Config) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.config
+	if err := fn(&c); err != nil {
+		return err
+	}
+	m.reload(c)
+	return nil
+}
+
+// reload applies the given config; callers hold m.mu
+func (m *Mock) reload(config cfg.Config) {
+	m.config = config
+	m.spot.SetConfig(config)
+	m.events.SetConfig(config)
+	m.asgLifecycle.SetConfig(config)
+	m.tokens.SetMaxTokens(config.Imdsv2MaxTokens)
+	m.tokens.SetSecret(config.Imdsv2TokenSecret)
+	m.tokens.SetSweepInterval(time.Duration(config.Imdsv2SweepIntervalInSec) * time.Second)
+	m.policy.Store(access.NewPolicy(config))
+	m.resolver.Store(fleet.NewResolver(config.Fleet))
+	m.versions.Store(versions.New(config.APIVersions))
+	m.registerHandlers(config)
+	m.rerouteRestarts(config)
+	m.syncMembers(config)
+}
+
+// authorizeAdmin rejects admin requests without the admin token, if one is configured. Auto Scaling actions signed by
+// the AWS CLI or SDKs are accepted without it, as they cannot carry it.
+func (m *Mock) authorizeAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, admin.PathPrefix+"/") && !admin.SignedAutoScalingAction(req) && !admin.Authorized(res, req, m.Config().AdminToken) {
+			return
+		}
+		next.ServeHTTP(res, req)
+	})
+}
+
+// routeVersion serves requests sent to a dated version of the metadata API from the latest paths, if the requested path
+// existed in the version
+func (m *Mock) routeVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		version, path, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+		table := m.versions.Load()
+		if !table.Serves(version) {
+			next.ServeHTTP(res, req)
+			return
+		}
+		if !table.Exists(version, path) {
+			server.ReturnNotFoundResponse(res)
+			return
+		}
+		req = versions.WithVersion(req, version)
+		u := *req.URL
+		u.Path, u.RawPath = strings.TrimSuffix("/"+versions.Latest+"/"+path, "/"), ""
+		req.URL = &u
+		next.ServeHTTP(res, req)
+	})
+}
+
+// enforcePolicy applies the current metadata options to every request before it reaches its handler
+func (m *Mock) enforcePolicy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, admin.PathPrefix+"/") {
+			next.ServeHTTP(res, req)
+			return
+		}
+		m.policy.Load().Enforce(res, req, m.tokens, next)
+	})
+}
+
+// registerHandlers binds the paths of the metadata tree of config and of all served features to their handlers, then
+// swaps them in at once
+func (m *Mock) registerHandlers(config cfg.Config) {
+	if m.adminServer == nil {
+		m.server.Swap(m.newRouter(config, m.getAdminHandlerPairs()))
+		return
+	}
+	adminRouter := server.NewRouter()
+	for _, handlerPair := range m.getAdminHandlerPairs() {
+		adminRouter.HandleFunc(handlerPair.path, handlerPair.handler)
+	}
+	m.server.Swap(m.newRouter(config, nil))
+	m.adminServer.Swap(adminRouter)
+}
+
+// newRouter returns a router binding the paths of the metadata tree of config, of all served features and the given
+// admin paths to their handlers
+func (m *Mock) newRouter(config cfg.Config, adminHandlerPairs []handlerPair) *server.Router {
+	router := server.NewRouter()
+	t := tree.Load(config)
+	m.signIdentity(t, config)
+	for _, handlerPair := range m.getHandlerPairs(config) {
+		t.Handle(handlerPair.path, handlerPair.handler)
+	}
+	listings := handlers.NewListings(t, m.versions.Load())
+	for _, path := range []string{"/", "/latest", static.ServicePath, dynamic.ServicePath} {
+		router.HandleFunc(path, listings.ListRoutesHandler)
+	}
+	for _, path := range t.Paths() {
+		router.HandleFunc(path, t.Handler(path))
+	}
+	for _, handlerPair := range adminHandlerPairs {
+		router.HandleFunc(handlerPair.path, handlerPair.handler)
+	}
+
+	// paths without explicit handler bindings will fallback to CatchAllHandler
+	router.HandleFuncPrefix("/", listings.CatchAllHandler)
+	return router
+}
+
+// getHandlerPairs returns a slice of {paths, handlers} to add to the metadata tree
+func (m *Mock) getHandlerPairs(config cfg.Config) []handlerPair {
+	// always register these paths
+	handlerPairs := []handlerPair{
+		{path: "/latest/api/token", handler: m.tokens.GenerateToken},
+	}
+
+	if m.features[Spot] {
+		handlerPairs = append(handlerPairs,
+			handlerPair{path: config.Metadata.Paths.Spot, handler: m.spot.Handler},
+			handlerPair{path: config.Metadata.Paths.SpotTerminationTime, handler: m.spot.Handler},
+			handlerPair{path: config.Metadata.Paths.RebalanceRecTime, handler: m.spot.Handler})
+	}
+	if m.features[Events] {
+		handlerPairs = append(handlerPairs,
+			handlerPair{path: config.Metadata.Paths.Events, handler: m.events.Handler},
+			handlerPair{path: config.Metadata.Paths.EventsHistory, handler: m.events.Handler})
+	}
+	if m.features[ASGLifecycle] {
+		handlerPairs = append(handlerPairs, handlerPair{path: config.Metadata.Paths.ASGLifecycle, handler: m.asgLifecycle.Handler})
+	}
+	// the instance action follows spot itns and scheduled events, unless it was deleted
+	if (m.features[Spot] || m.features[Events]) && config.Metadata.Values.InstanceAction != "" {
+		handlerPairs = append(handlerPairs, handlerPair{path: config.Metadata.Paths.InstanceAction, handler: m.instanceActionHandler})
+	}
+
+	return handlerPairs
+}
+
+// getAdminHandlerPairs returns a slice of {paths, handlers} of the admin API
+func (m *Mock) getAdminHandlerPairs() []handlerPair {
+	handlerPairs := []handlerPair{
+		{path: admin.ClockPath, handler: admin.ClockHandler(m.clock)},
+		{path: admin.ValuesPath, handler: admin.ValuesHandler(m)},
+		{path: admin.ValuePath, handler: admin.ValuesHandler(m)},
+		{path: admin.ScenarioPath, handler: admin.ScenarioHandler(m.scenario)},
+		{path: admin.CertificatePath, handler: admin.CertificateHandler(m)},
+	}
+	if m.resolver.Load().Enabled() {
+		handlerPairs = append(handlerPairs, handlerPair{path: admin.FleetPath, handler: admin.FleetHandler(m)})
+	}
+	var trackers []*eligibility.Tracker
+	if m.features[Spot] {
+		trackers = append(trackers, m.spot.Eligibility())
+	}
+	if m.features[Events] {
+		trackers = append(trackers, m.events.Eligibility())
+	}
+	if m.features[ASGLifecycle] {
+		trackers = append(trackers, m.asgLifecycle.Eligibility())
+	}
+	handlerPairs = append(handlerPairs, handlerPair{path: admin.EligibilityPath, handler: admin.EligibilityHandler(trackers...)})
+	if m.features[Spot] {
+		handlerPairs = append(handlerPairs,
+			handlerPair{path: admin.SpotPath, handler: admin.SpotHandler(m.spot, m.clock)},
+			handlerPair{path: admin.ChaosPath, handler: admin.ChaosHandler(m.spot.Chaos())})
+	}
+	if m.features[Events] {
+		handlerPairs = append(handlerPairs,
+			handlerPair{path: admin.EventsPath, handler: admin.EventsHandler(m.events, m.clock)},
+			handlerPair{path: admin.EventPath, handler: admin.EventsHandler(m.events, m.clock)})
+	}
+	if m.features[ASGLifecycle] {
+		handlerPairs = append(handlerPairs, handlerPair{path: admin.AutoScalingPath, handler: admin.AutoScalingHandler(m.asgLifecycle)})
+	}
+	return handlerPairs
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package mock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/admin"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events"
+	eventscfg "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/scenario"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot"
+)
+
+// scenarioInterval is how often due scenario steps are run, in addition to before every request
+const scenarioInterval = 100 * time.Millisecond
+
+// loadScenario returns the scenario in config, or an empty scenario if none is configured or it cannot be loaded
+func loadScenario(config cfg.Config) scenario.Scenario {
+	if config.Scenario == "" {
+		return scenario.Scenario{}
+	}
+	s, err := LoadScenario(config)
+	if err != nil {
+		log.Printf("Ignoring scenario: %s", err)
+		return scenario.Scenario{}
+	}
+	return s
+}
+
+// LoadScenario reads and validates the scenario in config. Unlike scenario.Load, the values of set-values steps are
+// validated against the values of their section in config, e.g. unknown keys are rejected.
+func LoadScenario(config cfg.Config) (scenario.Scenario, error) {
+	s, err := scenario.Load(config.Scenario)
+	if err != nil {
+		return s, err
+	}
+	return s, validateSetValues(config, s)
+}
+
+// validateSetValues returns an error for each set-values step whose values cannot be set in config, e.g. unknown keys
+func validateSetValues(config cfg.Config, s scenario.Scenario) error {
+	var errs []error
+	for i, step := range s.Steps {
+		if step.Action != scenario.SetValues {
+			continue
+		}
+		// SetValues changes a copy of config, which shares no values it changes with config
+		c := config
+		if err := admin.SetValues(&c, step.Section, step.Values); err != nil {
+			errs = append(errs, fmt.Errorf("invalid scenario %s: step %d (%s): %w", config.Scenario, i, step.Action, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runScenario runs the scenario steps due at the current mock time before every request, so requests see their changes
+func (m *Mock) runScenario(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		m.scenario.RunDue()
+		next.ServeHTTP(res, req)
+	})
+}
+
+// runStep runs a scenario step due at the given time
+func (m *Mock) runStep(step scenario.Step, at time.Time) error {
+	switch step.Action {
+	case scenario.SetValues:
+		return m.Update(func(c *cfg.Config) error {
+			return admin.SetValues(c, step.Section, step.Values)
+		})
+	case scenario.SetMetadataOptions:
+		var options map[string]string
+		if err := json.Unmarshal(step.Values, &options); err != nil {
+			return err
+		}
+		return m.Update(func(c *cfg.Config) error {
+			for k, v := range options {
+				switch k {
+				case "http-tokens":
+					c.MetadataOptions.HTTPTokens = v
+				case "http-endpoint":
+					c.MetadataOptions.HTTPEndpoint = v
+				case "instance-metadata-tags":
+					c.MetadataOptions.InstanceMetadataTags = v
+				}
+			}
+			return nil
+		})
+	case scenario.SpotITN:
+		m.spot.Trigger(spot.ITN, at, step.InstanceAction)
+	case scenario.SpotRebalance:
+		m.spot.Trigger(spot.Rebalance, at, "")
+	case scenario.SpotCancel:
+		m.spot.Cancel(spot.Notice(step.Notice))
+	case scenario.AddEvent:
+		return m.events.Update(func(scheduled []eventscfg.Event) ([]eventscfg.Event, error) {
+			return append(scheduled, events.WithDefaults(*step.Event, at)), nil
+		})
+	case scenario.CancelEvent, scenario.CompleteEvent:
+		state := events.Canceled
+		if step.Action == scenario.CompleteEvent {
+			state = events.Completed
+		}
+		return m.events.Update(func(scheduled []eventscfg.Event) ([]eventscfg.Event, error) {
+			i := slices.IndexFunc(scheduled, func(e eventscfg.Event) bool { return e.EventID == step.EventID })
+			if i < 0 {
+				return nil, fmt.Errorf("unknown event %s", step.EventID)
+			}
+			scheduled[i].EventState = state
+			return scheduled, nil
+		})
+	case scenario.ASGTerminate:
+		m.asgLifecycle.Terminate(at)
+	default:
+		return fmt.Errorf("unknown action %s", step.Action)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package scenario runs scripted instance lifetimes: timed steps that change values, fire interruption notices and
+// toggle faults, run on the mock clock. A scenario is a JSON or YAML file, e.g.
+//
+//	{"steps": [
+//	  {"at-sec": 10, "action": "spot-rebalance"},
+//	  {"at-sec": 30, "action": "set-values", "section": "metadata", "values": {"public-ipv4": "54.10.10.10"}},
+//	  {"at-sec": 60, "action": "spot-itn", "instance-action": "stop"},
+//	  {"at-sec": 90, "action": "asg-terminate"}
+//	]}
+package scenario
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events"
+	eventscfg "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/events/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// SetValues sets the values of the keys in values in a section, like a PATCH of the admin values API
+	SetValues = "set-values"
+	// SetMetadataOptions sets the instance metadata options in values, e.g. {"http-endpoint": "disabled"}
+	SetMetadataOptions = "set-metadata-options"
+	// SpotITN serves a spot interruption notice with the instance action, terminate if not given
+	SpotITN = "spot-itn"
+	// SpotRebalance serves a rebalance recommendation
+	SpotRebalance = "spot-rebalance"
+	// SpotCancel cancels the spot notice, one of: itn, rebalance
+	SpotCancel = "spot-cancel"
+	// AddEvent adds a scheduled event, defaulting to a random id, the active state and the step time as not-before
+	AddEvent = "add-event"
+	// CancelEvent cancels the scheduled event with the event id
+	CancelEvent = "cancel-event"
+	// CompleteEvent completes the scheduled event with the event id
+	CompleteEvent = "complete-event"
+	// ASGTerminate terminates the instance in its auto scaling group
+	ASGTerminate = "asg-terminate"
+)
+
+var (
+	// Actions are the actions of scenario steps
+	Actions = []string{SetValues, SetMetadataOptions, SpotITN, SpotRebalance, SpotCancel, AddEvent, CancelEvent, CompleteEvent, ASGTerminate}
+
+	// sections are the sections of values a scenario can set, as in the admin values API
+	sections = []string{"metadata", "dynamic", "userdata"}
+
+	// metadataOptions are the metadata options a scenario can set and their allowed values
+	metadataOptions = map[string][]string{
+		"http-tokens":            {"optional", "required"},
+		"http-endpoint":          {"enabled", "disabled"},
+		"instance-metadata-tags": {"enabled", "disabled"},
+	}
+)
+
+// Scenario is a list of steps run on the mock clock
+type Scenario struct {
+	Steps []Step `json:"steps"`
+}
+
+// Step is an action run once the mock time reaches AtSec seconds after the mock started
+type Step struct {
+	Name           string           `json:"name,omitempty"`
+	AtSec          int64            `json:"at-sec"`
+	Action         string           `json:"action"`
+	Section        string           `json:"section,omitempty"`         // set-values: metadata, dynamic or userdata
+	Values         json.RawMessage  `json:"values,omitempty"`          // set-values, set-metadata-options: a JSON object
+	InstanceAction string           `json:"instance-action,omitempty"` // spot-itn
+	Notice         string           `json:"notice,omitempty"`          // spot-cancel
+	Event          *eventscfg.Event `json:"event,omitempty"`           // add-event
+	EventID        string           `json:"event-id,omitempty"`        // cancel-event, complete-event
+}
+
+// describe returns the action of the step, prefixed by its name if it has one
+func (step Step) describe() string {
+	if step.Name == "" {
+		return step.Action
+	}
+	return step.Name + " (" + step.Action + ")"
+}
+
+// Load reads and validates a scenario from a JSON file, or a YAML file if its extension is .yaml or .yml
+func Load(path string) (Scenario, error) {
+	var s Scenario
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return s, fmt.Errorf("invalid scenario %s: %w", path, err)
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return s, fmt.Errorf("invalid scenario %s: %w", path, err)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return s, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+	if err := s.Validate(); err != nil {
+		return s, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Validate returns an error for each invalid step
+func (s Scenario) Validate() error {
+	var errs []error
+	for i, step := range s.Steps {
+		if err := step.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("step %d (%s): %w", i, step.Action, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (step Step) validate() error {
+	if step.AtSec < 0 {
+		return fmt.Errorf("at-sec %d is negative", step.AtSec)
+	}
+	switch step.Action {
+	case SetValues:
+		if !slices.Contains(sections, step.Section) {
+			return fmt.Errorf("invalid section %q, expected one of %s", step.Section, strings.Join(sections, ","))
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(step.Values, &values); err != nil {
+			return fmt.Errorf("values must be a JSON object: %w", err)
+		}
+	case SetMetadataOptions:
+		var options map[string]string
+		if err := json.Unmarshal(step.Values, &options); err != nil {
+			return fmt.Errorf("values must be a JSON object of metadata options: %w", err)
+		}
+		for k, v := range options {
+			if allowed, ok := metadataOptions[k]; !ok || !slices.Contains(allowed, v) {
+				return fmt.Errorf("invalid metadata option %s: %s", k, v)
+			}
+		}
+	case SpotITN:
+		if step.InstanceAction != "" && !slices.Contains(spot.InstanceActions, step.InstanceAction) {
+			return fmt.Errorf("invalid instance-action %s, expected one of %s", step.InstanceAction, strings.Join(spot.InstanceActions, ","))
+		}
+	case SpotCancel:
+		if n := spot.Notice(step.Notice); n != spot.ITN && n != spot.Rebalance {
+			return fmt.Errorf("invalid notice %s, expected one of %s,%s", step.Notice, spot.ITN, spot.Rebalance)
+		}
+	case AddEvent:
+		if step.Event == nil || !slices.Contains(events.Codes, step.Event.EventCode) {
+			return fmt.Errorf("event with a code is required, expected one of %s", strings.Join(events.Codes, ","))
+		}
+	case CancelEvent, CompleteEvent:
+		if step.EventID == "" {
+			return errors.New("event-id is required")
+		}
+	case SpotRebalance, ASGTerminate:
+	default:
+		return fmt.Errorf("unknown action, expected one of %s", strings.Join(Actions, ","))
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+// startScheduler starts sch without running steps on its own, so tests run them with RunDue
+func startScheduler(t *testing.T, sch *Scheduler) {
+	sch.Start(context.Background(), time.Hour)
+	t.Cleanup(sch.Close)
+}
+
+func writeScenario(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	h.Ok(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadYAML(t *testing.T) {
+	path := writeScenario(t, "scenario.yaml", `
+steps:
+  - at-sec: 30
+    action: set-values
+    section: metadata
+    values:
+      public-ipv4: 54.10.10.10
+  - name: interruption
+    at-sec: 60
+    action: spot-itn
+    instance-action: stop
+`)
+	s, err := Load(path)
+	h.Ok(t, err)
+	h.Assert(t, len(s.Steps) == 2, fmt.Sprintf("Expected 2 steps, but was %d", len(s.Steps)))
+	h.Assert(t, string(s.Steps[0].Values) == `{"public-ipv4":"54.10.10.10"}`, fmt.Sprintf("Expected the values of the first step, but was %s", s.Steps[0].Values))
+	h.Assert(t, s.Steps[1].Name == "interruption" && s.Steps[1].InstanceAction == "stop", fmt.Sprintf("Expected the spot itn step, but was %+v", s.Steps[1]))
+}
+
+func TestLoadRejectsInvalidSteps(t *testing.T) {
+	path := writeScenario(t, "scenario.json", `{"steps": [
+		{"at-sec": -1, "action": "spot-rebalance"},
+		{"at-sec": 10, "action": "spot-itn", "instance-action": "reboot"},
+		{"at-sec": 20, "action": "set-metadata-options", "values": {"http-endpoint": "off"}},
+		{"at-sec": 30, "action": "cancel-event"},
+		{"at-sec": 40, "action": "reboot"},
+		{"at-sec": 50, "action": "set-values", "section": "meta-data", "values": {"instance-type": "m5.large"}},
+		{"at-sec": 60, "action": "set-values", "values": {"instance-type": "m5.large"}}
+	]}`)
+	_, err := Load(path)
+	h.Assert(t, err != nil, "Expected an error loading an invalid scenario")
+	h.Assert(t, strings.Count(err.Error(), "\n") == 6, fmt.Sprintf("Expected 7 invalid steps, but was %s", err))
+
+	path = writeScenario(t, "unknown-field.json", `{"steps": [{"at-sec": 10, "action": "spot-rebalance", "delay-sec": 10}]}`)
+	_, err = Load(path)
+	h.Assert(t, err != nil, "Expected an error loading a scenario with an unknown field")
+}
+
+func TestSchedulerRunsDueStepsInOrder(t *testing.T) {
+	clk := clock.New()
+	clk.Freeze()
+	start := clk.Now()
+	s := Scenario{Steps: []Step{
+		{Name: "third", AtSec: 90, Action: ASGTerminate},
+		{Name: "first", AtSec: 10, Action: SpotRebalance},
+		{Name: "second", AtSec: 10, Action: SpotITN},
+	}}
+	var ran []string
+	sch := NewScheduler(s, clk, func(step Step, at time.Time) error {
+		ran = append(ran, fmt.Sprintf("%s@%s", step.Name, at.Sub(start)))
+		if step.Name == "second" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	startScheduler(t, sch)
+
+	h.Assert(t, sch.RunDue() == 0, "Expected no steps to run before they are due")
+	clk.Advance(time.Minute)
+	h.Assert(t, sch.RunDue() == 2, "Expected the due steps to run")
+	h.Assert(t, sch.RunDue() == 0, "Expected steps to run once")
+	h.Assert(t, fmt.Sprint(ran) == "[first@10s second@10s]", fmt.Sprintf("Expected the due steps to run in order at their time, but was %v", ran))
+
+	results := sch.Results()
+	h.Assert(t, results[0].Name == "first" && results[0].Ran && results[0].Error == "", fmt.Sprintf("Expected the first step to have run, but was %+v", results[0]))
+	h.Assert(t, results[1].Error == "failed", fmt.Sprintf("Expected the error of the second step, but was %+v", results[1]))
+	h.Assert(t, !results[2].Ran, "Expected the third step not to have run")
+}
+
+func TestSchedulerRunsStepsWithoutHoldingLock(t *testing.T) {
+	clk := clock.New()
+	clk.Freeze()
+	var sch *Scheduler
+	ran := 0
+	sch = NewScheduler(Scenario{Steps: []Step{{Name: "first", AtSec: 10, Action: SpotITN}}}, clk, func(step Step, at time.Time) error {
+		// a step reloading the mock serves requests, which run due steps and read the results
+		h.Assert(t, sch.RunDue() == 0, "Expected a running step not to be run again")
+		h.Assert(t, !sch.Results()[0].Ran, "Expected the running step to be recorded once it has run")
+		ran++
+		return nil
+	})
+	startScheduler(t, sch)
+
+	clk.Advance(time.Minute)
+	h.Assert(t, sch.RunDue() == 1 && ran == 1, fmt.Sprintf("Expected the due step to run once, but ran %d times", ran))
+	h.Assert(t, sch.Results()[0].Ran, "Expected the step to be recorded as run")
+}
+
+func TestSchedulerRunsStepsRelativeToStart(t *testing.T) {
+	clk := clock.New()
+	clk.Freeze()
+	var ranAt time.Time
+	sch := NewScheduler(Scenario{Steps: []Step{{AtSec: 10, Action: SpotITN}}}, clk, func(step Step, at time.Time) error {
+		ranAt = at
+		return nil
+	})
+
+	clk.Advance(time.Minute)
+	h.Assert(t, sch.RunDue() == 0, "Expected no steps to run before the scheduler is started")
+	h.Assert(t, sch.Results()[0].Time == "", fmt.Sprintf("Expected no step time before the scheduler is started, but was %s", sch.Results()[0].Time))
+	start := clk.Now()
+	startScheduler(t, sch)
+	h.Assert(t, sch.RunDue() == 0, "Expected steps to be due relative to the time the scheduler is started")
+	h.Assert(t, sch.Results()[0].Time == start.Add(10*time.Second).UTC().Format(time.RFC3339), fmt.Sprintf("Expected the step time relative to the start, but was %s", sch.Results()[0].Time))
+
+	clk.Advance(10 * time.Second)
+	h.Assert(t, sch.RunDue() == 1, "Expected the step to run once due")
+	h.Assert(t, ranAt.Equal(start.Add(10*time.Second)), fmt.Sprintf("Expected the step to run at 10s after the start, but was %s", ranAt.Sub(start)))
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package scenario
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+)
+
+// Result reports when a step is due and whether it has run
+type Result struct {
+	Step
+	Time  string `json:"time,omitempty"`
+	Ran   bool   `json:"ran"`
+	Error string `json:"error,omitempty"`
+}
+
+// Scheduler runs the steps of a scenario once the mock time reaches them
+type Scheduler struct {
+	mu        sync.Mutex
+	clock     *clock.Clock
+	started   bool
+	startTime time.Time
+	results   []Result
+	next      int
+	run       func(step Step, at time.Time) error
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewScheduler returns a scheduler running the steps of s with run, relative to the mock time it is started at. Steps
+// are run in the order of their time; steps due at the same time are run in the order of the scenario.
+func NewScheduler(s Scenario, clk *clock.Clock, run func(step Step, at time.Time) error) *Scheduler {
+	sch := &Scheduler{
+		clock: clk,
+		run:   run,
+		stop:  make(chan struct{}),
+	}
+	steps := slices.Clone(s.Steps)
+	slices.SortStableFunc(steps, func(a, b Step) int { return cmp.Compare(a.AtSec, b.AtSec) })
+	for _, step := range steps {
+		sch.results = append(sch.results, Result{Step: step})
+	}
+	return sch
+}
+
+// RunDue runs the steps due at the current mock time that have not run yet and returns how many were run. No steps
+// are due before the scheduler is started. Steps are run without holding the lock, as running a step may reload the
+// mock while requests are served.
+func (s *Scheduler) RunDue() int {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return 0
+	}
+	now := s.clock.Now()
+	first := s.next
+	var times []time.Time
+	for ; s.next < len(s.results); s.next++ {
+		at := s.stepTime(s.results[s.next].Step)
+		if now.Before(at) {
+			break
+		}
+		times = append(times, at)
+	}
+	due := slices.Clone(s.results[first:s.next])
+	s.mu.Unlock()
+
+	errs := make([]error, len(due))
+	for i, r := range due {
+		errs[i] = s.run(r.Step, times[i])
+		if errs[i] != nil {
+			log.Printf("Failed to run scenario step %d %s: %s", first+i, r.describe(), errs[i])
+		} else {
+			log.Printf("Ran scenario step %d %s due at %s", first+i, r.describe(), r.Time)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, err := range errs {
+		r := &s.results[first+i]
+		r.Ran = true
+		if err != nil {
+			r.Error = err.Error()
+		}
+	}
+	return len(due)
+}
+
+// Start sets the times of the steps relative to the current mock time, unless the scheduler was started before, and
+// runs due steps every interval until ctx is done or the scheduler is closed. Changes of the mock time are picked up
+// within interval, or on RunDue.
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	s.mu.Lock()
+	if !s.started {
+		s.started = true
+		s.startTime = s.clock.Now()
+		for i := range s.results {
+			s.results[i].Time = s.stepTime(s.results[i].Step).UTC().Format(time.RFC3339)
+		}
+	}
+	s.mu.Unlock()
+	if len(s.results) == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.RunDue()
+			case <-ctx.Done():
+				return
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the scheduler
+func (s *Scheduler) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// Results returns the steps of the scenario in the order they are run, and whether they have run. Steps are given
+// their time once the scheduler is started.
+func (s *Scheduler) Results() []Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.results)
+}
+
+func (s *Scheduler) stepTime(step Step) time.Time {
+	return s.startTime.Add(time.Duration(step.AtSec) * time.Second)
+}
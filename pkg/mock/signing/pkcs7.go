@@ -0,0 +1,152 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package signing
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"slices"
+	"time"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+)
+
+// contentInfo is a PKCS#7 ContentInfo, with its content tagged [0]
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// signedData is a PKCS#7 SignedData without certificates and CRLs
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+// signerInfo is a PKCS#7 SignerInfo, with its authenticated attributes tagged [0]
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// signPKCS7 returns the DER encoded PKCS#7 signed data containing the content, signed with SHA256 with RSA over
+// authenticated attributes holding the digest of the content and the signing time
+func signPKCS7(key *rsa.PrivateKey, cert *x509.Certificate, content []byte, signingTime time.Time) ([]byte, error) {
+	digest := sha256.Sum256(content)
+	attributes, err := marshalAttributes(digest[:], signingTime)
+	if err != nil {
+		return nil, err
+	}
+	// the signature is over the DER encoding of the attributes as a SET, not as tagged in the signer info
+	set, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: attributes})
+	if err != nil {
+		return nil, err
+	}
+	setDigest := sha256.Sum256(set)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, setDigest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	sha256Algorithm := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	signed, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Algorithm},
+		ContentInfo:      contentInfo{ContentType: oidData, Content: explicit(data)},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+				SerialNumber: cert.SerialNumber,
+			},
+			DigestAlgorithm:           sha256Algorithm,
+			AuthenticatedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attributes},
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+			EncryptedDigest:           signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: explicit(signed)})
+}
+
+// marshalAttributes returns the DER encodings of the content type, message digest and signing time attributes,
+// sorted as the elements of a SET
+func marshalAttributes(digest []byte, signingTime time.Time) ([]byte, error) {
+	var encoded [][]byte
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidContentType, oidData},
+		{oidMessageDigest, digest},
+		{oidSigningTime, signingTime.UTC()},
+	} {
+		value, err := asn1.Marshal(a.value)
+		if err != nil {
+			return nil, err
+		}
+		attr, err := asn1.Marshal(attribute{
+			Type:   a.oid,
+			Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, attr)
+	}
+	slices.SortFunc(encoded, bytes.Compare)
+	return bytes.Join(encoded, nil), nil
+}
+
+// explicit returns the DER encoded value explicitly tagged [0]
+func explicit(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
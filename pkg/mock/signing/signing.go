@@ -0,0 +1,211 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package signing signs instance identity documents the way IMDS does, with a local key and certificate instead of
+// the keys of AWS, so that verification code can be tested against the certificate of the mock.
+package signing
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
+)
+
+const (
+	// keyBits is the size of generated keys, and the size of the keys signing rsa2048
+	keyBits = 2048
+	// lineLength is the length of the lines of base64 encoded signatures, as IMDS serves them
+	lineLength = 76
+)
+
+// generated returns the key and certificate generated for this process, shared by all mocks, e.g. of a fleet
+var generated = sync.OnceValues(func() (*Signer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"amazon-ec2-metadata-mock"}, CommonName: "instance identity"},
+		// valid at any mock time a test is likely to set
+		NotBefore: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:  time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{key: key, cert: cert}, nil
+})
+
+// Signer signs instance identity documents with an RSA key, verifiable with its certificate
+type Signer struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+// Load returns a signer for the key and certificate files in config, or the signer generated for this process if
+// neither is set
+func Load(config cfg.Signing) (*Signer, error) {
+	if config.KeyFile == "" && config.CertificateFile == "" {
+		return generated()
+	}
+	key, err := loadKey(config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := loadCertificate(config.CertificateFile)
+	if err != nil {
+		return nil, err
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		return nil, errors.New("the certificate does not match the key")
+	}
+	return &Signer{key: key, cert: cert}, nil
+}
+
+// Certificate returns the PEM encoded certificate verifying the signatures
+func (s *Signer) Certificate() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.cert.Raw})
+}
+
+// Signature returns the base64 encoded SHA256 with RSA signature of the document, as served on
+// dynamic/instance-identity/signature
+func (s *Signer) Signature(document []byte) (string, error) {
+	digest := sha256.Sum256(document)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return encode(signature), nil
+}
+
+// PKCS7 returns the base64 encoded PKCS#7 signed data containing the document, as served on
+// dynamic/instance-identity/pkcs7, without the PEM header and footer. It does not contain the certificate, which
+// verifiers are expected to have.
+func (s *Signer) PKCS7(document []byte, signingTime time.Time) (string, error) {
+	signedData, err := signPKCS7(s.key, s.cert, document, signingTime)
+	if err != nil {
+		return "", err
+	}
+	return encode(signedData), nil
+}
+
+// RSA2048 returns the PKCS#7 signed data of the document like PKCS7, as served on dynamic/instance-identity/rsa2048.
+// IMDS signs it with an RSA key of 2048 bits, so it fails for keys of any other size, which verifiers of rsa2048
+// would not expect.
+func (s *Signer) RSA2048(document []byte, signingTime time.Time) (string, error) {
+	if bits := s.key.N.BitLen(); bits != keyBits {
+		return "", fmt.Errorf("rsa2048 is signed with a key of %d bits, but the key has %d bits", keyBits, bits)
+	}
+	return s.PKCS7(document, signingTime)
+}
+
+// encode returns data base64 encoded, in lines of lineLength
+func encode(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var lines []string
+	for len(encoded) > lineLength {
+		lines = append(lines, encoded[:lineLength])
+		encoded = encoded[lineLength:]
+	}
+	return strings.Join(append(lines, encoded), "\n")
+}
+
+// loadKey returns the RSA key in the PEM file, in PKCS#1 or PKCS#8 form
+func loadKey(file string) (*rsa.PrivateKey, error) {
+	block, err := loadPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("there is no RSA key in %s: %w", file, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("the key in %s is not an RSA key", file)
+	}
+	return rsaKey, nil
+}
+
+// loadCertificate returns the certificate in the PEM file
+func loadCertificate(file string) (*x509.Certificate, error) {
+	block, err := loadPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("there is no certificate in %s: %w", file, err)
+	}
+	return cert, nil
+}
+
+// loadPEM returns the first PEM block of the file
+func loadPEM(file string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("there is no PEM data in %s", file)
+	}
+	return block, nil
+}
+
+// ValidateSigning returns the errors in the signing config, with keys prefixed with keyPrefix
+func ValidateSigning(keyPrefix string, config cfg.Signing) []string {
+	if config.KeyFile == "" && config.CertificateFile == "" {
+		return nil
+	}
+	if config.KeyFile == "" || config.CertificateFile == "" {
+		return []string{e.FlagValidationError{
+			FlagName:     keyPrefix + "key-file",
+			Allowed:      "set together with " + keyPrefix + "certificate-file",
+			InvalidValue: config.KeyFile,
+		}.Error()}
+	}
+	if _, err := Load(config); err != nil {
+		return []string{e.FlagValidationError{
+			FlagName:     keyPrefix + "key-file",
+			Allowed:      "a PEM encoded RSA key matching " + keyPrefix + "certificate-file: " + err.Error(),
+			InvalidValue: config.KeyFile,
+		}.Error()}
+	}
+	return nil
+}
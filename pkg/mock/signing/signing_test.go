@@ -0,0 +1,142 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package signing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+var document = []byte("{\n\t\"instanceId\" : \"i-1234567890abcdef0\"\n}")
+
+func TestSignatureVerifiesWithCertificate(t *testing.T) {
+	s, err := Load(cfg.Signing{})
+	h.Ok(t, err)
+	cert := parseCertificate(t, s.Certificate())
+
+	signature, err := s.Signature(document)
+	h.Ok(t, err)
+	for _, line := range strings.Split(signature, "\n") {
+		h.Assert(t, len(line) <= lineLength, fmt.Sprintf("Expected lines of at most %d characters, but was %d", lineLength, len(line)))
+	}
+	h.Ok(t, cert.CheckSignature(x509.SHA256WithRSA, document, decode(t, signature)))
+	h.Assert(t, cert.CheckSignature(x509.SHA256WithRSA, []byte("{}"), decode(t, signature)) != nil, "Expected the signature not to verify another document")
+}
+
+func TestPKCS7ContainsSignedDocument(t *testing.T) {
+	s, err := Load(cfg.Signing{})
+	h.Ok(t, err)
+	cert := parseCertificate(t, s.Certificate())
+	signingTime := time.Date(2024, 4, 11, 0, 0, 0, 0, time.UTC)
+
+	encoded, err := s.PKCS7(document, signingTime)
+	h.Ok(t, err)
+	var outer contentInfo
+	_, err = asn1.Unmarshal(decode(t, encoded), &outer)
+	h.Ok(t, err)
+	h.Assert(t, outer.ContentType.Equal(oidSignedData), fmt.Sprintf("Expected signed data, but was %s", outer.ContentType))
+	var signed signedData
+	_, err = asn1.Unmarshal(outer.Content.Bytes, &signed)
+	h.Ok(t, err)
+	var content []byte
+	_, err = asn1.Unmarshal(signed.ContentInfo.Content.Bytes, &content)
+	h.Ok(t, err)
+	h.Assert(t, bytes.Equal(content, document), fmt.Sprintf("Expected the document as content, but was %s", content))
+
+	h.Assert(t, len(signed.SignerInfos) == 1, fmt.Sprintf("Expected a single signer, but was %d", len(signed.SignerInfos)))
+	signer := signed.SignerInfos[0]
+	h.Assert(t, signer.IssuerAndSerialNumber.SerialNumber.Cmp(cert.SerialNumber) == 0, "Expected the serial number of the certificate")
+	digest := sha256.Sum256(document)
+	h.Assert(t, bytes.Contains(signer.AuthenticatedAttributes.Bytes, digest[:]), "Expected the digest of the document in the attributes")
+	set, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: signer.AuthenticatedAttributes.Bytes})
+	h.Ok(t, err)
+	h.Ok(t, cert.CheckSignature(x509.SHA256WithRSA, set, signer.EncryptedDigest))
+}
+
+func TestRSA2048RequiresKeyOf2048Bits(t *testing.T) {
+	s, err := Load(cfg.Signing{})
+	h.Ok(t, err)
+	encoded, err := s.RSA2048(document, time.Now())
+	h.Ok(t, err)
+	var outer contentInfo
+	_, err = asn1.Unmarshal(decode(t, encoded), &outer)
+	h.Ok(t, err)
+	h.Assert(t, outer.ContentType.Equal(oidSignedData), fmt.Sprintf("Expected signed data, but was %s", outer.ContentType))
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	h.Ok(t, err)
+	small := &Signer{key: key, cert: s.cert}
+	_, err = small.RSA2048(document, time.Now())
+	h.Assert(t, err != nil, "Expected an error for a key of 1024 bits")
+	_, err = small.PKCS7(document, time.Now())
+	h.Ok(t, err)
+}
+
+func TestLoadKeyAndCertificateFiles(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Load(cfg.Signing{})
+	h.Ok(t, err)
+	keyFile := writePEM(t, dir, "key.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(s.key))
+	certFile := writePEM(t, dir, "cert.pem", "CERTIFICATE", s.cert.Raw)
+
+	loaded, err := Load(cfg.Signing{KeyFile: keyFile, CertificateFile: certFile})
+	h.Ok(t, err)
+	h.Assert(t, bytes.Equal(loaded.Certificate(), s.Certificate()), "Expected the certificate of the file")
+
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	h.Ok(t, err)
+	otherFile := writePEM(t, dir, "other.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(other))
+	_, err = Load(cfg.Signing{KeyFile: otherFile, CertificateFile: certFile})
+	h.Assert(t, err != nil, "Expected an error for a key not matching the certificate")
+
+	h.Assert(t, len(ValidateSigning("signing.", cfg.Signing{KeyFile: keyFile, CertificateFile: certFile})) == 0, "Expected no errors for matching files")
+	h.Assert(t, len(ValidateSigning("signing.", cfg.Signing{KeyFile: keyFile})) == 1, "Expected an error for a key without certificate")
+	errs := ValidateSigning("signing.", cfg.Signing{KeyFile: otherFile, CertificateFile: certFile})
+	h.Assert(t, len(errs) == 1 && strings.Contains(errs[0], "signing.key-file"), fmt.Sprintf("Expected an error for a key not matching the certificate, but got %v", errs))
+}
+
+func parseCertificate(t *testing.T, data []byte) *x509.Certificate {
+	block, _ := pem.Decode(data)
+	h.Assert(t, block != nil && block.Type == "CERTIFICATE", "Expected a PEM encoded certificate")
+	cert, err := x509.ParseCertificate(block.Bytes)
+	h.Ok(t, err)
+	return cert
+}
+
+func decode(t *testing.T, encoded string) []byte {
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(encoded, "\n", ""))
+	h.Ok(t, err)
+	return data
+}
+
+func writePEM(t *testing.T, dir string, name string, blockType string, data []byte) string {
+	file := filepath.Join(dir, name)
+	h.Ok(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0600))
+	return file
+}
@@ -14,12 +14,16 @@
 package spot
 
 import (
+	"cmp"
 	"log"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
 
 	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/chaos"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/eligibility"
 	t "github.com/aws/amazon-ec2-metadata-mock/pkg/mock/spot/internal/types"
 	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
 )
@@ -28,51 +32,201 @@ const (
 	instanceActionPath  = "/latest/meta-data/spot/instance-action"
 	terminationTimePath = "/latest/meta-data/spot/termination-time"
 	rebalanceRecPath    = "/latest/meta-data/events/recommendations/rebalance"
+
+	// ITN is the spot interruption notice
+	ITN Notice = "itn"
+	// Rebalance is the rebalance recommendation
+	Rebalance Notice = "rebalance"
+
+	// itnWarningTime is how long a spot itn is served before the instance action is executed
+	itnWarningTime = 2 * time.Minute
+
+	// Terminate is the spot itn action terminating the instance
+	Terminate = "terminate"
+	// Hibernate is the spot itn action hibernating the instance
+	Hibernate = "hibernate"
+	// Stop is the spot itn action stopping the instance
+	Stop = "stop"
 )
 
-var (
-	eligibleIPs            = make(map[string]bool)
-	spotItnStartTime int64 = time.Now().Unix()
+// InstanceActions are the actions a spot itn can announce
+var InstanceActions = []string{Terminate, Hibernate, Stop}
+
+// Notice is a notice served by the spot mock
+type Notice string
+
+// Schedule tells when a notice is served. Notices are scheduled by the config, unless they are scheduled or canceled
+// at runtime.
+type Schedule struct {
+	// TriggerTime is when the notice is served from
+	TriggerTime string `json:"trigger-time,omitempty"`
+	// Action is the instance action of a spot itn; the configured action is served if empty
+	Action string `json:"action,omitempty"`
+	// Time is the termination time of a spot itn or the notice time of a rebalance recommendation. The time of the
+	// request is used if empty, plus 2 minutes for spot itns.
+	Time string `json:"time,omitempty"`
+	// Canceled notices are not served, nor are notices chaos mode does not serve to a client
+	Canceled bool `json:"canceled"`
+	// Source is "config", "runtime" or "chaos"
+	Source string `json:"source"`
+}
+
+// Mock serves spot interruption notices and rebalance recommendations
+type Mock struct {
+	mu               sync.RWMutex
+	clock            *clock.Clock
 	c                cfg.Config
-)
+	eligibility      *eligibility.Tracker
+	chaos            *chaos.Planner
+	spotItnStartTime int64
+	// schedules holds the notices scheduled or canceled at runtime, which take priority over the config
+	schedules map[Notice]Schedule
+	// restarts holds the time the instance of a client started again after its interruption, by client IP
+	restarts map[string]time.Time
+}
+
+// New returns a spot itn mock, starting its delays from the current mock time
+func New(config cfg.Config, clk *clock.Clock) *Mock {
+	return &Mock{
+		clock:            clk,
+		c:                config,
+		eligibility:      eligibility.New("spot", config, clk),
+		chaos:            chaos.New(config, clk),
+		spotItnStartTime: clk.Now().Unix(),
+		schedules:        make(map[Notice]Schedule),
+		restarts:         make(map[string]time.Time),
+	}
+}
+
+// Trigger schedules the notice to be served from the given time on, replacing its schedule. A spot itn announces
+// the given action, or the configured action if empty, with a termination time 2 minutes after the trigger time.
+func (m *Mock) Trigger(n Notice, triggerTime time.Time, action string) {
+	s := Schedule{
+		TriggerTime: triggerTime.UTC().Format(time.RFC3339),
+		Time:        triggerTime.UTC().Format(time.RFC3339),
+		Source:      "runtime",
+	}
+	if n == ITN {
+		s.Action = action
+		s.Time = triggerTime.UTC().Add(itnWarningTime).Format(time.RFC3339)
+	}
+	m.mu.Lock()
+	m.schedules[n] = s
+	m.mu.Unlock()
+	log.Printf("Scheduled %s at %s", n, s.TriggerTime)
+}
+
+// Cancel withdraws the notice, so it is not served until it is triggered again
+func (m *Mock) Cancel(n Notice) {
+	m.mu.Lock()
+	m.schedules[n] = Schedule{Canceled: true, Source: "runtime"}
+	m.mu.Unlock()
+	log.Printf("Canceled %s", n)
+}
+
+// Restart withdraws the notices triggered until the given time from the client with the given IP, as its instance
+// started again after its interruption. Notices triggered later are served to it again.
+func (m *Mock) Restart(ip string, startTime time.Time) {
+	m.mu.Lock()
+	m.restarts[ip] = startTime
+	m.mu.Unlock()
+	log.Printf("Withdrew the notices triggered until %s from %s", startTime.UTC().Format(time.RFC3339), ip)
+}
+
+// Schedule returns when the notice is served
+func (m *Mock) Schedule(n Notice) Schedule {
+	m.mu.RLock()
+	s, ok := m.schedules[n]
+	c := m.c
+	m.mu.RUnlock()
+	if ok {
+		return s
+	}
 
-// Mock starts spot itn mock
-func Mock(config cfg.Config) {
-	SetConfig(config)
-	server.ListenAndServe(config.Server.HostName, config.Server.Port)
+	s = Schedule{Source: "config"}
+	triggerTime, delay := c.MockTriggerTime, c.MockDelayInSec
+	if n == Rebalance {
+		triggerTime, delay = c.RebalanceTriggerTime, c.RebalanceDelayInSec
+		s.Time = c.SpotConfig.RebalanceRecTime
+	} else {
+		s.Action = c.SpotConfig.InstanceAction
+		s.Time = c.SpotConfig.TerminationTime
+	}
+	s.TriggerTime = triggerTime
+	if triggerTime == "" {
+		s.TriggerTime = time.Unix(m.spotItnStartTime+delay, 0).UTC().Format(time.RFC3339)
+	}
+	return s
 }
 
 // SetConfig sets the local config
-func SetConfig(config cfg.Config) {
-	c = config
+func (m *Mock) SetConfig(config cfg.Config) {
+	m.mu.Lock()
+	m.c = config
+	m.mu.Unlock()
+	m.eligibility.SetConfig(config)
+	m.chaos.SetConfig(config)
+}
+
+// Eligibility returns the tracker deciding which clients are served the mock
+func (m *Mock) Eligibility() *eligibility.Tracker {
+	return m.eligibility
+}
+
+// Chaos returns the planner deciding which clients chaos mode interrupts
+func (m *Mock) Chaos() *chaos.Planner {
+	return m.chaos
+}
+
+func (m *Mock) config() cfg.Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.c
 }
 
 // Handler processes http requests
-func Handler(res http.ResponseWriter, req *http.Request) {
-	// specify negative value to disable this feature
-	if c.MockIPCount >= 0 {
-		// req.RemoteAddr is formatted as IP:port
-		requestIP := strings.Split(req.RemoteAddr, ":")[0]
-		if !eligibleIPs[requestIP] {
-			if len(eligibleIPs) < c.MockIPCount {
-				eligibleIPs[requestIP] = true
-			} else {
-				log.Printf("Requesting IP %s is not eligible for Spot ITN or Rebalance Recommendation because the max number of IPs configured (%d) has been reached.\n", requestIP, c.MockIPCount)
-				server.ReturnNotFoundResponse(res)
-				return
-			}
-		}
+func (m *Mock) Handler(res http.ResponseWriter, req *http.Request) {
+	c := m.config()
+	if eligible, reason := m.eligibility.Eligible(req); !eligible {
+		log.Printf("Requesting IP %s is not eligible for Spot ITN or Rebalance Recommendation: %s\n", server.ClientIP(req), reason)
+		server.ReturnNotFoundResponse(res)
+		return
+	}
+	n := ITN
+	if req.URL.Path == rebalanceRecPath {
+		n = Rebalance
+	}
+	if triggerTime, err := time.Parse(time.RFC3339, m.schedule(n, req, c).TriggerTime); err == nil && m.withdrawn(req, triggerTime) {
+		log.Printf("The %s was withdrawn from %s, as its instance started again. Returning `notFoundResponse`", n, server.ClientIP(req))
+		server.ReturnNotFoundResponse(res)
+		return
 	}
 	switch req.URL.Path {
 	case instanceActionPath, terminationTimePath:
-		handleSpotITN(res, req)
+		m.handleSpotITN(res, req, c)
 	case rebalanceRecPath:
-		handleRebalance(res, req)
+		m.handleRebalance(res, req, c)
 	}
 }
 
-func handleSpotITN(res http.ResponseWriter, req *http.Request) {
-	requestTime := time.Now().Unix()
+func (m *Mock) handleSpotITN(res http.ResponseWriter, req *http.Request, c cfg.Config) {
+	s, ok := m.runtimeSchedule(ITN)
+	if !ok {
+		s, ok = m.chaosSchedule(ITN, req, c)
+	}
+	if ok {
+		if !m.served(ITN, s) {
+			server.ReturnNotFoundResponse(res)
+			return
+		}
+		if s.Action != "" {
+			c.SpotConfig.InstanceAction = s.Action
+		}
+		m.returnSpotITN(res, req, c, s.Time)
+		return
+	}
+
+	requestTime := m.clock.Now().Unix()
 	if c.MockTriggerTime != "" {
 		triggerTime, _ := time.Parse(time.RFC3339, c.MockTriggerTime)
 		delayRemaining := triggerTime.Unix() - requestTime
@@ -83,29 +237,46 @@ func handleSpotITN(res http.ResponseWriter, req *http.Request) {
 		}
 	} else {
 		delayInSeconds := c.MockDelayInSec
-		delayRemaining := delayInSeconds - (requestTime - spotItnStartTime)
+		delayRemaining := delayInSeconds - (requestTime - m.spotItnStartTime)
 		if delayRemaining > 0 {
 			log.Printf("Delaying the response by %ds as requested. The spot itn will be available in %ds. Returning `notFoundResponse` for now", delayInSeconds, delayRemaining)
 			server.ReturnNotFoundResponse(res)
 			return
 		}
 	}
-	// default time to requestTime + 2min, unless overridden
-	mockResponseTime := time.Now().UTC().Add(time.Minute * time.Duration(2)).Format(time.RFC3339)
-	if c.SpotConfig.TerminationTime != "" {
-		mockResponseTime = c.SpotConfig.TerminationTime
+	m.returnSpotITN(res, req, c, c.SpotConfig.TerminationTime)
+}
+
+// returnSpotITN returns the spot itn with the given termination time, defaulting to requestTime + 2min
+func (m *Mock) returnSpotITN(res http.ResponseWriter, req *http.Request, c cfg.Config, terminationTime string) {
+	mockResponseTime := m.clock.Now().UTC().Add(itnWarningTime).Format(time.RFC3339)
+	if terminationTime != "" {
+		mockResponseTime = terminationTime
 	}
 	// return mock response after the delay or trigger time has elapsed
 	switch req.URL.Path {
 	case instanceActionPath:
-		server.FormatAndReturnJSONResponse(res, getInstanceActionResponse(mockResponseTime))
+		server.FormatAndReturnJSONResponse(res, getInstanceActionResponse(c, mockResponseTime))
 	case terminationTimePath:
 		server.FormatAndReturnTextResponse(res, mockResponseTime)
 	}
 }
 
-func handleRebalance(res http.ResponseWriter, req *http.Request) {
-	requestTime := time.Now().Unix()
+func (m *Mock) handleRebalance(res http.ResponseWriter, req *http.Request, c cfg.Config) {
+	s, ok := m.runtimeSchedule(Rebalance)
+	if !ok {
+		s, ok = m.chaosSchedule(Rebalance, req, c)
+	}
+	if ok {
+		if !m.served(Rebalance, s) {
+			server.ReturnNotFoundResponse(res)
+			return
+		}
+		server.FormatAndReturnJSONResponse(res, t.RebalanceRecommendationResponse{NoticeTime: s.Time})
+		return
+	}
+
+	requestTime := m.clock.Now().Unix()
 	if c.RebalanceTriggerTime != "" {
 		triggerTime, _ := time.Parse(time.RFC3339, c.RebalanceTriggerTime)
 		delayRemaining := triggerTime.Unix() - requestTime
@@ -116,7 +287,7 @@ func handleRebalance(res http.ResponseWriter, req *http.Request) {
 		}
 	} else {
 		delayInSeconds := c.RebalanceDelayInSec
-		delayRemaining := delayInSeconds - (requestTime - spotItnStartTime)
+		delayRemaining := delayInSeconds - (requestTime - m.spotItnStartTime)
 		if delayRemaining > 0 {
 			log.Printf("Delaying the response by %ds as requested. The rebalance rec will be available in %ds. Returning `notFoundResponse` for now", delayInSeconds, delayRemaining)
 			server.ReturnNotFoundResponse(res)
@@ -124,14 +295,115 @@ func handleRebalance(res http.ResponseWriter, req *http.Request) {
 		}
 	}
 	// default time to requestTime, unless overridden
-	mockResponseTime := time.Now().UTC().Format(time.RFC3339)
+	mockResponseTime := m.clock.Now().UTC().Format(time.RFC3339)
 	if c.SpotConfig.RebalanceRecTime != "" {
 		mockResponseTime = c.SpotConfig.RebalanceRecTime
 	}
 	server.FormatAndReturnJSONResponse(res, t.RebalanceRecommendationResponse{NoticeTime: mockResponseTime})
 }
 
-func getInstanceActionResponse(time string) t.InstanceActionResponse {
+// Interruption returns the instance action and termination time of the spot itn served to the client of the request,
+// if the client would be eligible for it and the termination time has passed
+func (m *Mock) Interruption(req *http.Request) (action string, terminationTime time.Time, ok bool) {
+	if !m.eligibility.WouldBeEligible(server.ClientIP(req)) {
+		return "", time.Time{}, false
+	}
+	action, triggerTime, terminationTime, ok := m.itn(req)
+	now := m.clock.Now()
+	return action, terminationTime, ok && !now.Before(triggerTime) && !now.Before(terminationTime)
+}
+
+// PendingAction returns the instance action of the spot itn served to the client of the request, if the client would
+// be eligible for it and the spot itn was triggered. It does not make the client a client of spot itns.
+func (m *Mock) PendingAction(req *http.Request) (string, bool) {
+	if !m.eligibility.WouldBeEligible(server.ClientIP(req)) {
+		return "", false
+	}
+	action, triggerTime, _, ok := m.itn(req)
+	return action, ok && !m.clock.Now().Before(triggerTime)
+}
+
+// itn returns the instance action, trigger time and termination time of the spot itn served to the client of the
+// request, unless it is canceled. Spot itns without a configured termination time are executed 2 minutes after their
+// trigger time, and spot itns without an action terminate.
+func (m *Mock) itn(req *http.Request) (action string, triggerTime time.Time, terminationTime time.Time, ok bool) {
+	c := m.config()
+	s := m.schedule(ITN, req, c)
+	triggerTime, err := time.Parse(time.RFC3339, s.TriggerTime)
+	if s.Canceled || err != nil || m.withdrawn(req, triggerTime) {
+		return "", time.Time{}, time.Time{}, false
+	}
+	terminationTime, err = time.Parse(time.RFC3339, s.Time)
+	if err != nil {
+		terminationTime = triggerTime.Add(itnWarningTime)
+	}
+	return cmp.Or(s.Action, c.SpotConfig.InstanceAction, Terminate), triggerTime, terminationTime, true
+}
+
+// schedule returns when the notice is served to the client of the request: as scheduled at runtime, else as decided
+// by chaos mode, else as configured
+func (m *Mock) schedule(n Notice, req *http.Request, c cfg.Config) Schedule {
+	s, ok := m.runtimeSchedule(n)
+	if !ok {
+		s, ok = m.chaosSchedule(n, req, c)
+	}
+	if !ok {
+		s = m.Schedule(n)
+	}
+	return s
+}
+
+// withdrawn reports whether a notice triggered at the given time is withdrawn from the client of the request, as its
+// instance started again since
+func (m *Mock) withdrawn(req *http.Request, triggerTime time.Time) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	startTime, ok := m.restarts[server.ClientIP(req)]
+	return ok && !triggerTime.After(startTime)
+}
+
+// chaosSchedule returns the schedule chaos mode decided on for the client of the request, if chaos mode is enabled.
+// Clients are served a rebalance recommendation from the time of their interruption, and a spot itn unless the action
+// is rebalance-only. Clients that are not interrupted are served neither.
+func (m *Mock) chaosSchedule(n Notice, req *http.Request, c cfg.Config) (Schedule, bool) {
+	if !m.chaos.Enabled() {
+		return Schedule{}, false
+	}
+	d := m.chaos.Decide(c.Metadata.Values.InstanceID, server.ClientIP(req))
+	if !d.Interrupted || n == ITN && d.Action == chaos.RebalanceOnly {
+		return Schedule{Canceled: true, Source: "chaos"}, true
+	}
+	s := Schedule{TriggerTime: d.Time, Time: d.Time, Source: "chaos"}
+	if n == ITN {
+		s.Action = d.Action
+		s.Time = d.At().UTC().Add(itnWarningTime).Format(time.RFC3339)
+	}
+	return s, true
+}
+
+// runtimeSchedule returns the schedule of the notice, if it was scheduled or canceled at runtime
+func (m *Mock) runtimeSchedule(n Notice) (Schedule, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.schedules[n]
+	return s, ok
+}
+
+// served reports whether a notice scheduled at runtime is served at the current mock time
+func (m *Mock) served(n Notice, s Schedule) bool {
+	if s.Canceled {
+		log.Printf("The %s was canceled. Returning `notFoundResponse`", n)
+		return false
+	}
+	triggerTime, _ := time.Parse(time.RFC3339, s.TriggerTime)
+	if delayRemaining := triggerTime.Unix() - m.clock.Now().Unix(); delayRemaining > 0 {
+		log.Printf("The %s is scheduled at %s. It will be available in %ds. Returning `notFoundResponse` for now", n, s.TriggerTime, delayRemaining)
+		return false
+	}
+	return true
+}
+
+func getInstanceActionResponse(c cfg.Config, time string) t.InstanceActionResponse {
 	return t.InstanceActionResponse{
 		Action: c.SpotConfig.InstanceAction,
 		Time:   time,
@@ -0,0 +1,65 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package spot
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/clock"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+func TestPendingActionDoesNotRegisterClients(t *testing.T) {
+	c, err := cfg.NewDefaultConfig()
+	h.Ok(t, err)
+	c.MockIPCount = 1
+	m := New(c, clock.New())
+	bystander := httptest.NewRequest("GET", "/latest/meta-data/instance-action", nil)
+	bystander.RemoteAddr = "10.0.0.1:4000"
+	client := httptest.NewRequest("GET", "/latest/meta-data/spot/instance-action", nil)
+	client.RemoteAddr = "10.0.0.2:4000"
+
+	action, ok := m.PendingAction(bystander)
+	h.Assert(t, ok && action == Terminate, fmt.Sprintf("Expected the action of the spot itn for a client that would be eligible, but was %q", action))
+	h.Assert(t, len(m.Eligibility().State().Clients) == 0, fmt.Sprintf("Expected no clients of spot itns, but was %v", m.Eligibility().State().Clients))
+	eligible, _ := m.Eligibility().Eligible(client)
+	h.Assert(t, eligible, "Expected the first client of spot itns to be eligible")
+	action, ok = m.PendingAction(client)
+	h.Assert(t, ok && action == Terminate, fmt.Sprintf("Expected the action of the spot itn, but was %q", action))
+	_, ok = m.PendingAction(bystander)
+	h.Assert(t, !ok, "Expected no pending action for a client that would not be eligible")
+}
+
+func TestSpotITNFollowsMockClock(t *testing.T) {
+	c, err := cfg.NewDefaultConfig()
+	h.Ok(t, err)
+	c.MockDelayInSec = 120
+	c.MockIPCount = 1
+	clk := clock.New()
+	m := New(c, clk)
+	get := func() int {
+		rr := httptest.NewRecorder()
+		m.Handler(rr, httptest.NewRequest(http.MethodGet, c.Metadata.Paths.Spot, nil))
+		return rr.Code
+	}
+
+	h.Assert(t, get() == http.StatusNotFound, "Expected no spot itn before the delay")
+	clk.Advance(2 * time.Minute)
+	h.Assert(t, get() == http.StatusOK, "Expected the spot itn once the mock time passed the delay")
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+)
+
+var (
+	// defaults is the default config, telling the fields that differ from their defaults from those that do not
+	defaults = sync.OnceValues(cfg.NewDefaultConfig)
+
+	// regionPattern matches the region of an availability zone, e.g. us-east-1 of us-east-1a or us-west-2-lax-1a
+	regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+`)
+)
+
+const (
+	// mdValuesKey and docKey prefix the config keys of the derived fields
+	mdValuesKey = "metadata.values."
+	docKey      = "dynamic.values.instance-identity-document."
+)
+
+// derive returns config with the fields duplicating metadata values derived from them, unless they are overridden:
+// placement-region from the availability zone, the hostnames from the local ipv4 and the region, and the instance id,
+// ami id, availability zone, region, private ip and instance type of the instance identity document from their
+// metadata values. A field is overridden if its key is set explicitly, even to its default, or if it differs from its
+// default, e.g. in a config built without viper.
+func derive(config cfg.Config) cfg.Config {
+	d, err := defaults()
+	if err != nil {
+		return config
+	}
+	deriveField := func(key string, field *string, defaultValue string, value string) {
+		if !config.ExplicitKeys[key] && *field == defaultValue && value != "" {
+			*field = value
+		}
+	}
+
+	md, mdDefaults := &config.Metadata.Values, d.Metadata.Values
+	deriveField(mdValuesKey+"placement-region", &md.PlacementRegion, mdDefaults.PlacementRegion, regionPattern.FindString(md.PlacementAvailabilityZone))
+	hostname := localHostname(md.LocalIpv4, md.PlacementRegion)
+	deriveField(mdValuesKey+"hostname", &md.Hostname, mdDefaults.Hostname, hostname)
+	deriveField(mdValuesKey+"local-hostname", &md.LocalHostName, mdDefaults.LocalHostName, hostname)
+	deriveField(mdValuesKey+"mac-local-hostname", &md.MacLocalHostname, mdDefaults.MacLocalHostname, hostname)
+
+	doc, docDefaults := &config.Dynamic.Values.InstanceIdentityDocument, d.Dynamic.Values.InstanceIdentityDocument
+	deriveField(docKey+"instanceid", &doc.InstanceId, docDefaults.InstanceId, md.InstanceID)
+	deriveField(docKey+"imageid", &doc.ImageId, docDefaults.ImageId, md.AmiID)
+	deriveField(docKey+"availabilityzone", &doc.AvailabilityZone, docDefaults.AvailabilityZone, md.PlacementAvailabilityZone)
+	deriveField(docKey+"region", &doc.Region, docDefaults.Region, md.PlacementRegion)
+	deriveField(docKey+"privateip", &doc.PrivateIp, docDefaults.PrivateIp, md.LocalIpv4)
+	deriveField(docKey+"instancetype", &doc.InstanceType, docDefaults.InstanceType, md.InstanceType)
+	return config
+}
+
+// localHostname returns the private DNS name of the ipv4 in the region, e.g. ip-10-0-7-10.ec2.internal in us-east-1,
+// or ip-10-0-7-10.eu-west-1.compute.internal elsewhere. It is empty if ipv4 is not an IPv4 address.
+func localHostname(ipv4 string, region string) string {
+	ip := net.ParseIP(ipv4)
+	if ip == nil || ip.To4() == nil || region == "" {
+		return ""
+	}
+	name := "ip-" + strings.ReplaceAll(ip.To4().String(), ".", "-")
+	if region == "us-east-1" {
+		return name + ".ec2.internal"
+	}
+	return name + "." + region + ".compute.internal"
+}
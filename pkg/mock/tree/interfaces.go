@@ -0,0 +1,106 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
+)
+
+// MacsPath is the path listing the macs of the network interfaces attached to the instance
+const MacsPath = "/latest/meta-data/network/interfaces/macs"
+
+// setInterfaces sets the attributes of the network interfaces as text values. The mac of an interface is served under
+// its mac unless it is an attribute. Empty attributes are not served.
+func (t *Tree) setInterfaces(interfaces []cfg.NetworkInterface) {
+	for _, ni := range interfaces {
+		prefix := MacsPath + "/" + ni.Mac
+		t.Set(prefix+"/mac", Value{Kind: Text, Data: ni.Mac})
+		t.setAttributes(prefix, ni.Attributes)
+	}
+}
+
+// setAttributes sets the attributes under prefix as text values, including the paths under maps
+func (t *Tree) setAttributes(prefix string, attributes map[string]interface{}) {
+	for name, value := range attributes {
+		path := prefix + "/" + strings.Trim(name, "/")
+		var text string
+		switch v := value.(type) {
+		case map[string]interface{}:
+			t.setAttributes(path, v)
+			continue
+		case []interface{}:
+			entries := make([]string, 0, len(v))
+			for _, entry := range v {
+				entries = append(entries, fmt.Sprint(entry))
+			}
+			text = strings.Join(entries, "\n")
+		case []string:
+			text = strings.Join(v, "\n")
+		default:
+			text = fmt.Sprint(v)
+		}
+		if text != "" {
+			t.Set(path, Value{Kind: Text, Data: text})
+		}
+	}
+}
+
+// ValidateInterfaces returns the errors in the network interfaces, with keys prefixed with keyPrefix
+func ValidateInterfaces(keyPrefix string, interfaces []cfg.NetworkInterface) []string {
+	var errStrings []string
+	macs := make(map[string]bool)
+	for i, ni := range interfaces {
+		key := fmt.Sprintf("%s[%d]", keyPrefix, i)
+		if _, err := net.ParseMAC(ni.Mac); err != nil || macs[strings.ToLower(ni.Mac)] {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     key + ".mac",
+				Allowed:      "a mac address of no other interface, e.g. 0e:49:61:0f:c3:11",
+				InvalidValue: ni.Mac,
+			}.Error())
+		}
+		macs[strings.ToLower(ni.Mac)] = true
+		errStrings = append(errStrings, validateAttributes(key+".attributes", ni.Attributes)...)
+	}
+	return errStrings
+}
+
+// validateAttributes returns the errors in the attributes of a network interface, with keys prefixed with keyPrefix
+func validateAttributes(keyPrefix string, attributes map[string]interface{}) []string {
+	var errStrings []string
+	for _, name := range slices.Sorted(maps.Keys(attributes)) {
+		key := keyPrefix + "." + name
+		switch v := attributes[name].(type) {
+		case map[string]interface{}:
+			errStrings = append(errStrings, validateAttributes(key, v)...)
+			continue
+		case []interface{}, []string, string, int, int64, float64, bool:
+			if strings.Trim(name, "/") != "" {
+				continue
+			}
+		}
+		errStrings = append(errStrings, e.FlagValidationError{
+			FlagName:     key,
+			Allowed:      "a named string, number, list or map of attributes",
+			InvalidValue: fmt.Sprint(attributes[name]),
+		}.Error())
+	}
+	return errStrings
+}
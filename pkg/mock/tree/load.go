@@ -0,0 +1,198 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/access"
+)
+
+var (
+	// jsonTextKeys are the keys of the metadata values IMDS serves as JSON in plain text
+	jsonTextKeys = map[string]bool{"elastic-inference-accelerator": true}
+
+	// placeholderPattern matches the metadata values in the paths of nodes by their keys, e.g. {mac}
+	placeholderPattern = regexp.MustCompile(`\{([a-z0-9-]+)\}`)
+)
+
+// Load returns the tree of the metadata, dynamic metadata and userdata in config, followed by the network interfaces
+// and the nodes of the metadata tree, which override the paths before them. Paths follow the metadata values they
+// contain, e.g. the paths of the mac address. Empty values, e.g. deleted via the admin API, are not served. Fields
+// duplicating metadata values are derived from them if derive-values is set.
+//
+// The typed config is read once into maps by config key with cfg.ByKey, rather than from viper, as configs built in
+// code never pass through viper. Serving and listing the tree does not use reflection.
+func Load(config cfg.Config) *Tree {
+	if config.DeriveValues {
+		config = derive(config)
+	}
+	t := New()
+	mdValues := cfg.ByKey(config.Metadata.Values)
+	for key, path := range substitute(cfg.ByKey(config.Metadata.Paths), mdValues) {
+		t.setValue(path, mdValues[key], jsonTextKeys[key])
+	}
+	dyValues := cfg.ByKey(config.Dynamic.Values)
+	for key, path := range cfg.ByKey(config.Dynamic.Paths) {
+		t.setValue(path.(string), dyValues[key], false)
+	}
+	udValues := cfg.ByKey(config.Userdata.Values)
+	for key, path := range cfg.ByKey(config.Userdata.Paths) {
+		value, _ := udValues[key].(string)
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			log.Printf("There was an issue decoding base64 data of %s: %s", path, err)
+			continue
+		}
+		if len(data) > 0 {
+			t.Set(path.(string), Value{Kind: Binary, Data: data})
+		}
+	}
+
+	t.setInterfaces(config.Metadata.Interfaces)
+	for _, n := range config.Metadata.Tree {
+		v, err := nodeValue(n)
+		if err != nil {
+			log.Printf("There was an issue loading the value of %s: %s", n.Path, err)
+			continue
+		}
+		t.Set(expand(n.Path, mdValues), v)
+	}
+
+	// instance tags are neither listed nor served unless instance-metadata-tags is enabled
+	if !access.NewPolicy(config).ServesInstanceTags() {
+		t.Delete(access.InstanceTagsPath)
+	}
+	return t
+}
+
+// setValue sets the value of a config field: strings are text, and other values are JSON, in plain text if asked
+func (t *Tree) setValue(path string, value interface{}, jsonText bool) {
+	if path == "" || value == nil || reflect.ValueOf(value).IsZero() {
+		return
+	}
+	switch v := value.(type) {
+	case string:
+		t.Set(path, Value{Kind: Text, Data: v})
+	default:
+		if !jsonText {
+			t.Set(path, Value{Kind: JSON, Data: v})
+			return
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			log.Printf("There was an issue formatting the value of %s: %s", path, err)
+			return
+		}
+		t.Set(path, Value{Kind: Text, Data: string(data)})
+	}
+}
+
+// substitute returns the metadata paths by their keys, with the metadata values they contain, e.g. the mac address, in
+// place of their defaults
+func substitute(paths map[string]interface{}, values map[string]interface{}) map[string]string {
+	substituted := make(map[string]string, len(paths))
+	for key, path := range paths {
+		substituted[key], _ = path.(string)
+	}
+	for valueKey, p := range cfg.GetMetadataPlaceholders() {
+		value, _ := values[valueKey].(string)
+		if value == "" || value == p.Default {
+			continue
+		}
+		for _, pathKey := range p.PathKeys {
+			elems := strings.Split(substituted[pathKey], "/")
+			for i, elem := range elems {
+				if elem == p.Default {
+					elems[i] = value
+				}
+			}
+			substituted[pathKey] = strings.Join(elems, "/")
+		}
+	}
+	return substituted
+}
+
+// expand returns the path of a node with the metadata values it contains by their keys, e.g. {mac}
+func expand(path string, values map[string]interface{}) string {
+	return placeholderPattern.ReplaceAllStringFunc(path, func(placeholder string) string {
+		if value, ok := values[strings.Trim(placeholder, "{}")].(string); ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// nodeValue returns the value of a node in the format of its type
+func nodeValue(n cfg.Node) (Value, error) {
+	switch Kind(n.Type) {
+	case Binary:
+		s, _ := n.Value.(string)
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Kind: Binary, Data: data}, nil
+	case JSON:
+		return Value{Kind: JSON, Data: n.Value}, nil
+	case Text:
+		return Value{Kind: Text, Data: fmt.Sprint(n.Value)}, nil
+	}
+	switch n.Value.(type) {
+	case map[string]interface{}, []interface{}:
+		return Value{Kind: JSON, Data: n.Value}, nil
+	default:
+		return Value{Kind: Text, Data: fmt.Sprint(n.Value)}, nil
+	}
+}
+
+// ValidateTree returns the errors in the nodes of the metadata tree, with keys prefixed with keyPrefix
+func ValidateTree(keyPrefix string, nodes []cfg.Node) []string {
+	var errStrings []string
+	for i, n := range nodes {
+		key := fmt.Sprintf("%s[%d]", keyPrefix, i)
+		if !strings.HasPrefix(n.Path, "/latest/") || len(elements(n.Path)) < 2 {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     key + ".path",
+				Allowed:      "a path under /latest/, e.g. /latest/meta-data/foo/bar",
+				InvalidValue: n.Path,
+			}.Error())
+		}
+		if n.Type != "" && !slices.Contains(Kinds, n.Type) {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     key + ".type",
+				Allowed:      strings.Join(Kinds, ","),
+				InvalidValue: n.Type,
+			}.Error())
+			continue
+		}
+		if _, err := nodeValue(n); err != nil || n.Value == nil {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     key + ".value",
+				Allowed:      "a value of the type, base64 encoded for binary values",
+				InvalidValue: fmt.Sprint(n.Value),
+			}.Error())
+		}
+	}
+	return errStrings
+}
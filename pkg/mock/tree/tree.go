@@ -0,0 +1,231 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package tree holds the paths served by a mock in a tree, e.g. /latest/meta-data/instance-id, with the value or the
+// handler of each path. Handlers and directory listings are generated from the tree.
+package tree
+
+import (
+	"cmp"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/server"
+)
+
+const (
+	// Text values are served as plain text
+	Text Kind = "text"
+	// JSON values are served as indented JSON
+	JSON Kind = "json"
+	// Binary values are served as octet streams
+	Binary Kind = "binary"
+)
+
+// Kinds are the kinds of values
+var Kinds = []string{string(Text), string(JSON), string(Binary)}
+
+// Kind is how a value is served
+type Kind string
+
+// Value is the value of a path. Data is a string for text values, the bytes of binary values, or any data of JSON
+// values.
+type Value struct {
+	Kind Kind
+	Data interface{}
+}
+
+// Tree holds paths with their values or handlers. A path may hold a value and paths under it at the same time.
+type Tree struct {
+	root *node
+}
+
+// node is a path element, with the value or handler of its path, if any
+type node struct {
+	value    *Value
+	handler  server.HandlerType
+	children map[string]*node
+}
+
+// New returns an empty tree
+func New() *Tree {
+	return &Tree{root: &node{}}
+}
+
+// Set sets the value of the path, replacing its value or handler
+func (t *Tree) Set(path string, v Value) {
+	n := t.add(path)
+	n.value, n.handler = &v, nil
+}
+
+// Handle sets the handler of the path, replacing its value or handler
+func (t *Tree) Handle(path string, handler server.HandlerType) {
+	n := t.add(path)
+	n.value, n.handler = nil, handler
+}
+
+// Delete removes the path and the paths under it
+func (t *Tree) Delete(path string) {
+	elems := elements(path)
+	if len(elems) == 0 {
+		t.root = &node{}
+		return
+	}
+	if parent := t.find(strings.Join(elems[:len(elems)-1], "/")); parent != nil {
+		delete(parent.children, elems[len(elems)-1])
+	}
+}
+
+// Value returns the value of the path, if it has one
+func (t *Tree) Value(path string) (Value, bool) {
+	if n := t.find(path); n != nil && n.value != nil {
+		return *n.value, true
+	}
+	return Value{}, false
+}
+
+// Listings returns the directory listings of the tree by path, e.g. /latest/meta-data, computed in a single walk. A
+// listing holds the names of the paths with a value or handler under the path, and the names of the sub-directories
+// followed by a slash, sorted. Paths with both are listed once, as sub-directories. Paths without paths under them have no listing.
+func (t *Tree) Listings() map[string][]string {
+	listings := make(map[string][]string)
+	t.root.list("", listings)
+	return listings
+}
+
+// Paths returns the paths with a value or handler, sorted
+func (t *Tree) Paths() []string {
+	var paths []string
+	t.root.walk("", func(path string, n *node) {
+		if n.served() {
+			paths = append(paths, path)
+		}
+	})
+	slices.Sort(paths)
+	return paths
+}
+
+// Handler returns the handler serving the path: its own handler, or a handler serving its value
+func (t *Tree) Handler(path string) server.HandlerType {
+	n := t.find(path)
+	if n == nil || !n.served() {
+		return nil
+	}
+	if n.handler != nil {
+		return n.handler
+	}
+	v := *n.value
+	return func(res http.ResponseWriter, req *http.Request) {
+		log.Println("Received request to mock metadata:", req.URL.Path)
+		v.serve(res)
+	}
+}
+
+// serve returns the value in the format of its kind
+func (v Value) serve(res http.ResponseWriter) {
+	switch v.Kind {
+	case JSON:
+		server.FormatAndReturnJSONResponse(res, v.Data)
+	case Binary:
+		data, _ := v.Data.([]byte)
+		server.FormatAndReturnOctetResponse(res, string(data))
+	default:
+		data, _ := v.Data.(string)
+		server.FormatAndReturnTextResponse(res, data)
+	}
+}
+
+// Bytes returns the value as it is served
+func (v Value) Bytes() ([]byte, error) {
+	switch v.Kind {
+	case JSON:
+		return server.FormatJSON(v.Data)
+	case Binary:
+		data, _ := v.Data.([]byte)
+		return data, nil
+	default:
+		data, _ := v.Data.(string)
+		return []byte(data), nil
+	}
+}
+
+// add returns the node of the path, adding the nodes missing
+func (t *Tree) add(path string) *node {
+	n := t.root
+	for _, name := range elements(path) {
+		if n.children == nil {
+			n.children = make(map[string]*node)
+		}
+		child, ok := n.children[name]
+		if !ok {
+			child = &node{}
+			n.children[name] = child
+		}
+		n = child
+	}
+	return n
+}
+
+// find returns the node of the path, nil if there is none
+func (t *Tree) find(path string) *node {
+	n := t.root
+	for _, name := range elements(path) {
+		if n = n.children[name]; n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// served returns whether the path of the node has a value or handler
+func (n *node) served() bool {
+	return n.value != nil || n.handler != nil
+}
+
+// list adds the listings of the node and the nodes under it to listings, returning whether the node has a listing
+func (n *node) list(path string, listings map[string][]string) bool {
+	var entries []string
+	for name, child := range n.children {
+		// as IMDS lists each path once, a path with a value and paths under it is listed as a sub-directory
+		if child.list(path+"/"+name, listings) {
+			entries = append(entries, name+"/")
+		} else if child.served() {
+			entries = append(entries, name)
+		}
+	}
+	if len(entries) == 0 {
+		return false
+	}
+	slices.Sort(entries)
+	listings[cmp.Or(path, "/")] = entries
+	return true
+}
+
+// walk calls fn for the node and all nodes under it
+func (n *node) walk(path string, fn func(path string, n *node)) {
+	fn(path, n)
+	for name, child := range n.children {
+		child.walk(path+"/"+name, fn)
+	}
+}
+
+// elements returns the elements of the path
+func elements(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
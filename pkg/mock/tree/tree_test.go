@@ -0,0 +1,188 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tree
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/access"
+	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/dynamic/types"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+func TestListsValuesAndHandlers(t *testing.T) {
+	tr := New()
+	tr.Set("/latest/meta-data/foo", Value{Kind: Text, Data: "foo"})
+	tr.Set("/latest/meta-data/foo/bar", Value{Kind: Text, Data: "bar"})
+	tr.Handle("/latest/meta-data/spot/instance-action", func(res http.ResponseWriter, req *http.Request) {})
+
+	entries, ok := tr.Listings()["/latest/meta-data"]
+	h.Assert(t, ok && strings.Join(entries, ",") == "foo/,spot/", fmt.Sprintf("Expected a path with a value and paths under it to be listed once, but was %v", entries))
+	h.Assert(t, strings.Join(tr.Paths(), ",") == "/latest/meta-data/foo,/latest/meta-data/foo/bar,/latest/meta-data/spot/instance-action", fmt.Sprintf("Expected the served paths, but was %v", tr.Paths()))
+
+	tr.Delete("/latest/meta-data/foo")
+	listings := tr.Listings()
+	entries = listings["/latest/meta-data"]
+	h.Assert(t, strings.Join(entries, ",") == "spot/", fmt.Sprintf("Expected the paths under a deleted path to be deleted, but was %v", entries))
+	_, ok = listings["/latest/meta-data/foo"]
+	h.Assert(t, !ok, "Expected no listing of a deleted path")
+}
+
+func TestListingsMatchWholePathElements(t *testing.T) {
+	tr := New()
+	tr.Set("/latest/meta-data/iam/info", Value{Kind: Text, Data: "info"})
+	tr.Set("/latest/meta-data/iam/security-credentials/role", Value{Kind: Text, Data: "credentials"})
+	tr.Set("/latest/meta-data/instance-iam-role/info", Value{Kind: Text, Data: "info"})
+
+	listings := tr.Listings()
+	h.Assert(t, strings.Join(listings["/latest/meta-data/iam"], ",") == "info,security-credentials/", fmt.Sprintf("Expected only the paths under iam, but was %v", listings["/latest/meta-data/iam"]))
+	h.Assert(t, strings.Join(listings["/latest/meta-data"], ",") == "iam/,instance-iam-role/", fmt.Sprintf("Expected sub-directories to end with a slash, but was %v", listings["/latest/meta-data"]))
+	h.Assert(t, strings.Join(listings["/"], ",") == "latest/", fmt.Sprintf("Expected the listing of the root, but was %v", listings["/"]))
+}
+
+func TestHandlerServesValuesByKind(t *testing.T) {
+	tr := New()
+	tr.Set("/text", Value{Kind: Text, Data: "text"})
+	tr.Set("/json", Value{Kind: JSON, Data: map[string]interface{}{"key": "value"}})
+	tr.Set("/binary", Value{Kind: Binary, Data: []byte{0x01, 0x02}})
+	for _, tc := range []struct {
+		path        string
+		contentType string
+		body        string
+	}{
+		{"/text", "text/plain", "text"},
+		{"/json", "application/json", "\"key\": \"value\""},
+		{"/binary", "application/octet-stream", "\x01\x02"},
+	} {
+		res := httptest.NewRecorder()
+		tr.Handler(tc.path)(res, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		h.Assert(t, res.Header().Get("Content-Type") == tc.contentType, fmt.Sprintf("Expected %s to be served as %s, but was %s", tc.path, tc.contentType, res.Header().Get("Content-Type")))
+		h.Assert(t, strings.Contains(res.Body.String(), tc.body), fmt.Sprintf("Expected %s to contain %q, but was %q", tc.path, tc.body, res.Body.String()))
+	}
+	h.Assert(t, tr.Handler("/missing") == nil, "Expected no handler for a path without value")
+}
+
+func TestLoadFollowsMetadataValues(t *testing.T) {
+	c, err := cfg.NewDefaultConfig()
+	h.Ok(t, err)
+	defaultMac := c.Metadata.Values.Mac
+	c.Metadata.Values.Mac = "0e:00:00:00:00:01"
+	c.MetadataOptions.InstanceMetadataTags = access.Disabled
+	c.Metadata.Tree = []cfg.Node{
+		{Path: "/latest/meta-data/foo/bar", Value: "baz"},
+		{Path: "/latest/meta-data/network/interfaces/macs/{mac}/custom", Value: "custom"},
+		{Path: "/latest/meta-data/foo/data", Type: "binary", Value: "AQI="},
+		{Path: "/latest/meta-data/foo/doc", Value: map[string]interface{}{"key": "value"}},
+	}
+	tr := Load(c)
+
+	macPath := "/latest/meta-data/network/interfaces/macs/0e:00:00:00:00:01"
+	_, ok := tr.Value(macPath + "/subnet-id")
+	h.Assert(t, ok, "Expected the paths of the mac address to follow its value")
+	listings := tr.Listings()
+	_, ok = listings["/latest/meta-data/network/interfaces/macs/"+defaultMac]
+	h.Assert(t, !ok, "Expected no paths of the default mac address")
+	v, ok := tr.Value(macPath + "/custom")
+	h.Assert(t, ok && v.Data == "custom", fmt.Sprintf("Expected placeholders in node paths to be expanded, but was %v", v))
+	v, _ = tr.Value("/latest/meta-data/foo/bar")
+	h.Assert(t, v.Kind == Text && v.Data == "baz", fmt.Sprintf("Expected a text node, but was %v", v))
+	v, _ = tr.Value("/latest/meta-data/foo/data")
+	h.Assert(t, v.Kind == Binary && string(v.Data.([]byte)) == "\x01\x02", fmt.Sprintf("Expected a decoded binary node, but was %v", v))
+	v, _ = tr.Value("/latest/meta-data/foo/doc")
+	h.Assert(t, v.Kind == JSON, fmt.Sprintf("Expected a JSON node, but was %v", v))
+	_, ok = listings["/latest/meta-data/tags"]
+	h.Assert(t, !ok, "Expected no instance tags unless enabled")
+}
+
+func TestLoadDerivesDuplicatedValues(t *testing.T) {
+	c, err := cfg.NewDefaultConfig()
+	h.Ok(t, err)
+	defaultImageID := c.Dynamic.Values.InstanceIdentityDocument.ImageId
+	c.Metadata.Values.InstanceID = "i-0123456789abcdef1"
+	c.Metadata.Values.PlacementAvailabilityZone = "eu-west-1b"
+	c.Metadata.Values.LocalIpv4 = "10.1.2.3"
+	c.Metadata.Values.Hostname = "custom.example"
+	c.Dynamic.Values.InstanceIdentityDocument.InstanceType = "c5.large"
+
+	document := func(tr *Tree) types.InstanceIdentityDocument {
+		v, ok := tr.Value(c.Dynamic.Paths.InstanceIdentityDocument)
+		h.Assert(t, ok, "Expected the instance identity document")
+		return v.Data.(types.InstanceIdentityDocument)
+	}
+	doc := document(Load(c))
+	h.Assert(t, doc.InstanceId != c.Metadata.Values.InstanceID && doc.ImageId == defaultImageID, fmt.Sprintf("Expected no values derived unless derive-values is set, but was %+v", doc))
+
+	c.DeriveValues = true
+	tr := Load(c)
+	doc = document(tr)
+	h.Assert(t, doc.InstanceId == c.Metadata.Values.InstanceID && doc.ImageId == c.Metadata.Values.AmiID && doc.PrivateIp == "10.1.2.3",
+		fmt.Sprintf("Expected the document to be derived from the metadata values, but was %+v", doc))
+	h.Assert(t, doc.AvailabilityZone == "eu-west-1b" && doc.Region == "eu-west-1", fmt.Sprintf("Expected the placement of the metadata values, but was %+v", doc))
+	h.Assert(t, doc.InstanceType == "c5.large", fmt.Sprintf("Expected the overridden instance type to win, but was %s", doc.InstanceType))
+	for path, expected := range map[string]string{
+		c.Metadata.Paths.PlacementRegion: "eu-west-1",
+		c.Metadata.Paths.LocalHostName:   "ip-10-1-2-3.eu-west-1.compute.internal",
+		c.Metadata.Paths.Hostname:        "custom.example",
+	} {
+		v, _ := tr.Value(path)
+		h.Assert(t, v.Data == expected, fmt.Sprintf("Expected %s to be %s, but was %v", path, expected, v.Data))
+	}
+}
+
+func TestLoadKeepsExplicitDefaults(t *testing.T) {
+	c, err := cfg.NewDefaultConfig()
+	h.Ok(t, err)
+	defaultRegion := c.Metadata.Values.PlacementRegion
+	defaultImageID := c.Dynamic.Values.InstanceIdentityDocument.ImageId
+	c.DeriveValues = true
+	c.Metadata.Values.PlacementAvailabilityZone = "eu-west-1b"
+	c.ExplicitKeys = map[string]bool{"metadata.values.placement-region": true, "dynamic.values.instance-identity-document.imageid": true}
+
+	tr := Load(c)
+	v, _ := tr.Value(c.Metadata.Paths.PlacementRegion)
+	h.Assert(t, v.Data == defaultRegion, fmt.Sprintf("Expected the explicit region %s, but was %v", defaultRegion, v.Data))
+	v, _ = tr.Value(c.Dynamic.Paths.InstanceIdentityDocument)
+	doc := v.Data.(types.InstanceIdentityDocument)
+	h.Assert(t, doc.ImageId == defaultImageID && doc.AvailabilityZone == "eu-west-1b",
+		fmt.Sprintf("Expected the explicit image id and the derived availability zone, but was %+v", doc))
+}
+
+func TestRegionAndHostnameOfZone(t *testing.T) {
+	for zone, region := range map[string]string{
+		"us-east-1a":       "us-east-1",
+		"us-west-2-lax-1a": "us-west-2",
+		"us-gov-west-1b":   "us-gov-west-1",
+		"invalid":          "",
+	} {
+		h.Assert(t, regionPattern.FindString(zone) == region, fmt.Sprintf("Expected the region of %s to be %s, but was %s", zone, region, regionPattern.FindString(zone)))
+	}
+	h.Assert(t, localHostname("172.16.34.43", "us-east-1") == "ip-172-16-34-43.ec2.internal", "Expected the hostname of us-east-1")
+	h.Assert(t, localHostname("2001:db8::1", "us-east-1") == "", "Expected no hostname of an IPv6 address")
+}
+
+func TestValidateTree(t *testing.T) {
+	errs := ValidateTree("metadata.tree", []cfg.Node{
+		{Path: "/latest/meta-data/foo", Value: "foo"},
+		{Path: "/foo", Value: "foo"},
+		{Path: "/latest/meta-data/bar", Type: "xml", Value: "bar"},
+		{Path: "/latest/meta-data/baz", Type: "binary", Value: "not base64"},
+	})
+	h.Assert(t, len(errs) == 3, fmt.Sprintf("Expected 3 errors, but got %d: %v", len(errs), errs))
+	h.Assert(t, strings.Contains(errs[0], "metadata.tree[1].path") && strings.Contains(errs[1], "metadata.tree[2].type") && strings.Contains(errs[2], "metadata.tree[3].value"), fmt.Sprintf("Expected the invalid nodes, but got %v", errs))
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package versions
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	e "github.com/aws/amazon-ec2-metadata-mock/pkg/error"
+)
+
+// Latest is the version of the metadata API serving all paths
+const Latest = "latest"
+
+var (
+	// Versions are the dated versions of the metadata API IMDS lists, oldest first
+	Versions = []string{
+		"1.0", "2007-01-19", "2007-03-01", "2007-08-29", "2007-10-10", "2007-12-15", "2008-02-01", "2008-09-01",
+		"2009-04-04", "2011-01-01", "2011-05-01", "2012-01-12", "2014-02-25", "2014-11-05", "2015-10-20", "2016-04-19",
+		"2016-06-30", "2016-09-02", "2018-03-28", "2018-08-17", "2018-09-24", "2019-10-01", "2020-10-27", "2021-01-03",
+		"2021-03-23", "2021-07-15", "2022-09-24", "2024-04-11",
+	}
+
+	// Introduced maps paths, relative to the version, to the version of the metadata API they were introduced in. The
+	// paths under a path were introduced with it unless listed, and * matches any path element, e.g. a mac.
+	// Directories are introduced with their oldest path.
+	Introduced = map[string]string{
+		"meta-data":                                                   "1.0",
+		"meta-data/ami-launch-index":                                  "2007-01-19",
+		"meta-data/autoscaling":                                       "2021-07-15",
+		"meta-data/block-device-mapping":                              "2007-12-15",
+		"meta-data/elastic-inference":                                 "2018-11-29",
+		"meta-data/events":                                            "2018-08-17",
+		"meta-data/events/recommendations":                            "2020-10-27",
+		"meta-data/iam":                                               "2012-01-12",
+		"meta-data/instance-action":                                   "2008-09-01",
+		"meta-data/instance-life-cycle":                               "2019-10-01",
+		"meta-data/instance-type":                                     "2007-08-29",
+		"meta-data/kernel-id":                                         "2008-02-01",
+		"meta-data/local-hostname":                                    "2007-01-19",
+		"meta-data/mac":                                               "2011-01-01",
+		"meta-data/network":                                           "2011-01-01",
+		"meta-data/network/interfaces/macs/*/ipv4-prefix":             "2021-07-15",
+		"meta-data/network/interfaces/macs/*/ipv6-prefix":             "2021-07-15",
+		"meta-data/network/interfaces/macs/*/ipv6s":                   "2016-06-30",
+		"meta-data/network/interfaces/macs/*/network-card-index":      "2020-11-01",
+		"meta-data/network/interfaces/macs/*/subnet-ipv6-cidr-blocks": "2016-06-30",
+		"meta-data/network/interfaces/macs/*/vpc-ipv4-cidr-blocks":    "2016-06-30",
+		"meta-data/network/interfaces/macs/*/vpc-ipv6-cidr-blocks":    "2016-06-30",
+		"meta-data/placement":                                         "2008-02-01",
+		"meta-data/placement/availability-zone-id":                    "2019-10-01",
+		"meta-data/placement/group-name":                              "2020-08-24",
+		"meta-data/placement/host-id":                                 "2020-08-24",
+		"meta-data/placement/partition-number":                        "2020-08-24",
+		"meta-data/placement/region":                                  "2020-08-24",
+		"meta-data/product-codes":                                     "2007-03-01",
+		"meta-data/public-hostname":                                   "2007-01-19",
+		"meta-data/public-ipv4":                                       "2007-01-19",
+		"meta-data/ramdisk-id":                                        "2007-10-10",
+		"meta-data/services":                                          "2014-02-25",
+		"meta-data/services/partition":                                "2015-10-20",
+		"meta-data/spot":                                              "2014-11-05",
+		"meta-data/spot/instance-action":                              "2016-11-15",
+		"meta-data/tags":                                              "2021-03-23",
+		"dynamic":                                                     "2009-04-04",
+		"user-data":                                                   "1.0",
+	}
+
+	// categories are the paths served under every version
+	categories = []string{"meta-data", "dynamic", "user-data"}
+)
+
+type versionKey struct{}
+
+// Table tells which paths the versions of the metadata API serve
+type Table struct {
+	versions   []string
+	introduced map[string]string
+}
+
+// New returns the table of the given config: its versions replace the default versions if not empty, and its
+// introduced versions override the default ones
+func New(c cfg.APIVersions) *Table {
+	t := &Table{versions: Versions, introduced: maps.Clone(Introduced)}
+	if len(c.Versions) > 0 {
+		t.versions = slices.Clone(c.Versions)
+	}
+	maps.Copy(t.introduced, c.Introduced)
+	return t
+}
+
+// Versions returns the dated versions served, oldest first
+func (t *Table) Versions() []string {
+	return t.versions
+}
+
+// Serves returns whether the dated version is served
+func (t *Table) Serves(version string) bool {
+	return slices.Contains(t.versions, version)
+}
+
+// Exists returns whether the path, relative to the version, existed in the version. Paths introduced in a version not
+// served, e.g. 2016-11-15, exist from the next version served. All paths exist in latest.
+func (t *Table) Exists(version string, path string) bool {
+	if version == Latest {
+		return true
+	}
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return true
+	}
+	elements := strings.Split(path, "/")
+	if !slices.Contains(categories, elements[0]) {
+		return false
+	}
+	introduced, matched := "", 0
+	for p, v := range t.introduced {
+		if n := len(strings.Split(p, "/")); n > matched && matches(strings.Split(p, "/"), elements) {
+			introduced, matched = v, n
+		}
+	}
+	// versions are 1.0 or dates, so they sort lexically
+	return introduced <= version
+}
+
+// matches returns whether the pattern elements match the first path elements
+func matches(pattern []string, elements []string) bool {
+	if len(pattern) > len(elements) {
+		return false
+	}
+	for i, p := range pattern {
+		if p != "*" && !strings.EqualFold(p, elements[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// WithVersion returns the request with the version of the metadata API it was sent to
+func WithVersion(req *http.Request, version string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), versionKey{}, version))
+}
+
+// FromRequest returns the version of the metadata API the request was sent to, latest if it was not sent to a dated
+// version
+func FromRequest(req *http.Request) string {
+	if v, ok := req.Context().Value(versionKey{}).(string); ok {
+		return v
+	}
+	return Latest
+}
+
+// ValidateAPIVersions returns the errors in the api versions config, with keys prefixed with keyPrefix
+func ValidateAPIVersions(keyPrefix string, c cfg.APIVersions) []string {
+	var errStrings []string
+	for _, v := range c.Versions {
+		if !valid(v) {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     keyPrefix + "versions",
+				Allowed:      "1.0 or dates in the format YYYY-MM-DD",
+				InvalidValue: v,
+			}.Error())
+		}
+	}
+	for _, p := range slices.Sorted(maps.Keys(c.Introduced)) {
+		if v := c.Introduced[p]; !valid(v) {
+			errStrings = append(errStrings, e.FlagValidationError{
+				FlagName:     keyPrefix + "introduced." + p,
+				Allowed:      "1.0 or a date in the format YYYY-MM-DD",
+				InvalidValue: v,
+			}.Error())
+		}
+	}
+	return errStrings
+}
+
+// valid returns whether the version is 1.0 or a date
+func valid(version string) bool {
+	_, err := time.Parse(time.DateOnly, version)
+	return version == "1.0" || err == nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package versions
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	cfg "github.com/aws/amazon-ec2-metadata-mock/pkg/config"
+	h "github.com/aws/amazon-ec2-metadata-mock/test"
+)
+
+func TestPathsExistFromTheirVersion(t *testing.T) {
+	table := New(cfg.APIVersions{Introduced: map[string]string{"meta-data/hostname": "2021-07-15"}})
+	for _, tc := range []struct {
+		version string
+		path    string
+		exists  bool
+	}{
+		{"1.0", "meta-data/instance-id", true},
+		{"1.0", "meta-data/instance-type", false},
+		{"2007-08-29", "meta-data/instance-type", true},
+		{"2008-09-01", "dynamic/instance-identity/document", false},
+		{"2009-04-04", "dynamic/instance-identity/document", true},
+		{"2016-09-02", "meta-data/spot", true},
+		{"2016-09-02", "meta-data/spot/instance-action", false},
+		{"2018-03-28", "meta-data/spot/instance-action", true},
+		{"2014-11-05", "meta-data/network/interfaces/macs/0e:49:61:0f:c3:11/local-ipv4s", true},
+		{"2014-11-05", "meta-data/network/interfaces/macs/0e:49:61:0f:c3:11/ipv6s", false},
+		{"2020-10-27", "meta-data/hostname", false},
+		{"2021-07-15", "meta-data/hostname", true},
+		{"2021-07-15", "api/token", false},
+		{"1.0", "", true},
+		{Latest, "meta-data/tags/instance/Name", true},
+	} {
+		h.Assert(t, table.Exists(tc.version, tc.path) == tc.exists, fmt.Sprintf("Expected %s to exist in %s: %t", tc.path, tc.version, tc.exists))
+	}
+	h.Assert(t, table.Serves("2009-04-04") && !table.Serves(Latest) && !table.Serves("2016-11-15"), "Expected only the dated versions listed to be served")
+}
+
+func TestValidateAPIVersions(t *testing.T) {
+	errs := ValidateAPIVersions("api-versions.", cfg.APIVersions{
+		Versions:   []string{"1.0", "2009-04-04", "v2"},
+		Introduced: map[string]string{"meta-data/spot": "2016-11-15", "meta-data/mac": "2011"},
+	})
+	h.Assert(t, len(errs) == 2, fmt.Sprintf("Expected 2 errors, but got %d: %v", len(errs), errs))
+	h.Assert(t, strings.Contains(errs[0], "v2") && strings.Contains(errs[1], "meta-data/mac"), fmt.Sprintf("Expected the invalid versions, but got %v", errs))
+}
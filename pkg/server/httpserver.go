@@ -14,13 +14,16 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"strings"
-
-	"github.com/gorilla/mux"
+	"time"
 )
 
 const notFoundResponse = `<?xml version="1.0" encoding="iso-8859-1"?>
@@ -35,6 +38,8 @@ const notFoundResponse = `<?xml version="1.0" encoding="iso-8859-1"?>
  </body>
 </html>`
 
+const defaultShutdownTimeout = 10 * time.Second
+
 // BadRequestResponse represents the IMDSv2 response in the event of missing or invalid parameters in the request
 const BadRequestResponse = `<?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
@@ -59,68 +64,192 @@ const UnauthorizedResponse = `<?xml version="1.0" encoding="UTF-8"?>
    </body>
 </html>`
 
-var (
-	// Routes represents the list of routes served by the http server
-	Routes []string
-	router = NewSwapper()
-)
+// ForbiddenResponse represents the IMDS response when access to the instance metadata service is disabled
+const ForbiddenResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en" lang="en">
+   <head>
+      <title>403 - Forbidden</title>
+   </head>
+   <body>
+      <h1>403 - Forbidden</h1>
+   </body>
+</html>`
+
+// MethodNotAllowedResponse represents the IMDS response in the event of an unsupported request method
+const MethodNotAllowedResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en" lang="en">
+   <head>
+      <title>405 - Method Not Allowed</title>
+   </head>
+   <body>
+      <h1>405 - Method Not Allowed</h1>
+   </body>
+</html>`
+
+// TooManyRequestsResponse represents the IMDS response in the event of throttling
+const TooManyRequestsResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en" lang="en">
+   <head>
+      <title>429 - Too Many Requests</title>
+   </head>
+   <body>
+      <h1>429 - Too Many Requests</h1>
+   </body>
+</html>`
 
 // HandlerType represents the function passed as an argument to HandleFunc
 type HandlerType func(http.ResponseWriter, *http.Request)
 
+// Server serves the routes registered on it. Servers share no state, so several can run in the same process.
+type Server struct {
+	// ShutdownTimeout is how long in-flight requests are given to complete when the server shuts down
+	ShutdownTimeout time.Duration
+
+	router      *swapper
+	middlewares []func(http.Handler) http.Handler
+	httpServer  *http.Server
+	done        chan error
+}
+
+// New returns a Server without any routes registered
+func New() *Server {
+	return &Server{
+		ShutdownTimeout: defaultShutdownTimeout,
+		router:          NewSwapper(),
+	}
+}
+
 // HandleFunc registers the handler function for the given pattern
-func HandleFunc(pattern string, requestHandler HandlerType) {
-	router.HandleFunc(pattern, requestHandler)
+func (s *Server) HandleFunc(pattern string, requestHandler HandlerType) {
+	s.router.HandleFunc(pattern, requestHandler)
 }
 
 // HandleFuncPrefix registers the handler function for the given prefix pattern
-func HandleFuncPrefix(pattern string, requestHandler HandlerType) {
-	router.HandleFuncPrefix(pattern, requestHandler)
+func (s *Server) HandleFuncPrefix(pattern string, requestHandler HandlerType) {
+	s.router.HandleFuncPrefix(pattern, requestHandler)
+}
+
+// Use adds a middleware wrapping every route, including routes registered after Reset. Middlewares run in the order
+// they are added and must be added before Start.
+func (s *Server) Use(middleware func(http.Handler) http.Handler) {
+	s.middlewares = append(s.middlewares, middleware)
 }
 
 // Reset resets the router swapper
-func Reset() {
-	router.Reset()
+func (s *Server) Reset() {
+	s.router.Reset()
+}
+
+// Swap replaces all routes served by the server with the routes registered on the given router at once
+func (s *Server) Swap(router *Router) {
+	s.router.Swap(router.router)
+}
+
+// Routes returns the list of routes served by the server
+func (s *Server) Routes() []string {
+	return routes(s.router.Walk)
+}
+
+// Handler returns the routes served by the server wrapped in its middlewares, e.g. to serve them without listening
+func (s *Server) Handler() http.Handler {
+	var handler http.Handler = s.router
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		handler = s.middlewares[i](handler)
+	}
+	return trailingSlashMiddleware(handler)
 }
 
-func listRoutes() {
-	router.Walk(func(route *mux.Route, r *mux.Router, ancestors []*mux.Route) error {
-		t, err := route.GetPathTemplate()
-		if err != nil {
-			return err
+// Start listens on the given hostname and port and serves all patterns setup via their respective handlers in the background.
+// It returns the address the server is bound to, which is useful when port "0" is given. The server shuts down when ctx is done.
+func (s *Server) Start(ctx context.Context, hostname string, port string) (string, error) {
+	var lc net.ListenConfig
+	listener, err := lc.Listen(ctx, "tcp", net.JoinHostPort(hostname, port))
+	if err != nil {
+		return "", fmt.Errorf("Failed to listen on %s:%s: %s", hostname, port, err)
+	}
+
+	s.httpServer = &http.Server{Handler: s.Handler()}
+	s.done = make(chan error, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.httpServer.Serve(listener)
+	}()
+	go func() {
+		var err error
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+			err = s.Shutdown(shutdownCtx)
+			cancel()
+		case err = <-served:
+		}
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
 		}
-		Routes = append(Routes, t)
+		s.done <- err
+		close(s.done)
+	}()
+	return listener.Addr().String(), nil
+}
+
+// Wait blocks until the server stops and returns the error that stopped it, if any
+func (s *Server) Wait() error {
+	if s.done == nil {
 		return nil
-	})
+	}
+	return <-s.done
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests to complete until ctx is done,
+// after which the remaining connections are closed
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.httpServer == nil {
+		return nil
+	}
+	log.Println("Shutting down, waiting for in-flight requests to complete")
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		log.Printf("Warning: Closing connections with requests still in-flight: %s\n", err)
+		return s.httpServer.Close()
+	}
+	return nil
 }
 
-// ListenAndServe serves all patterns setup via their respective handlers
-func ListenAndServe(hostname string, port string) {
-	listRoutes()
-	host := fmt.Sprint(hostname, ":", port)
-	if err := http.ListenAndServe(host, trailingSlashMiddleware(router)); err != nil {
-		panic(err)
+// Close immediately closes the listener and all connections of a started server
+func (s *Server) Close() error {
+	if s.httpServer == nil {
+		return nil
 	}
+	return s.httpServer.Close()
 }
 
 // FormatAndReturnJSONResponse formats the given data into JSON and returns the response
 func FormatAndReturnJSONResponse(res http.ResponseWriter, data interface{}) {
 	res.Header().Set("Content-Type", "application/json")
 
-	var err error
-	var metadataPrettyJSON []byte
-	if metadataPrettyJSON, err = json.MarshalIndent(data, "", "\t"); err != nil {
+	metadataPrettyJSON, err := FormatJSON(data)
+	if err != nil {
 		log.Fatalf("Error while attempting to format data %s for response: %s", data, err)
 	}
-
-	// In order to align with IMDS formatting, it is necessary to indent the response
-	// EXCEPT FOR values of type list, ex: marketplaceProductCodes
-	metadataPrettyJSON = removeIndentFromLists(metadataPrettyJSON)
 	res.Write(metadataPrettyJSON)
 	log.Println("Returned JSON mock response successfully.")
 	return
 }
 
+// FormatJSON formats the given data into JSON the way FormatAndReturnJSONResponse returns it
+func FormatJSON(data interface{}) ([]byte, error) {
+	metadataPrettyJSON, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	// In order to align with IMDS formatting, it is necessary to indent the response
+	// EXCEPT FOR values of type list, ex: marketplaceProductCodes
+	return removeIndentFromLists(metadataPrettyJSON), nil
+}
+
 // FormatAndReturnTextResponse formats the given data as plaintext and returns the response
 func FormatAndReturnTextResponse(res http.ResponseWriter, data string) {
 	res.Header().Set("Content-Type", "text/plain")
@@ -168,6 +297,51 @@ func ReturnUnauthorizedResponse(w http.ResponseWriter) {
 	return
 }
 
+// ReturnForbiddenResponse returns response with 403 Forbidden
+func ReturnForbiddenResponse(w http.ResponseWriter) {
+	http.Error(w, ForbiddenResponse, http.StatusForbidden)
+	return
+}
+
+// ReturnMethodNotAllowedResponse returns response with 405 Method Not Allowed, listing the allowed methods in the Allow header
+func ReturnMethodNotAllowedResponse(w http.ResponseWriter, allowedMethods ...string) {
+	w.Header().Set("Allow", strings.Join(allowedMethods, ", "))
+	http.Error(w, MethodNotAllowedResponse, http.StatusMethodNotAllowed)
+	return
+}
+
+// ReturnTooManyRequestsResponse returns response with 429 Too Many Requests
+func ReturnTooManyRequestsResponse(w http.ResponseWriter) {
+	http.Error(w, TooManyRequestsResponse, http.StatusTooManyRequests)
+	return
+}
+
+// ResetConnection closes the connection with a TCP reset instead of a response, like a host that is gone
+func ResetConnection(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		// discard unsent data and send RST rather than FIN on close
+		tcpConn.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// HangConnection takes over the connection without ever responding, like a host that does not answer anymore. The
+// connection is closed once the client closes it.
+func HangConnection(w http.ResponseWriter) {
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	go func() {
+		io.Copy(io.Discard, buf)
+		conn.Close()
+	}()
+}
+
 // trailingSlashMiddleware will remove trailing slashes and forward the request to the path's handler
 func trailingSlashMiddleware(pathHandler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
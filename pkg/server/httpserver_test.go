@@ -14,8 +14,13 @@
 package server
 
 import (
+	"context"
+	"io"
+	"net"
+	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/aws/amazon-ec2-metadata-mock/pkg/mock/dynamic/types"
 	h "github.com/aws/amazon-ec2-metadata-mock/test"
@@ -62,3 +67,66 @@ func TestFormatAndReturnJSONResponse(t *testing.T) {
 	actual := rr.Body.String()
 	h.Assert(t, expected == actual, "FormatAndReturnJSONResponse did not format InstanceIdentityDocument as expected.")
 }
+
+func TestShutdownWaitsForInFlightRequests(t *testing.T) {
+	srv := New()
+	received := make(chan struct{})
+	srv.HandleFunc("/slow", func(res http.ResponseWriter, req *http.Request) {
+		close(received)
+		time.Sleep(200 * time.Millisecond)
+		FormatAndReturnTextResponse(res, "done")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, err := srv.Start(ctx, "127.0.0.1", "0")
+	h.Ok(t, err)
+
+	respBody := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			respBody <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		respBody <- string(body)
+	}()
+
+	<-received
+	cancel()
+	h.Ok(t, srv.Wait())
+	body := <-respBody
+	h.Assert(t, body == "done", "Expected the in-flight request to complete during shutdown, but was %s", body)
+}
+
+func TestStartReturnsErrorWhenPortInUse(t *testing.T) {
+	first := New()
+	addr, err := first.Start(context.Background(), "127.0.0.1", "0")
+	h.Ok(t, err)
+	defer first.Close()
+
+	_, port, _ := net.SplitHostPort(addr)
+	_, err = New().Start(context.Background(), "127.0.0.1", port)
+	h.Assert(t, err != nil, "Expected an error when the port is already in use")
+}
+
+func TestSwapReplacesAllRoutes(t *testing.T) {
+	srv := New()
+	srv.HandleFunc("/old", func(res http.ResponseWriter, req *http.Request) {
+		FormatAndReturnTextResponse(res, "old")
+	})
+	router := NewRouter()
+	router.HandleFunc("/new", func(res http.ResponseWriter, req *http.Request) {
+		FormatAndReturnTextResponse(res, "new")
+	})
+	h.ItemsMatch(t, []string{"/new"}, router.Routes())
+
+	srv.Swap(router)
+	h.ItemsMatch(t, []string{"/new"}, srv.Routes())
+	rr := httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/old", nil))
+	h.Assert(t, rr.Code == http.StatusNotFound, "Expected swapped out routes not to be served, but was %d", rr.Code)
+	rr = httptest.NewRecorder()
+	srv.router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/new", nil))
+	h.Assert(t, rr.Body.String() == "new", "Expected swapped in routes to be served, but was %s", rr.Body.String())
+}
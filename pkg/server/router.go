@@ -0,0 +1,66 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Router collects routes apart from a running server, so they can be swapped in all at once via Server.Swap.
+// Requests are never served by a partially registered set of routes.
+type Router struct {
+	router *mux.Router
+}
+
+// NewRouter returns a Router without any routes registered
+func NewRouter() *Router {
+	return &Router{router: mux.NewRouter()}
+}
+
+// HandleFunc registers the handler function for the given pattern
+func (r *Router) HandleFunc(pattern string, requestHandler HandlerType) {
+	r.router.HandleFunc(pattern, requestHandler)
+}
+
+// HandleFuncPrefix registers the handler function for the given prefix pattern
+func (r *Router) HandleFuncPrefix(pattern string, requestHandler HandlerType) {
+	r.router.PathPrefix(pattern).HandlerFunc(requestHandler)
+}
+
+// ServeHTTP serves the request with the routes registered on the router, e.g. to serve some requests apart from the
+// routes swapped into a server
+func (r *Router) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	r.router.ServeHTTP(res, req)
+}
+
+// Routes returns the list of routes registered on the router
+func (r *Router) Routes() []string {
+	return routes(r.router.Walk)
+}
+
+// routes returns the path templates of all routes visited by walk
+func routes(walk func(mux.WalkFunc) error) []string {
+	var routes []string
+	walk(func(route *mux.Route, r *mux.Router, ancestors []*mux.Route) error {
+		t, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		routes = append(routes, t)
+		return nil
+	})
+	return routes
+}
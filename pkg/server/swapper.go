@@ -29,10 +29,10 @@ func (rs *swapper) Reset() {
 	rs.mu.Unlock()
 }
 
-func (rs *swapper) Walk(f func(route *mux.Route, r *mux.Router, ancestors []*mux.Route) error) {
+func (rs *swapper) Walk(f mux.WalkFunc) error {
 	rs.mu.Lock()
-	rs.router.Walk(f)
-	rs.mu.Unlock()
+	defer rs.mu.Unlock()
+	return rs.router.Walk(f)
 }
 
 func (rs *swapper) HandleFuncPrefix(pattern string, requestHandler HandlerType) {